@@ -0,0 +1,298 @@
+package cib
+
+import (
+	"fmt"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// AttributeLifetime determines where a node attribute is stored.
+type AttributeLifetime string
+
+const (
+	// LifetimeForever attributes are stored in the node's section of the
+	// configuration and survive restarts of the cluster stack.
+	LifetimeForever AttributeLifetime = "forever"
+	// LifetimeReboot attributes are transient. They are managed by the
+	// attribute daemon, stored in the node's status section and cleared
+	// when the node leaves the cluster.
+	LifetimeReboot AttributeLifetime = "reboot"
+)
+
+const cibTagTransientAttr = "transient_attributes"
+
+// ListNodeAttributes returns all attributes of a node with the given
+// lifetime.
+func (c *CIB) ListNodeAttributes(node string, lifetime AttributeLifetime) (map[string]string, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return nodeAttributes(root, node, lifetime)
+}
+
+// GetNodeAttribute returns the value of a node attribute with the given
+// lifetime. The boolean result is false if the attribute is not set.
+func (c *CIB) GetNodeAttribute(node, name string, lifetime AttributeLifetime) (string, bool, error) {
+	attrs, err := c.ListNodeAttributes(node, lifetime)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, ok := attrs[name]
+	return value, ok, nil
+}
+
+// EffectiveNodeAttributes returns the attributes of a node as Pacemaker
+// sees them: the permanent attributes, overridden by transient attributes
+// of the same name.
+func (c *CIB) EffectiveNodeAttributes(node string) (map[string]string, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return effectiveNodeAttributes(root, node)
+}
+
+// GetEffectiveNodeAttribute returns the effective value of a node attribute,
+// see EffectiveNodeAttributes. The boolean result is false if the attribute
+// is set in neither lifetime.
+func (c *CIB) GetEffectiveNodeAttribute(node, name string) (string, bool, error) {
+	attrs, err := c.EffectiveNodeAttributes(node)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, ok := attrs[name]
+	return value, ok, nil
+}
+
+// SetNodeAttribute sets a node attribute with the given lifetime.
+//
+// Permanent attributes are written to the configuration directly. Transient
+// attributes are set using crm_attribute, so that the attribute daemon,
+// which owns them, learns about the change.
+func (c *CIB) SetNodeAttribute(node, name, value string, lifetime AttributeLifetime) error {
+	switch lifetime {
+	case LifetimeReboot:
+		_, stderr, err := attributeCommand.execute("", "--node", node, "--name", name, "--update", value)
+		if err != nil {
+			return fmt.Errorf("could not set transient attribute %s on node %s: %w: %s",
+				name, node, err, strings.TrimSpace(stderr))
+		}
+		return nil
+	case LifetimeForever:
+	default:
+		return fmt.Errorf("invalid attribute lifetime '%s'", lifetime)
+	}
+
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	nodeElem, err := findNode(root, node)
+	if err != nil {
+		return err
+	}
+
+	nodeID := nodeElem.SelectAttrValue(cibAttrKeyID, "")
+	if nodeID == "" {
+		return fmt.Errorf("node doesn't have id attribute")
+	}
+
+	ids := NewIDAllocator(c.Doc)
+	var nvpair *xmltree.Element
+	var set *xmltree.Element
+	for _, s := range unconditionalSets(nodeElem, cibTagInstAttr) {
+		if set == nil {
+			set = s
+		}
+		if nvpair = findNvPair(s, name); nvpair != nil {
+			break
+		}
+	}
+
+	if nvpair == nil {
+		if set == nil {
+			set = nodeElem.CreateElement(cibTagInstAttr)
+			set.CreateAttr(cibAttrKeyID, ids.Allocate("nodes", nodeID))
+		}
+		nvpair = set.CreateElement(cibTagNvPair)
+		nvpair.CreateAttr(cibAttrKeyID, ids.Allocate(set.SelectAttrValue(cibAttrKeyID, ""), name))
+		nvpair.CreateAttr(cibAttrKeyName, name)
+	}
+	nvpair.CreateAttr(cibAttrKeyValue, value)
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// DeleteNodeAttribute removes a node attribute with the given lifetime.
+// Deleting an attribute that is not set is not an error.
+func (c *CIB) DeleteNodeAttribute(node, name string, lifetime AttributeLifetime) error {
+	switch lifetime {
+	case LifetimeReboot:
+		_, stderr, err := attributeCommand.execute("", "--node", node, "--name", name, "--delete")
+		if err != nil {
+			return fmt.Errorf("could not delete transient attribute %s on node %s: %w: %s",
+				name, node, err, strings.TrimSpace(stderr))
+		}
+		return nil
+	case LifetimeForever:
+	default:
+		return fmt.Errorf("invalid attribute lifetime '%s'", lifetime)
+	}
+
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	nodeElem, err := findNode(root, node)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for _, set := range unconditionalSets(nodeElem, cibTagInstAttr) {
+		for nvpair := findNvPair(set, name); nvpair != nil; nvpair = findNvPair(set, name) {
+			set.RemoveChild(nvpair)
+			removed = true
+		}
+	}
+	if !removed {
+		log.WithFields(log.Fields{"node": node, "attribute": name}).Debug("attribute not set, nothing to delete")
+		return nil
+	}
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// nodeAttributes collects the attributes of a node with the given lifetime
+// from an already read document.
+func nodeAttributes(root *xmltree.Element, node string, lifetime AttributeLifetime) (map[string]string, error) {
+	switch lifetime {
+	case LifetimeForever:
+		nodeElem, err := findNode(root, node)
+		if err != nil {
+			return nil, err
+		}
+		return nvsetValues(nodeElem, cibTagInstAttr), nil
+	case LifetimeReboot:
+		state := findNodeStateElement(root, node)
+		if state == nil {
+			return map[string]string{}, nil
+		}
+		return transientAttributes(state), nil
+	default:
+		return nil, fmt.Errorf("invalid attribute lifetime '%s'", lifetime)
+	}
+}
+
+// transientAttributes collects the transient attributes from the status
+// entry of a node.
+func transientAttributes(state *xmltree.Element) map[string]string {
+	attrs := make(map[string]string)
+	for _, transient := range state.SelectElements(cibTagTransientAttr) {
+		for k, v := range nvsetValues(transient, cibTagInstAttr) {
+			if _, ok := attrs[k]; !ok {
+				attrs[k] = v
+			}
+		}
+	}
+	return attrs
+}
+
+// effectiveNodeAttributes merges the permanent and transient attributes of
+// a node, transient attributes taking precedence.
+func effectiveNodeAttributes(root *xmltree.Element, node string) (map[string]string, error) {
+	attrs, err := nodeAttributes(root, node, LifetimeForever)
+	if err != nil {
+		return nil, err
+	}
+
+	transient, err := nodeAttributes(root, node, LifetimeReboot)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range transient {
+		attrs[k] = v
+	}
+
+	return attrs, nil
+}
+
+// findNodeStateElement finds the status section of a node. Status entries
+// are matched by the ID of the configured node, falling back to the node
+// name for nodes that are not part of the configuration.
+func findNodeStateElement(root *xmltree.Element, node string) *xmltree.Element {
+	nodeID := ""
+	if nodeElem, err := findNode(root, node); err == nil {
+		nodeID = nodeElem.SelectAttrValue(cibAttrKeyID, "")
+	}
+
+	var byName *xmltree.Element
+	for _, state := range root.FindElements("status/node_state") {
+		if nodeID != "" && state.SelectAttrValue(cibAttrKeyID, "") == nodeID {
+			return state
+		}
+		if byName == nil && state.SelectAttrValue("uname", "") == node {
+			byName = state
+		}
+	}
+	return byName
+}
+
+// unconditionalSets returns the attribute sets of the given tag that do not
+// contain a rule.
+func unconditionalSets(elem *xmltree.Element, tag string) []*xmltree.Element {
+	var sets []*xmltree.Element
+	for _, set := range elem.SelectElements(tag) {
+		if set.SelectElement("rule") == nil {
+			sets = append(sets, set)
+		}
+	}
+	return sets
+}
+
+// findNvPair finds an nvpair by name in an attribute set.
+func findNvPair(set *xmltree.Element, name string) *xmltree.Element {
+	for _, nvpair := range set.SelectElements(cibTagNvPair) {
+		if nvpair.SelectAttrValue(cibAttrKeyName, "") == name {
+			return nvpair
+		}
+	}
+	return nil
+}
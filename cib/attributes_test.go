@@ -0,0 +1,268 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const attributesXML = `<cib><configuration>
+<nodes>
+	<node id="1" uname="la1">
+		<instance_attributes id="nodes-1">
+			<nvpair id="nodes-1-site" name="site" value="a"/>
+			<nvpair id="nodes-1-standby" name="standby" value="off"/>
+		</instance_attributes>
+	</node>
+	<node id="2" uname="la2"/>
+</nodes>
+</configuration>
+<status>
+	<node_state id="1" uname="la1">
+		<transient_attributes id="1">
+			<instance_attributes id="status-1">
+				<nvpair id="status-1-standby" name="standby" value="on"/>
+				<nvpair id="status-1-master-p_drbd" name="master-p_drbd" value="10000"/>
+			</instance_attributes>
+		</transient_attributes>
+	</node_state>
+	<node_state id="2" uname="la2"/>
+</status></cib>`
+
+func TestNodeAttributes(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return attributesXML, "", nil
+		},
+	}
+
+	cases := []struct {
+		desc   string
+		get    func(c *CIB) (map[string]string, error)
+		expect map[string]string
+	}{{
+		desc: "permanent",
+		get: func(c *CIB) (map[string]string, error) {
+			return c.ListNodeAttributes("la1", LifetimeForever)
+		},
+		expect: map[string]string{"site": "a", "standby": "off"},
+	}, {
+		desc: "transient",
+		get: func(c *CIB) (map[string]string, error) {
+			return c.ListNodeAttributes("la1", LifetimeReboot)
+		},
+		expect: map[string]string{"standby": "on", "master-p_drbd": "10000"},
+	}, {
+		desc: "effective",
+		get: func(c *CIB) (map[string]string, error) {
+			return c.EffectiveNodeAttributes("la1")
+		},
+		expect: map[string]string{"site": "a", "standby": "on", "master-p_drbd": "10000"},
+	}, {
+		desc: "no transient attributes",
+		get: func(c *CIB) (map[string]string, error) {
+			return c.ListNodeAttributes("la2", LifetimeReboot)
+		},
+		expect: map[string]string{},
+	}}
+
+	for _, c := range cases {
+		var cib CIB
+		actual, err := c.get(&cib)
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if !cmp.Equal(actual, c.expect) {
+			t.Errorf("Attributes do not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %v", c.expect)
+			t.Errorf("Actual: %v", actual)
+		}
+	}
+
+	var cib CIB
+	standby, err := cib.IsStandbyNode("la1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !standby {
+		t.Errorf("Expected la1 to be in standby because of the transient attribute")
+	}
+
+	standby, err = cib.IsStandbyNode("la2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standby {
+		t.Errorf("Expected la2 not to be in standby")
+	}
+
+	if _, _, err := cib.GetNodeAttribute("la3", "site", LifetimeForever); err == nil {
+		t.Errorf("Expected error for unknown node")
+	}
+}
+
+func TestSetNodeAttribute(t *testing.T) {
+	input := `<cib><configuration><nodes>
+		<node id="1" uname="la1"><instance_attributes id="nodes-1">
+			<nvpair id="nodes-1-site" name="site" value="a"/>
+		</instance_attributes></node>
+		<node id="2" uname="la2"/>
+	</nodes></configuration></cib>`
+
+	cases := []struct {
+		desc     string
+		node     string
+		name     string
+		value    string
+		lifetime AttributeLifetime
+		expect   string
+		args     []string
+	}{{
+		desc:     "change permanent attribute",
+		node:     "la1",
+		name:     "site",
+		value:    "b",
+		lifetime: LifetimeForever,
+		expect: `<cib><configuration><nodes>
+			<node id="1" uname="la1"><instance_attributes id="nodes-1">
+				<nvpair id="nodes-1-site" name="site" value="b"/>
+			</instance_attributes></node>
+			<node id="2" uname="la2"/>
+		</nodes></configuration></cib>`,
+	}, {
+		desc:     "create permanent attribute",
+		node:     "la2",
+		name:     "site",
+		value:    "b",
+		lifetime: LifetimeForever,
+		expect: `<cib><configuration><nodes>
+			<node id="1" uname="la1"><instance_attributes id="nodes-1">
+				<nvpair id="nodes-1-site" name="site" value="a"/>
+			</instance_attributes></node>
+			<node id="2" uname="la2"><instance_attributes id="nodes-2">
+				<nvpair id="nodes-2-site" name="site" value="b"/>
+			</instance_attributes></node>
+		</nodes></configuration></cib>`,
+	}, {
+		desc:     "set transient attribute",
+		node:     "la2",
+		name:     "standby",
+		value:    "on",
+		lifetime: LifetimeReboot,
+		args:     []string{"--node", "la2", "--name", "standby", "--update", "on"},
+	}}
+
+	for _, c := range cases {
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return input, "", nil
+			},
+		}
+
+		updated := false
+		updateCommand = &testCommand{
+			func(actual string) (string, string, error) {
+				updated = true
+				normExpect := normalizeXML(t, c.expect)
+				normActual := normalizeXML(t, actual)
+				if normActual != normExpect {
+					t.Errorf("XML does not match (input '%s')", c.desc)
+					t.Errorf("Expected: %s", normExpect)
+					t.Errorf("Actual: %s", normActual)
+				}
+				return "", "", nil
+			},
+		}
+
+		var args []string
+		attributeCommand = &argsCommand{
+			func(_ string, a []string) (string, string, error) {
+				args = a
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		err := cib.SetNodeAttribute(c.node, c.name, c.value, c.lifetime)
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if updated != (c.expect != "") {
+			t.Errorf("Unexpected CIB update in case '%s': %t", c.desc, updated)
+		}
+		if !cmp.Equal(args, c.args) {
+			t.Errorf("Arguments do not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %v", c.args)
+			t.Errorf("Actual: %v", args)
+		}
+	}
+}
+
+func TestDeleteNodeAttribute(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return attributesXML, "", nil
+		},
+	}
+
+	expect := `<cib><configuration>
+	<nodes>
+		<node id="1" uname="la1">
+			<instance_attributes id="nodes-1">
+				<nvpair id="nodes-1-site" name="site" value="a"/>
+			</instance_attributes>
+		</node>
+		<node id="2" uname="la2"/>
+	</nodes>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1">
+			<transient_attributes id="1">
+				<instance_attributes id="status-1">
+					<nvpair id="status-1-standby" name="standby" value="on"/>
+					<nvpair id="status-1-master-p_drbd" name="master-p_drbd" value="10000"/>
+				</instance_attributes>
+			</transient_attributes>
+		</node_state>
+		<node_state id="2" uname="la2"/>
+	</status></cib>`
+
+	updateCommand = &testCommand{
+		func(actual string) (string, string, error) {
+			normExpect := normalizeXML(t, expect)
+			normActual := normalizeXML(t, actual)
+			if normActual != normExpect {
+				t.Errorf("XML does not match")
+				t.Errorf("Expected: %s", normExpect)
+				t.Errorf("Actual: %s", normActual)
+			}
+			return "", "", nil
+		},
+	}
+
+	var args []string
+	attributeCommand = &argsCommand{
+		func(_ string, a []string) (string, string, error) {
+			args = a
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	if err := cib.DeleteNodeAttribute("la1", "standby", LifetimeForever); err != nil {
+		t.Fatal(err)
+	}
+	if args != nil {
+		t.Errorf("Unexpected call of crm_attribute: %v", args)
+	}
+
+	if err := cib.DeleteNodeAttribute("la1", "standby", LifetimeReboot); err != nil {
+		t.Fatal(err)
+	}
+	expectArgs := []string{"--node", "la1", "--name", "standby", "--delete"}
+	if !cmp.Equal(args, expectArgs) {
+		t.Errorf("Unexpected arguments: %v", args)
+	}
+}
@@ -1,6 +1,7 @@
 package cib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -13,6 +14,10 @@ import (
 
 type CIB struct {
 	Doc *xmltree.Document
+	// StatusSource selects where GetNodeOfResource and ListResourcesOnNode
+	// take the resource status from. The default is the CIB's status
+	// section.
+	StatusSource StatusSource
 }
 
 // Maximum number of CIB poll retries when waiting for CRM resources to stop
@@ -71,8 +76,15 @@ const (
 type ClusterProperty string
 
 const (
-	StonithEnabled ClusterProperty = "cib-bootstrap-options-stonith-enabled"
-	ClusterName    ClusterProperty = "cib-bootstrap-options-cluster-name"
+	StonithEnabled  ClusterProperty = "cib-bootstrap-options-stonith-enabled"
+	ClusterName     ClusterProperty = "cib-bootstrap-options-cluster-name"
+	MaintenanceMode ClusterProperty = "cib-bootstrap-options-maintenance-mode"
+
+	NodeHealthStrategy ClusterProperty = "cib-bootstrap-options-node-health-strategy"
+	NodeHealthBase     ClusterProperty = "cib-bootstrap-options-node-health-base"
+	NodeHealthRed      ClusterProperty = "cib-bootstrap-options-node-health-red"
+	NodeHealthYellow   ClusterProperty = "cib-bootstrap-options-node-health-yellow"
+	NodeHealthGreen    ClusterProperty = "cib-bootstrap-options-node-health-green"
 )
 
 type joinState string
@@ -86,7 +98,16 @@ const (
 
 type Node struct {
 	HostName string
+	ID       string
+	Type     NodeType
 	State    NodeState
+	// Connection is the resource that connects a remote or guest node to
+	// the cluster. For guest nodes, this is the resource that runs the
+	// guest, e.g. the virtual machine.
+	Connection string
+	// ConnectionHost is the cluster node the connection resource is
+	// active on. It is empty if a remote or guest node is not connected.
+	ConnectionHost string
 }
 
 type NodeState struct {
@@ -106,6 +127,18 @@ const (
 	Running LrmRunState = "Running"
 	// Stopped means that the resource is verfied as stopped
 	Stopped LrmRunState = "Stopped"
+	// Starting means that a start of the resource is pending
+	Starting LrmRunState = "Starting"
+	// Stopping means that a stop of the resource is pending
+	Stopping LrmRunState = "Stopping"
+	// Promoted means that the resource runs in the promoted role
+	Promoted LrmRunState = "Promoted"
+	// Unpromoted means that the resource runs in the unpromoted role
+	Unpromoted LrmRunState = "Unpromoted"
+	// Failed means that the last relevant operation of the resource failed
+	Failed LrmRunState = "Failed"
+	// Migrating means that a live migration of the resource is in progress
+	Migrating LrmRunState = "Migrating"
 )
 
 // ReadConfiguration calls the crm list command and parses the XML data it returns.
@@ -124,6 +157,24 @@ func (c *CIB) ReadConfiguration() error {
 	return nil
 }
 
+// root returns the <cib> root element of the current document. If no
+// document has been read yet, the configuration is read first.
+func (c *CIB) root() (*xmltree.Element, error) {
+	if c.Doc == nil {
+		err := c.ReadConfiguration()
+		if err != nil {
+			return nil, fmt.Errorf("could not read configuration: %w", err)
+		}
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return root, nil
+}
+
 func (c *CIB) CreateResource(xml string) error {
 	// Call cibadmin and pipe the CIB update data to the cluster resource manager
 	_, _, err := createCommand.execute(xml)
@@ -153,33 +204,64 @@ func (c *CIB) GetStonithEnabled() (bool, error) {
 }
 
 func (c *CIB) GetNodeID(uname string) (int, error) {
+	nodeIDStr, err := c.GetNodeIDString(uname)
+	if err != nil {
+		return 0, err
+	}
+
+	nodeID, err := strconv.Atoi(nodeIDStr)
+	if err != nil {
+		return 0, fmt.Errorf("could not convert node ID '%s' to number: %w",
+			nodeIDStr, err)
+	}
+
+	return nodeID, nil
+}
+
+// GetNodeIDString returns the ID of a node. Unlike GetNodeID, it also works
+// for Pacemaker Remote and guest nodes, whose IDs are not numeric.
+func (c *CIB) GetNodeIDString(uname string) (string, error) {
 	err := c.ReadConfiguration()
 	if err != nil {
-		return 0, fmt.Errorf("could not read configuration: %w", err)
+		return "", fmt.Errorf("could not read configuration: %w", err)
 	}
 
 	root := c.Doc.FindElement("/cib")
 	if root == nil {
-		return 0, fmt.Errorf("invalid cib state: root element not found")
+		return "", fmt.Errorf("invalid cib state: root element not found")
 	}
 
 	node, err := findNode(root, uname)
 	if err != nil {
-		return 0, fmt.Errorf("could not find node: %w", err)
+		// remote and guest nodes do not need an entry in the node section,
+		// their ID is their name
+		if _, ok := remoteNodesByName(root)[uname]; ok {
+			return uname, nil
+		}
+		return "", fmt.Errorf("could not find node: %w", err)
 	}
 
 	nodeIDStr := node.SelectAttrValue("id", "")
 	if nodeIDStr == "" {
-		return 0, fmt.Errorf("node doesn't have id attribute")
+		return "", fmt.Errorf("node doesn't have id attribute")
 	}
 
-	nodeID, err := strconv.Atoi(nodeIDStr)
+	return nodeIDStr, nil
+}
+
+func (c *CIB) SetMaintenanceMode(value bool) error {
+	return c.setClusterProperty(MaintenanceMode, strconv.FormatBool(value))
+}
+
+// GetMaintenanceMode reports whether the whole cluster is in maintenance
+// mode. An unset property means maintenance mode is off.
+func (c *CIB) GetMaintenanceMode() (bool, error) {
+	str, err := c.getClusterProperty(MaintenanceMode)
 	if err != nil {
-		return 0, fmt.Errorf("could not convert node ID '%s' to number: %w",
-			nodeIDStr, err)
+		return false, fmt.Errorf("failed to get cluster property: %w", err)
 	}
 
-	return nodeID, nil
+	return isTrue(str), nil
 }
 
 func (c *CIB) SetClusterName(value string) error {
@@ -191,6 +273,17 @@ func (c *CIB) GetClusterName() (string, error) {
 }
 
 func (c *CIB) setClusterProperty(prop ClusterProperty, value string) error {
+	return c.setClusterProperties(clusterPropertyValue{prop, value})
+}
+
+type clusterPropertyValue struct {
+	prop  ClusterProperty
+	value string
+}
+
+// setClusterProperties sets multiple properties in the "cib-bootstrap-options"
+// property set with a single update of the CIB.
+func (c *CIB) setClusterProperties(values ...clusterPropertyValue) error {
 	err := c.ReadConfiguration()
 	if err != nil {
 		return fmt.Errorf("could not read configuration: %w", err)
@@ -211,21 +304,27 @@ func (c *CIB) setClusterProperty(prop ClusterProperty, value string) error {
 		crmConfig = configuration.CreateElement("crm_config")
 	}
 
+	ids := NewIDAllocator(c.Doc)
 	cps := crmConfig.FindElement("cluster_property_set[@id='cib-bootstrap-options']")
 	if cps == nil {
+		if err := ids.Reserve("cib-bootstrap-options"); err != nil {
+			return fmt.Errorf("could not create cluster property set: %w", err)
+		}
 		cps = crmConfig.CreateElement("cluster_property_set")
 		cps.CreateAttr("id", "cib-bootstrap-options")
 	}
-	id := string(prop)
-	elem := cps.FindElement("nvpair[@id='" + id + "']")
-	if elem == nil {
-		elem = cps.CreateElement(cibTagNvPair)
-		elem.CreateAttr(cibAttrKeyID, id)
+	for _, v := range values {
+		id := string(v.prop)
 		name := id[len("cib-bootstrap-options-"):]
-		elem.CreateAttr(cibAttrKeyName, name)
-	}
+		elem := findClusterPropertyNvPair(cps, id, name)
+		if elem == nil {
+			elem = cps.CreateElement(cibTagNvPair)
+			elem.CreateAttr(cibAttrKeyID, ids.Allocate(cps.SelectAttrValue(cibAttrKeyID, ""), name))
+			elem.CreateAttr(cibAttrKeyName, name)
+		}
 
-	elem.CreateAttr(cibAttrKeyValue, value)
+		elem.CreateAttr(cibAttrKeyValue, v.value)
+	}
 
 	err = c.Update()
 	if err != nil {
@@ -264,9 +363,12 @@ func (c *CIB) getClusterProperty(prop ClusterProperty) (string, error) {
 		return "", fmt.Errorf("invalid cib state: root element not found")
 	}
 
-	xpath := fmt.Sprintf("configuration/crm_config/cluster_property_set[@id='cib-bootstrap-options']"+
-		"/nvpair[@id='%s']", prop)
-	nvpair := root.FindElement(xpath)
+	cps := root.FindElement("configuration/crm_config/cluster_property_set[@id='cib-bootstrap-options']")
+	if cps == nil {
+		return "", nil
+	}
+	id := string(prop)
+	nvpair := findClusterPropertyNvPair(cps, id, id[len("cib-bootstrap-options-"):])
 	if nvpair == nil {
 		return "", nil
 	}
@@ -274,6 +376,39 @@ func (c *CIB) getClusterProperty(prop ClusterProperty) (string, error) {
 	return nvpair.SelectAttrValue("value", ""), nil
 }
 
+// findClusterPropertyNvPair looks up a property in the cluster property set
+// by its conventional ID. If no nvpair uses that ID, for example because the
+// ID was already taken when the property was created, it falls back to
+// looking it up by name.
+func findClusterPropertyNvPair(cps *xmltree.Element, id, name string) *xmltree.Element {
+	var byName *xmltree.Element
+	for _, nvpair := range cps.SelectElements(cibTagNvPair) {
+		if nvpair.SelectAttrValue(cibAttrKeyID, "") == id {
+			return nvpair
+		}
+		if byName == nil && nvpair.SelectAttrValue(cibAttrKeyName, "") == name {
+			byName = nvpair
+		}
+	}
+	return byName
+}
+
+// clusterOption looks up a cluster option by name in all unconditional
+// cluster_property_set elements of an already read document. An empty
+// string is returned if the option is not set.
+func clusterOption(root *xmltree.Element, name string) string {
+	for _, cps := range root.FindElements("configuration/crm_config/cluster_property_set") {
+		if cps.SelectElement("rule") != nil {
+			continue
+		}
+		nvpair := cps.FindElement("nvpair[@name='" + name + "']")
+		if nvpair != nil {
+			return nvpair.SelectAttrValue(cibAttrKeyValue, "")
+		}
+	}
+	return ""
+}
+
 // GetNodeOfResource finds the node on which a resource is currently running.
 // For this, it looks at the node_state element in a hierarchy like this:
 //
@@ -297,10 +432,35 @@ func (c *CIB) getClusterProperty(prop ClusterProperty) (string, error) {
 // If the corresponding lrm_resource element is found, its run state is examined
 // (see the updateRunState function). If the run state is found to be "Running",
 // the name of the current node is returned.
+//
+// With StatusFromCrmMon, the first node crm_mon reports the resource as
+// active on is returned instead.
 func (c *CIB) GetNodeOfResource(resource string) string {
+	if c.StatusSource == StatusFromCrmMon {
+		status, err := c.ClusterStatus()
+		if err != nil {
+			log.WithField("resource", resource).Warning(err)
+			return ""
+		}
+		if nodes := status.ActiveNodes(resource); len(nodes) > 0 {
+			return nodes[0]
+		}
+		return ""
+	}
+
 	c.ReadConfiguration()
 
-	nodes := c.Doc.FindElements("/cib/status/node_state")
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return ""
+	}
+	return nodeOfResource(root, resource)
+}
+
+// nodeOfResource returns the first node a resource is running on according
+// to the status section, or "" if it is not running anywhere.
+func nodeOfResource(root *xmltree.Element, resource string) string {
+	nodes := root.FindElements("status/node_state")
 
 	for _, node := range nodes {
 		uname := node.SelectAttrValue("uname", "")
@@ -348,7 +508,18 @@ func findNode(root *xmltree.Element, nodeUname string) (*xmltree.Element, error)
 }
 
 // ListResourcesOnNode lists all resources currently running on the given node
+//
+// With StatusFromCrmMon, the resources crm_mon reports as active on the node
+// are listed instead.
 func (c *CIB) ListResourcesOnNode(node string) ([]string, error) {
+	if c.StatusSource == StatusFromCrmMon {
+		status, err := c.ClusterStatus()
+		if err != nil {
+			return nil, err
+		}
+		return status.ResourcesOnNode(node), nil
+	}
+
 	if c.Doc == nil {
 		err := c.ReadConfiguration()
 		if err != nil {
@@ -376,29 +547,15 @@ func (c *CIB) ListResourcesOnNode(node string) ([]string, error) {
 	return running, nil
 }
 
-// IsStandbyNode check if a node is currently set standby
+// IsStandbyNode check if a node is currently set standby, either permanently
+// or until the next reboot
 func (c *CIB) IsStandbyNode(nodeUname string) (bool, error) {
-	err := c.ReadConfiguration()
-	if err != nil {
-		return false, fmt.Errorf("could not read configuration: %w", err)
-	}
-
-	root := c.Doc.FindElement("/cib")
-	if root == nil {
-		return false, fmt.Errorf("invalid cib state: root element not found")
-	}
-
-	node, err := findNode(root, nodeUname)
+	value, _, err := c.GetEffectiveNodeAttribute(nodeUname, "standby")
 	if err != nil {
 		return false, err
 	}
 
-	standbyAttr, err := GetNvPairValue(node, "standby")
-	if err == nil {
-		return standbyAttr.Value == "on", nil
-	}
-
-	return false, nil
+	return isTrue(value), nil
 }
 
 // StandbyNode sets a pacemaker node into standby
@@ -425,16 +582,17 @@ func (c *CIB) StandbyNode(nodeUname string) error {
 
 	standbyAttr, err := GetNvPairValue(node, "standby")
 	if err != nil {
+		ids := NewIDAllocator(c.Doc)
 		instanceAttrElem := node.FindElement("instance_attributes")
 		if instanceAttrElem == nil {
 			instanceAttrElem = node.CreateElement("instance_attributes")
-			instanceAttrElem.CreateAttr("id", "nodes-"+nodeID.Value)
+			instanceAttrElem.CreateAttr("id", ids.Allocate("nodes", nodeID.Value))
 		}
 
 		standbyNvPair := instanceAttrElem.CreateElement("nvpair")
 		standbyNvPair.CreateAttr("name", "standby")
 		standbyNvPair.CreateAttr("value", "on")
-		standbyNvPair.CreateAttr("id", "nodes-"+nodeID.Value+"-standby")
+		standbyNvPair.CreateAttr("id", ids.Allocate(instanceAttrElem.SelectAttrValue("id", ""), "standby"))
 	} else {
 		standbyAttr.Value = "on"
 	}
@@ -473,10 +631,19 @@ func (c *CIB) UnStandbyNode(nodeUname string) error {
 	}
 	// else no standby set, we are good
 
+	transient, err := nodeAttributes(root, nodeUname, LifetimeReboot)
+	if err != nil {
+		return err
+	}
+
 	err = c.Update()
 	if err != nil {
 		return fmt.Errorf("could not update CIB: %w", err)
 	}
+
+	if _, ok := transient["standby"]; ok {
+		return c.DeleteNodeAttribute(nodeUname, "standby", LifetimeReboot)
+	}
 	return nil
 }
 
@@ -533,32 +700,65 @@ func (c *CIB) FindNodeState(uname string) (NodeState, error) {
 	return parseNodeState(elem)
 }
 
+// ListNodes lists all nodes that have a status entry, as well as remote and
+// guest nodes that have never connected to the cluster. The state of remote
+// and guest nodes reflects the state of their connection.
 func (c *CIB) ListNodes() ([]Node, error) {
 	err := c.ReadConfiguration()
 	if err != nil {
 		return nil, fmt.Errorf("could not read configuration: %w", err)
 	}
 
+	var remotes []remoteNode
+	root := c.Doc.FindElement("/cib")
+	if root != nil {
+		remotes = listRemoteNodes(root)
+	}
+	remotesByName := make(map[string]remoteNode)
+	for _, remote := range remotes {
+		remotesByName[remote.Name] = remote
+	}
+
 	var nodes []Node
+	seen := make(map[string]bool)
 	elems := c.Doc.FindElements("/cib/status/node_state")
 	for i := range elems {
 		elem := elems[i]
+		uname := elem.SelectAttrValue("uname", "")
+
+		remote, isRemote := remotesByName[uname]
+		if !isRemote && uname != "" && isTrue(elem.SelectAttrValue("remote_node", "")) {
+			remote, isRemote = remoteNode{Name: uname, Type: NodeTypeRemote}, true
+		}
+		if isRemote {
+			nodes = append(nodes, remoteNodeInfo(root, remote, elem))
+			seen[uname] = true
+			continue
+		}
+
 		state, err := parseNodeState(elem)
 		if err != nil {
 			return nil, fmt.Errorf("could not parse node state: %w", err)
 		}
 
-		uname := elem.SelectAttrValue("uname", "")
 		if uname == "" {
 			return nil, fmt.Errorf("missing uname on node element #%d", i)
 		}
 
 		nodes = append(nodes, Node{
 			HostName: uname,
+			ID:       elem.SelectAttrValue("id", ""),
+			Type:     NodeTypeCluster,
 			State:    state,
 		})
 	}
 
+	for _, remote := range remotes {
+		if !seen[remote.Name] {
+			nodes = append(nodes, remoteNodeInfo(root, remote, nil))
+		}
+	}
+
 	return nodes, nil
 }
 
@@ -576,22 +776,6 @@ func (c *CIB) modifyTargetRole(id string, startFlag bool) error {
 		return errors.New("CRM resource not found in the CIB, cannot modify role.")
 	}
 
-	var tgtRoleEntry *xmltree.Element
-	metaAttr := rscElem.FindElement(cibTagMetaAttr)
-	if metaAttr != nil {
-		// Meta attributes exist, find the entry that sets the target-role
-		tgtRoleEntry = metaAttr.FindElement(cibTagNvPair + "[@" + cibAttrKeyName + "='" + cibAttrValueTargetRole + "']")
-	} else {
-		// No meta attributes present, create XML element
-		metaAttr = rscElem.CreateElement(cibTagMetaAttr)
-		metaAttr.CreateAttr(cibAttrKeyID, id+"-meta_attributes")
-	}
-	if tgtRoleEntry == nil {
-		// No nvpair entry that sets the target-role, create entry
-		tgtRoleEntry = metaAttr.CreateElement(cibTagNvPair)
-		tgtRoleEntry.CreateAttr(cibAttrKeyID, id+"-meta_attributes-target-role")
-		tgtRoleEntry.CreateAttr(cibAttrKeyName, cibAttrValueTargetRole)
-	}
 	// Set the target-role
 	var tgtRoleValue string
 	if startFlag {
@@ -599,7 +783,7 @@ func (c *CIB) modifyTargetRole(id string, startFlag bool) error {
 	} else {
 		tgtRoleValue = cibAttrValueStopped
 	}
-	tgtRoleEntry.CreateAttr(cibAttrKeyValue, tgtRoleValue)
+	c.setTargetRole(rscElem, tgtRoleValue)
 
 	return nil
 }
@@ -623,7 +807,9 @@ func remove(s []string, r string) []string {
 // WaitForResourcesStop waits for CRM resources to stop
 //
 // It returns a flag indicating whether resources are stopped (true) or
-// not (false), and an error.
+// not (false), and an error. The CIB is checked up to maxWaitStopRetries
+// times, cibPollRetryDelay apart. WaitForResourcesStopped reports which
+// resources are still running.
 func (c *CIB) WaitForResourcesStop(idsToStop []string) (bool, error) {
 	// Read the current CIB XML
 	err := c.ReadConfiguration()
@@ -645,49 +831,36 @@ func (c *CIB) WaitForResourcesStop(idsToStop []string) (bool, error) {
 		log.Debugf("    %s", id)
 	}
 
-	isStopped := false
-	retries := 0
-	for !isStopped {
-		// check if all resources are stopped
-		allStopped := true
-		for _, item := range idsToStop {
-			state := c.FindLrmState(item)
-			if state != Stopped {
-				allStopped = false
-				break
-			}
-		}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		if allStopped {
-			// success; we stopped all resources
-			isStopped = true
-			break
+	checks := 0
+	backoff := Backoff{Initial: cibPollRetryDelay, Max: cibPollRetryDelay, Factor: 1}
+	report, err := c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		var pending []WaitItem
+		for _, id := range idsToStop {
+			if state := c.FindLrmState(id); state != Stopped {
+				pending = append(pending, WaitItem{ID: id, Expected: string(Stopped), Actual: string(state)})
+			}
 		}
-
-		if retries > maxWaitStopRetries {
+		checks++
+		if len(pending) > 0 && checks > maxWaitStopRetries+1 {
 			// timeout
-			isStopped = false
-			break
+			cancel()
 		}
-
-		time.Sleep(cibPollRetryDelay)
-
-		// Re-read the current CIB XML
-		err = c.ReadConfiguration()
-		if err != nil {
-			return false, err
-		}
-
-		retries++
+		return pending, nil
+	}, backoff)
+	if err != nil && ctx.Err() == nil {
+		return false, err
 	}
 
-	if isStopped {
+	if report.Converged {
 		log.Debug("The resources are stopped")
 	} else {
 		log.Warning("Could not confirm that the resources are stopped")
 	}
 
-	return isStopped, nil
+	return report.Converged, nil
 }
 
 func GetNvPairValue(elem *xmltree.Element, name string) (*xmltree.Attr, error) {
@@ -757,116 +930,201 @@ func copyMap(srcMap map[string]string) map[string]string {
 	return resultMap
 }
 
-// Removes CRM constraints that refer to the specified delItems names from the CIB XML document tree
-func (c *CIB) DissolveConstraints(delItems []string) {
-	// TODO: I think it's possible to to "XPath injection" here. Since
-	// delItems is user controlled, inserting a ' or something could
-	// potentially make the program panic. But let's worry about this
-	// another day...
-
-	xpaths := []string{
-		// colocation references (if we had a better xpath library we could do this at once...)
-		`configuration/constraints/rsc_colocation[@rsc='%s']`,
-		`configuration/constraints/rsc_colocation[@with-rsc='%s']`,
-		// colocation constraints with resource sets
-		`configuration/constraints/rsc_colocation/resource_set/resource_ref[@id='%s']/../../`,
-		// order references
-		`configuration/constraints/rsc_order[@first='%s']`,
-		`configuration/constraints/rsc_order[@then='%s']`,
-		// order constraints with resource sets
-		`configuration/constraints/rsc_order/resource_set/resource_ref[@id='%s']/../../`,
-		// rsc_location -> resource_ref references
-		`configuration/constraints/rsc_location/resource_set/resource_ref[@id='%s']/../..`,
-		// rsc_location with direct rsc
-		`configuration/constraints/rsc_location[@rsc='%s']`,
-		// lrm status references
-		`status/node_state/lrm/lrm_resources/lrm_resource[@id='%s']`,
+// ConstraintChangeAction describes how DissolveConstraints changed an element.
+type ConstraintChangeAction string
+
+const (
+	// ChangeRemovedReference means that a resource_ref was removed from a resource set
+	ChangeRemovedReference ConstraintChangeAction = "removed-reference"
+	// ChangeRemovedSet means that a resource set was removed because it became empty
+	ChangeRemovedSet ConstraintChangeAction = "removed-set"
+	// ChangeDeleted means that a whole element was deleted
+	ChangeDeleted ConstraintChangeAction = "deleted"
+	// ChangeRemovedRule means that a rule was removed from a constraint
+	ChangeRemovedRule ConstraintChangeAction = "removed-rule"
+	// ChangeRemovedExpression means that an expression was removed from a rule
+	ChangeRemovedExpression ConstraintChangeAction = "removed-expression"
+)
+
+// ConstraintChange is a single modification of the CIB XML document tree
+// made by DissolveConstraints.
+type ConstraintChange struct {
+	Action ConstraintChangeAction
+	// Tag and ID identify the element that was changed or deleted
+	Tag string
+	ID  string
+	// Constraint is the ID of the constraint containing the element, if any
+	Constraint string
+	// Reference is the name whose removal caused the change
+	Reference string
+}
+
+// DissolveConstraints removes references to the specified delItems names
+// from the constraints in the CIB XML document tree, as well as their lrm
+// status entries.
+//
+// Constraints that refer to a resource directly (e.g. rsc="..." or
+// first="...") are deleted. Within resource sets, only the matching
+// resource_ref is removed. A set is removed once it is empty, and a
+// constraint is deleted once its remaining sets no longer express a
+// relationship, for example a colocation that is left with a single member.
+//
+// The returned list describes every change that was made, in order.
+func (c *CIB) DissolveConstraints(delItems []string) []ConstraintChange {
+	if c.Doc == nil || c.Doc.Root() == nil {
+		return nil
+	}
+	root := c.Doc.Root()
+
+	var changes []ConstraintChange
+	record := func(change ConstraintChange) {
+		log.WithFields(log.Fields{
+			"action":     change.Action,
+			"type":       change.Tag,
+			"id":         change.ID,
+			"constraint": change.Constraint,
+		}).Debug("Dissolving dependency")
+		changes = append(changes, change)
 	}
 
 	for _, resourceName := range delItems {
-		for _, xpathFormat := range xpaths {
-			xpath := fmt.Sprintf(xpathFormat, resourceName)
-			elems := c.Doc.Root().FindElements(xpath)
-			for _, elem := range elems {
-				parent := elem.Parent()
-				if parent == nil {
-					continue
+		for _, elem := range root.FindElements("configuration/constraints/*") {
+			var directAttrs []string
+			switch elem.Tag {
+			case cibTagLocation:
+				directAttrs = []string{"rsc"}
+			case cibTagColocation:
+				directAttrs = []string{"rsc", "with-rsc"}
+			case cibTagOrder:
+				directAttrs = []string{"first", "then"}
+			default:
+				continue
+			}
+
+			id := elem.SelectAttrValue(cibAttrKeyID, "")
+			deleteConstraint := func() {
+				elem.Parent().RemoveChild(elem)
+				record(ConstraintChange{
+					Action:     ChangeDeleted,
+					Tag:        elem.Tag,
+					ID:         id,
+					Constraint: id,
+					Reference:  resourceName,
+				})
+			}
+
+			direct := false
+			for _, attr := range directAttrs {
+				if elem.SelectAttrValue(attr, "") == resourceName {
+					direct = true
+				}
+			}
+			if direct {
+				deleteConstraint()
+				continue
+			}
+
+			sets := elem.SelectElements("resource_set")
+			if len(sets) == 0 {
+				continue
+			}
+
+			changed := false
+			for _, set := range sets {
+				for _, ref := range set.SelectElements(cibTagRscRef) {
+					if ref.SelectAttrValue(cibAttrKeyID, "") != resourceName {
+						continue
+					}
+					set.RemoveChild(ref)
+					changed = true
+					record(ConstraintChange{
+						Action:     ChangeRemovedReference,
+						Tag:        cibTagRscRef,
+						ID:         resourceName,
+						Constraint: id,
+						Reference:  resourceName,
+					})
 				}
-				parent.RemoveChild(elem)
-
-				idAttr := elem.SelectAttr("id")
-				if idAttr != nil {
-					log.WithFields(log.Fields{
-						"type": elem.Tag,
-						"id":   idAttr.Value,
-					}).Debug("Deleting dependency")
+
+				if len(set.SelectElements(cibTagRscRef)) == 0 {
+					elem.RemoveChild(set)
+					changed = true
+					record(ConstraintChange{
+						Action:     ChangeRemovedSet,
+						Tag:        set.Tag,
+						ID:         set.SelectAttrValue(cibAttrKeyID, ""),
+						Constraint: id,
+						Reference:  resourceName,
+					})
 				}
 			}
-		}
-	}
-}
 
-// updateRunState updates the run state information of a single resource
-//
-// For a resource to be considered stopped, this function must find
-// - either a successful stop action
-// - or a monitor action with rc-code ocfNotRunning and no stop action
-//
-// If a stop action is present, the monitor action can still show "running"
-// (rc-code ocfSuccess == 0) although the resource is actually stopped. The
-// monitor action's rc-code is only interesting if there is no stop action present.
-func updateRunState(rscName string, lrmRsc *xmltree.Element, runState LrmRunState) LrmRunState {
-	contextLog := log.WithFields(log.Fields{"resource": rscName})
-	newRunState := runState
-	stopEntry := lrmRsc.FindElement(cibTagLrmRscOp + "[@" + cibAttrKeyOperation + "='" + cibAttrValueStop + "']")
-	if stopEntry != nil {
-		rc, err := getLrmRcCode(stopEntry)
-		if err != nil {
-			contextLog.Warning(err)
-		} else if rc == ocfSuccess {
-			if newRunState == Unknown {
-				newRunState = Stopped
+			if changed && !setConstraintMeaningful(elem) {
+				deleteConstraint()
 			}
-		} else {
-			newRunState = Running
 		}
 
-		return newRunState
-	}
-
-	monEntry := lrmRsc.FindElement(cibTagLrmRscOp + "[@" + cibAttrKeyOperation + "='" + cibAttrValueMonitor + "']")
-	if monEntry != nil {
-		rc, err := getLrmRcCode(monEntry)
-		if err != nil {
-			contextLog.Warning(err)
-		} else if rc == ocfNotRunning {
-			if newRunState == Unknown {
-				newRunState = Stopped
+		for _, elem := range root.FindElements("status/node_state/lrm/lrm_resources/lrm_resource") {
+			if elem.SelectAttrValue(cibAttrKeyID, "") != resourceName {
+				continue
 			}
-		} else {
-			newRunState = Running
+			elem.Parent().RemoveChild(elem)
+			record(ConstraintChange{
+				Action:    ChangeDeleted,
+				Tag:       elem.Tag,
+				ID:        resourceName,
+				Reference: resourceName,
+			})
 		}
+	}
+
+	return changes
+}
 
-		return newRunState
+// setConstraintMeaningful checks whether the resource sets of a constraint
+// still describe a relationship. A location constraint needs at least one
+// set. Colocation and order constraints need either two sets, or a single
+// sequential set with at least two members.
+func setConstraintMeaningful(elem *xmltree.Element) bool {
+	sets := elem.SelectElements("resource_set")
+	if elem.Tag == cibTagLocation {
+		return len(sets) > 0
 	}
 
-	startEntry := lrmRsc.FindElement(cibTagLrmRscOp + "[@" + cibAttrKeyOperation + "='" + cibAttrValueStart + "']")
-	if startEntry != nil {
-		rc, err := getLrmRcCode(startEntry)
-		if err != nil {
-			contextLog.Warning(err)
-		} else if rc == ocfRunningMaster || rc == ocfSuccess {
-			if newRunState == Unknown {
-				newRunState = Running
-			}
-		} else {
-			newRunState = Stopped
-		}
+	if len(sets) >= 2 {
+		return true
+	}
+	if len(sets) == 1 {
+		sequential := sets[0].SelectAttrValue("sequential", "true") != "false"
+		return sequential && len(sets[0].SelectElements(cibTagRscRef)) >= 2
+	}
+	return false
+}
 
-		return newRunState
+// updateRunState updates the run state information of a single resource
+//
+// The state of the resource on the node is determined by replaying the
+// operations of the <lrm_resource> element in call ID order (see
+// replayRunState) and reduced to Running, Stopped or Unknown. The run state
+// collected from other nodes is only overridden if the resource is running
+// on this node, or if it is stopped here and its state was unknown so far.
+func updateRunState(rscName string, lrmRsc *xmltree.Element, runState LrmRunState) LrmRunState {
+	ops, err := parseLrmResource("", lrmRsc)
+	if err != nil {
+		log.WithFields(log.Fields{"resource": rscName}).Warning(err)
+		return runState
 	}
 
-	return newRunState
+	// the legacy states do not distinguish the roles of promotable resources
+	switch legacyRunState(replayRunState(rscName, ops, false)) {
+	case Running:
+		return Running
+	case Stopped:
+		if runState == Unknown {
+			return Stopped
+		}
+	}
+	return runState
 }
 
 // getLrmRcCode extracts the rc-code value from an LRM operation entry
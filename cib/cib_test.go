@@ -20,10 +20,19 @@ type testCommand struct {
 	hook commandHook
 }
 
-func (c *testCommand) execute(stdin string) (string, string, error) {
+func (c *testCommand) execute(stdin string, args ...string) (string, string, error) {
 	return c.hook(stdin)
 }
 
+// argsCommand is a test command whose hook also receives the arguments.
+type argsCommand struct {
+	hook func(stdin string, args []string) (string, string, error)
+}
+
+func (c *argsCommand) execute(stdin string, args ...string) (string, string, error) {
+	return c.hook(stdin, args)
+}
+
 func normalizeXML(t *testing.T, xml string) string {
 	n := xmltest.Normalizer{OmitWhitespace: true}
 	var buf bytes.Buffer
@@ -174,6 +183,15 @@ func TestDissolveConstraints(t *testing.T) {
 		desc:      "remove target",
 		resources: []string{"p_iscsi_example"},
 		expect: `<cib><configuration><constraints>
+<rsc_location id="lo_iscsi_example" resource-discovery="never">
+	<resource_set id="lo_iscsi_example-0">
+		<resource_ref id="p_iscsi_example_lu1"/>
+	</resource_set>
+	<rule score="-INFINITY" id="lo_iscsi_example-rule">
+		<expression attribute="#uname" operation="ne" value="li0" id="lo_iscsi_example-rule-expression-0"/>
+		<expression attribute="#uname" operation="ne" value="li1" id="lo_iscsi_example-rule-expression-1"/>
+	</rule>
+</rsc_location>
 <rsc_colocation id="co_pblock_example" score="INFINITY" rsc="p_pblock_example" with-rsc="p_iscsi_example_ip"/>
 <rsc_colocation id="co_punblock_example" score="INFINITY" rsc="p_punblock_example" with-rsc="p_iscsi_example_ip"/>
 <rsc_location id="lo_iscsi_example_lu1" rsc="p_iscsi_example_lu1" resource-discovery="never">
@@ -252,6 +270,86 @@ func TestDissolveConstraints(t *testing.T) {
 	}
 }
 
+func TestDissolveConstraintsResourceSets(t *testing.T) {
+	xml := `<cib><configuration><constraints>
+<rsc_colocation id="co_set" score="INFINITY">
+	<resource_set id="co_set-0">
+		<resource_ref id="p_a"/>
+		<resource_ref id="p_b"/>
+	</resource_set>
+</rsc_colocation>
+<rsc_order id="o_set" score="INFINITY">
+	<resource_set id="o_set-0">
+		<resource_ref id="p_a"/>
+		<resource_ref id="p_b"/>
+		<resource_ref id="p_c"/>
+	</resource_set>
+</rsc_order>
+<rsc_order id="o_sets" score="INFINITY">
+	<resource_set id="o_sets-0" sequential="false">
+		<resource_ref id="p_b"/>
+	</resource_set>
+	<resource_set id="o_sets-1">
+		<resource_ref id="p_c"/>
+	</resource_set>
+</rsc_order>
+</constraints></configuration></cib>`
+
+	expect := `<cib><configuration><constraints>
+<rsc_order id="o_set" score="INFINITY">
+	<resource_set id="o_set-0">
+		<resource_ref id="p_a"/>
+		<resource_ref id="p_c"/>
+	</resource_set>
+</rsc_order>
+</constraints></configuration></cib>`
+
+	expectChanges := []ConstraintChange{{
+		Action: ChangeRemovedReference, Tag: "resource_ref", ID: "p_b", Constraint: "co_set", Reference: "p_b",
+	}, {
+		Action: ChangeDeleted, Tag: "rsc_colocation", ID: "co_set", Constraint: "co_set", Reference: "p_b",
+	}, {
+		Action: ChangeRemovedReference, Tag: "resource_ref", ID: "p_b", Constraint: "o_set", Reference: "p_b",
+	}, {
+		Action: ChangeRemovedReference, Tag: "resource_ref", ID: "p_b", Constraint: "o_sets", Reference: "p_b",
+	}, {
+		Action: ChangeRemovedSet, Tag: "resource_set", ID: "o_sets-0", Constraint: "o_sets", Reference: "p_b",
+	}, {
+		Action: ChangeDeleted, Tag: "rsc_order", ID: "o_sets", Constraint: "o_sets", Reference: "p_b",
+	}}
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.ReadConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := cib.DissolveConstraints([]string{"p_b"})
+	if !cmp.Equal(changes, expectChanges) {
+		t.Errorf("Unexpected changes")
+		t.Errorf("Expected: %+v", expectChanges)
+		t.Errorf("Actual: %+v", changes)
+	}
+
+	actual, err := cib.Doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	normExpect := normalizeXML(t, expect)
+	normActual := normalizeXML(t, actual)
+	if normActual != normExpect {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", normExpect)
+		t.Errorf("Actual: %s", normActual)
+	}
+}
+
 func TestFindLrmState(t *testing.T) {
 	xml := `<cib><status>
 	<node_state><lrm id="171"><lrm_resources>
@@ -700,6 +798,30 @@ func TestNodeStandby(t *testing.T) {
 			<node id="3" uname="la2"/>
 			<node id="2" uname="la3"/>
 		</nodes></configuration></cib>`,
+	}, {
+		desc: "set standby la1 with colliding IDs",
+		input: `<cib><configuration>
+		<nodes>
+			<node id="1" uname="la1"/>
+		</nodes>
+		<resources>
+			<primitive id="nodes-1" class="ocf" provider="heartbeat" type="Dummy">
+				<meta_attributes id="nodes-1-1-standby"/>
+			</primitive>
+		</resources></configuration></cib>`,
+		expect: `<cib><configuration>
+		<nodes>
+			<node id="1" uname="la1">
+				<instance_attributes id="nodes-1-1">
+					<nvpair id="nodes-1-1-standby-1" name="standby" value="on"/>
+				</instance_attributes>
+			</node>
+		</nodes>
+		<resources>
+			<primitive id="nodes-1" class="ocf" provider="heartbeat" type="Dummy">
+				<meta_attributes id="nodes-1-1-standby"/>
+			</primitive>
+		</resources></configuration></cib>`,
 	}}
 
 	for _, c := range cases {
@@ -1038,6 +1160,7 @@ func TestListNodes(t *testing.T) {
 		</status></cib>`,
 		expect: []Node{{
 			HostName: "node1",
+			Type:     NodeTypeCluster,
 			State: NodeState{
 				InCCM:        true,
 				Crmd:         true,
@@ -1056,20 +1179,71 @@ func TestListNodes(t *testing.T) {
 		</status></cib>`,
 		expect: []Node{{
 			HostName: "node1",
+			Type:     NodeTypeCluster,
 			State:    NodeState{InCCM: true, Crmd: true, Join: JoinMember, JoinExpected: JoinDown},
 		}, {
 			HostName: "node2",
+			Type:     NodeTypeCluster,
 			State:    NodeState{InCCM: true, Crmd: true, Join: JoinDown, JoinExpected: JoinMember},
 		}, {
 			HostName: "node3",
+			Type:     NodeTypeCluster,
 			State:    NodeState{InCCM: true, Crmd: false, Join: JoinMember, JoinExpected: JoinMember},
 		}, {
 			HostName: "node4",
+			Type:     NodeTypeCluster,
 			State:    NodeState{InCCM: false, Crmd: true, Join: JoinMember, JoinExpected: JoinMember},
 		}, {
 			HostName: "node5",
+			Type:     NodeTypeCluster,
 			State:    NodeState{InCCM: false, Crmd: false, Join: JoinPending, JoinExpected: JoinBanned},
 		}},
+	}, {
+		desc: "remote and guest nodes",
+		xml: `<cib><configuration><resources>
+			<primitive id="remote1" class="ocf" provider="pacemaker" type="remote"/>
+			<primitive id="remote2" class="ocf" provider="pacemaker" type="remote"/>
+			<primitive id="vm1" class="ocf" provider="heartbeat" type="VirtualDomain">
+				<meta_attributes id="vm1-meta_attributes">
+					<nvpair id="vm1-meta_attributes-remote-node" name="remote-node" value="guest1"/>
+				</meta_attributes>
+			</primitive>
+		</resources></configuration>
+		<status>
+			<node_state id="1" uname="node1" in_ccm="true" crmd="online" join="member" expected="member">
+				<lrm><lrm_resources>
+					<lrm_resource id="remote1"><lrm_rsc_op operation="start" rc-code="0"/></lrm_resource>
+					<lrm_resource id="vm1"><lrm_rsc_op operation="stop" rc-code="0"/></lrm_resource>
+				</lrm_resources></lrm>
+			</node_state>
+			<node_state id="remote1" uname="remote1" remote_node="true" in_ccm="true"/>
+			<node_state id="guest1" uname="guest1" remote_node="true" in_ccm="false"/>
+		</status></cib>`,
+		expect: []Node{{
+			HostName: "node1",
+			ID:       "1",
+			Type:     NodeTypeCluster,
+			State:    NodeState{InCCM: true, Crmd: true, Join: JoinMember, JoinExpected: JoinMember},
+		}, {
+			HostName:       "remote1",
+			ID:             "remote1",
+			Type:           NodeTypeRemote,
+			State:          NodeState{InCCM: true, Crmd: true, Join: JoinMember, JoinExpected: JoinMember},
+			Connection:     "remote1",
+			ConnectionHost: "node1",
+		}, {
+			HostName:   "guest1",
+			ID:         "guest1",
+			Type:       NodeTypeGuest,
+			State:      NodeState{Join: JoinDown, JoinExpected: JoinDown},
+			Connection: "vm1",
+		}, {
+			HostName:   "remote2",
+			ID:         "remote2",
+			Type:       NodeTypeRemote,
+			State:      NodeState{Join: JoinDown, JoinExpected: JoinDown},
+			Connection: "remote2",
+		}},
 	}, {
 		desc: "no uname",
 		xml: `<cib><status>
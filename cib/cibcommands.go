@@ -3,7 +3,9 @@ package cib
 // CRM (Pacemaker) commands
 
 type command interface {
-	execute(stdin string) (string, string, error)
+	// execute runs the command. The arguments are appended to the
+	// command's fixed arguments.
+	execute(stdin string, args ...string) (string, string, error)
 }
 
 type crmCommand struct {
@@ -11,12 +13,21 @@ type crmCommand struct {
 	arguments  []string
 }
 
-func (c *crmCommand) execute(stdin string) (string, string, error) {
-	return execute(stdin, c.executable, c.arguments...)
+func (c *crmCommand) execute(stdin string, args ...string) (string, string, error) {
+	arguments := make([]string, 0, len(c.arguments)+len(args))
+	arguments = append(arguments, c.arguments...)
+	arguments = append(arguments, args...)
+	return execute(stdin, c.executable, arguments...)
 }
 
 const (
-	crmUtility = "cibadmin"
+	crmUtility       = "cibadmin"
+	attributeUtility = "crm_attribute"
+	nodeUtility      = "crm_node"
+	stonithUtility   = "stonith_admin"
+	resourceUtility  = "crm_resource"
+	monUtility       = "crm_mon"
+	simulateUtility  = "crm_simulate"
 )
 
 var (
@@ -30,4 +41,28 @@ var (
 
 	// ListCommand is the command for reading the CIB
 	listCommand command = &crmCommand{crmUtility, []string{"--query"}}
+
+	// attributeCommand is the command for changing transient node
+	// attributes, which are managed by the attribute daemon.
+	attributeCommand command = &crmCommand{attributeUtility, []string{"--lifetime", "reboot"}}
+
+	// nodeRemoveCommand is the command for removing a node from the
+	// cluster's membership caches and the CIB.
+	nodeRemoveCommand command = &crmCommand{nodeUtility, []string{"--force", "--remove"}}
+
+	// stonithCommand is the command for fencing nodes and querying the
+	// fence history.
+	stonithCommand command = &crmCommand{stonithUtility, nil}
+
+	// resourceCommand is the command for cleaning up and refreshing the
+	// status of resources.
+	resourceCommand command = &crmCommand{resourceUtility, nil}
+
+	// monCommand is the command for reading the cluster status as
+	// Pacemaker interprets it.
+	monCommand command = &crmCommand{monUtility, []string{"--one-shot", "--inactive", "--output-as=xml"}}
+
+	// simulateCommand is the command for running the scheduler on the live
+	// CIB or on a CIB passed on stdin.
+	simulateCommand command = &crmCommand{simulateUtility, nil}
 )
@@ -0,0 +1,159 @@
+package cib
+
+import (
+	xmltree "github.com/beevik/etree"
+)
+
+// ResourceSet is a <resource_set> inside a constraint.
+type ResourceSet struct {
+	ID         string
+	Sequential bool
+	RequireAll bool
+	Role       string
+	Action     string
+	Score      string
+	Resources  []string
+}
+
+// LocationConstraint is an rsc_location constraint. Either Rsc, RscPattern
+// or Sets identifies the affected resources.
+type LocationConstraint struct {
+	ID                string
+	Rsc               string
+	RscPattern        string
+	Node              string
+	Score             string
+	Role              string
+	ResourceDiscovery string
+	Sets              []ResourceSet
+	Rules             []Rule
+}
+
+// ColocationConstraint is an rsc_colocation constraint. Rsc is placed
+// relative to WithRsc, unless the constraint uses resource sets.
+type ColocationConstraint struct {
+	ID          string
+	Score       string
+	Rsc         string
+	WithRsc     string
+	RscRole     string
+	WithRscRole string
+	Sets        []ResourceSet
+}
+
+// OrderConstraint is an rsc_order constraint. First is started before Then,
+// unless the constraint uses resource sets.
+type OrderConstraint struct {
+	ID          string
+	First       string
+	Then        string
+	FirstAction string
+	ThenAction  string
+	Kind        string
+	Score       string
+	Symmetrical bool
+	Sets        []ResourceSet
+}
+
+// Constraints contains all constraints of the CIB, in document order.
+type Constraints struct {
+	Locations   []LocationConstraint
+	Colocations []ColocationConstraint
+	Orders      []OrderConstraint
+}
+
+// ListConstraints parses the location, colocation and order constraints from
+// the configuration/constraints section of the CIB.
+func (c *CIB) ListConstraints() (Constraints, error) {
+	root, err := c.root()
+	if err != nil {
+		return Constraints{}, err
+	}
+
+	var cons Constraints
+	for _, elem := range root.FindElements("configuration/constraints/*") {
+		switch elem.Tag {
+		case cibTagLocation:
+			cons.Locations = append(cons.Locations, LocationConstraint{
+				ID:                elem.SelectAttrValue(cibAttrKeyID, ""),
+				Rsc:               elem.SelectAttrValue("rsc", ""),
+				RscPattern:        elem.SelectAttrValue("rsc-pattern", ""),
+				Node:              elem.SelectAttrValue("node", ""),
+				Score:             elem.SelectAttrValue("score", ""),
+				Role:              elem.SelectAttrValue("role", ""),
+				ResourceDiscovery: elem.SelectAttrValue("resource-discovery", ""),
+				Sets:              parseResourceSets(elem),
+				Rules:             parseRules(elem),
+			})
+		case cibTagColocation:
+			cons.Colocations = append(cons.Colocations, ColocationConstraint{
+				ID:          elem.SelectAttrValue(cibAttrKeyID, ""),
+				Score:       elem.SelectAttrValue("score", ""),
+				Rsc:         elem.SelectAttrValue("rsc", ""),
+				WithRsc:     elem.SelectAttrValue("with-rsc", ""),
+				RscRole:     elem.SelectAttrValue("rsc-role", ""),
+				WithRscRole: elem.SelectAttrValue("with-rsc-role", ""),
+				Sets:        parseResourceSets(elem),
+			})
+		case cibTagOrder:
+			cons.Orders = append(cons.Orders, OrderConstraint{
+				ID:          elem.SelectAttrValue(cibAttrKeyID, ""),
+				First:       elem.SelectAttrValue("first", ""),
+				Then:        elem.SelectAttrValue("then", ""),
+				FirstAction: elem.SelectAttrValue("first-action", ""),
+				ThenAction:  elem.SelectAttrValue("then-action", ""),
+				Kind:        elem.SelectAttrValue("kind", ""),
+				Score:       elem.SelectAttrValue("score", ""),
+				Symmetrical: elem.SelectAttrValue("symmetrical", "true") != "false",
+				Sets:        parseResourceSets(elem),
+			})
+		}
+	}
+
+	return cons, nil
+}
+
+func parseResourceSets(elem *xmltree.Element) []ResourceSet {
+	var sets []ResourceSet
+	for _, setElem := range elem.SelectElements("resource_set") {
+		set := ResourceSet{
+			ID:         setElem.SelectAttrValue(cibAttrKeyID, ""),
+			Sequential: setElem.SelectAttrValue("sequential", "true") != "false",
+			RequireAll: setElem.SelectAttrValue("require-all", "true") != "false",
+			Role:       setElem.SelectAttrValue("role", ""),
+			Action:     setElem.SelectAttrValue("action", ""),
+			Score:      setElem.SelectAttrValue("score", ""),
+		}
+		for _, ref := range setElem.SelectElements(cibTagRscRef) {
+			set.Resources = append(set.Resources, ref.SelectAttrValue(cibAttrKeyID, ""))
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+func parseRules(elem *xmltree.Element) []Rule {
+	var rules []Rule
+	for _, ruleElem := range elem.SelectElements("rule") {
+		rules = append(rules, parseRule(ruleElem))
+	}
+	return rules
+}
+
+// orderScore returns the effective score of an order constraint. An explicit
+// score takes precedence over the kind attribute; without either, the order
+// is mandatory.
+func (o OrderConstraint) orderScore() Score {
+	if o.Score != "" {
+		score, err := ParseScore(o.Score)
+		if err == nil {
+			return score
+		}
+	}
+
+	switch o.Kind {
+	case "Optional", "Serialize":
+		return 0
+	}
+	return ScoreInfinity
+}
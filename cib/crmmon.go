@@ -0,0 +1,356 @@
+package cib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// StatusSource selects where status queries take their information from.
+type StatusSource string
+
+const (
+	// StatusFromCIB derives the status from the status section of the CIB.
+	// This is the default.
+	StatusFromCIB StatusSource = ""
+	// StatusFromCrmMon takes the status from the XML output of crm_mon,
+	// which reflects Pacemaker's own interpretation of the status section.
+	StatusFromCrmMon StatusSource = "crm_mon"
+)
+
+// ClusterStatus is the cluster status as reported by crm_mon.
+type ClusterStatus struct {
+	Summary StatusSummary
+	Nodes   []StatusNode
+	// Resources lists all primitives, with one entry per clone instance or
+	// bundle replica
+	Resources []StatusResource
+	// NodeAttributes maps node names to the node attributes crm_mon shows
+	NodeAttributes map[string]map[string]string
+	Failures       []StatusFailure
+	FenceHistory   []FenceEvent
+	Tickets        []Ticket
+}
+
+// StatusSummary is the summary section of crm_mon.
+type StatusSummary struct {
+	Stack string
+	// DC is the name of the designated controller, DCID its node ID and
+	// DCVersion its Pacemaker version. They are empty if there is no DC.
+	DC         string
+	DCID       string
+	DCVersion  string
+	HaveQuorum bool
+
+	LastUpdate       string
+	LastChange       string
+	LastChangeUser   string
+	LastChangeClient string
+	LastChangeOrigin string
+
+	NodesConfigured     int
+	ResourcesConfigured int
+	ResourcesDisabled   int
+	ResourcesBlocked    int
+
+	// Options contains the cluster options crm_mon reports, e.g.
+	// stonith-enabled
+	Options map[string]string
+}
+
+// StatusNode is a node as reported by crm_mon.
+type StatusNode struct {
+	Name string
+	ID   string
+	// Type is "member" for cluster nodes, "remote" or "ping"
+	Type             string
+	Online           bool
+	Standby          bool
+	StandbyOnFail    bool
+	Maintenance      bool
+	Pending          bool
+	Unclean          bool
+	Shutdown         bool
+	ExpectedUp       bool
+	IsDC             bool
+	ResourcesRunning int
+}
+
+// StatusResource is a primitive, or an instance of a cloned primitive, as
+// reported by crm_mon.
+type StatusResource struct {
+	ID string
+	// Agent is the resource agent, e.g. "ocf::heartbeat:IPaddr2"
+	Agent string
+	// Role is the role Pacemaker considers the resource to be in, e.g.
+	// "Started", "Stopped" or "Promoted" ("Master" before Pacemaker 2.1)
+	Role string
+	// Parent is the ID of the group, clone or bundle containing the
+	// resource, or empty for top level primitives
+	Parent         string
+	Active         bool
+	Orphaned       bool
+	Blocked        bool
+	Managed        bool
+	Failed         bool
+	FailureIgnored bool
+	// Nodes lists the nodes the resource is active on
+	Nodes []string
+}
+
+// StatusFailure is a failed action as reported by crm_mon.
+type StatusFailure struct {
+	// OpKey is the operation key, e.g. "p_web_start_0"
+	OpKey      string
+	Node       string
+	Task       string
+	Interval   time.Duration
+	ExitStatus string
+	ExitReason string
+	ExitCode   int
+	CallID     int
+	Status     string
+	// LastRcChange is the time of the failure, as formatted by crm_mon
+	LastRcChange string
+}
+
+// Ticket is a ticket for multi-site clusters.
+type Ticket struct {
+	ID          string
+	Granted     bool
+	Standby     bool
+	LastGranted string
+}
+
+// ClusterStatus runs crm_mon and parses its XML output.
+func (c *CIB) ClusterStatus() (ClusterStatus, error) {
+	stdout, stderr, err := monCommand.execute("")
+	if err != nil {
+		return ClusterStatus{}, fmt.Errorf("could not run crm_mon: %w: %s", err, strings.TrimSpace(stderr))
+	}
+
+	return ParseClusterStatus(stdout)
+}
+
+// ParseClusterStatus parses the XML output of crm_mon. Both the output of
+// --output-as=xml (<pacemaker-result>) and of the older --as-xml
+// (<crm_mon>) are understood.
+func ParseClusterStatus(data string) (ClusterStatus, error) {
+	doc := xmltree.NewDocument()
+	err := doc.ReadFromString(data)
+	if err != nil {
+		return ClusterStatus{}, fmt.Errorf("could not parse crm_mon output: %w", err)
+	}
+
+	root := doc.Root()
+	if root == nil || (root.Tag != "pacemaker-result" && root.Tag != "crm_mon") {
+		return ClusterStatus{}, fmt.Errorf("could not parse crm_mon output: unexpected root element")
+	}
+
+	if status := root.SelectElement("status"); status != nil {
+		if code := status.SelectAttrValue("code", "0"); code != "0" {
+			return ClusterStatus{}, fmt.Errorf("crm_mon failed with code %s: %s", code, status.SelectAttrValue("message", ""))
+		}
+	}
+
+	status := ClusterStatus{NodeAttributes: make(map[string]map[string]string)}
+
+	if summary := root.SelectElement("summary"); summary != nil {
+		status.Summary = parseStatusSummary(summary)
+	}
+
+	for _, elem := range root.FindElements("nodes/node") {
+		status.Nodes = append(status.Nodes, parseStatusNode(elem))
+	}
+
+	if resources := root.SelectElement("resources"); resources != nil {
+		collectStatusResources(resources, "", &status.Resources)
+	}
+
+	for _, node := range root.FindElements("node_attributes/node") {
+		attrs := make(map[string]string)
+		for _, attr := range node.SelectElements("attribute") {
+			attrs[attr.SelectAttrValue("name", "")] = attr.SelectAttrValue("value", "")
+		}
+		status.NodeAttributes[node.SelectAttrValue("name", "")] = attrs
+	}
+
+	for _, elem := range root.FindElements("failures/failure") {
+		failure, err := parseStatusFailure(elem)
+		if err != nil {
+			return ClusterStatus{}, err
+		}
+		status.Failures = append(status.Failures, failure)
+	}
+
+	for _, elem := range root.FindElements("fence_history/fence_event") {
+		status.FenceHistory = append(status.FenceHistory, parseFenceEvent(elem))
+	}
+
+	for _, elem := range root.FindElements("tickets/ticket") {
+		status.Tickets = append(status.Tickets, Ticket{
+			ID:          elem.SelectAttrValue(cibAttrKeyID, ""),
+			Granted:     elem.SelectAttrValue("status", "") == "granted",
+			Standby:     isTrue(elem.SelectAttrValue("standby", "")),
+			LastGranted: elem.SelectAttrValue("last-granted", ""),
+		})
+	}
+
+	return status, nil
+}
+
+// ActiveNodes returns the nodes a resource is active on. For clones, the
+// ID of the clone's primitive returns the nodes of all its instances.
+func (s ClusterStatus) ActiveNodes(id string) []string {
+	var nodes []string
+	for _, rsc := range s.Resources {
+		if rsc.ID != id || !rsc.Active {
+			continue
+		}
+		for _, node := range rsc.Nodes {
+			if !contains(nodes, node) {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
+// ResourcesOnNode returns the IDs of the resources active on a node, in the
+// order crm_mon lists them.
+func (s ClusterStatus) ResourcesOnNode(node string) []string {
+	var ids []string
+	for _, rsc := range s.Resources {
+		if rsc.Active && contains(rsc.Nodes, node) && !contains(ids, rsc.ID) {
+			ids = append(ids, rsc.ID)
+		}
+	}
+	return ids
+}
+
+func parseStatusSummary(elem *xmltree.Element) StatusSummary {
+	summary := StatusSummary{Options: make(map[string]string)}
+
+	if stack := elem.SelectElement("stack"); stack != nil {
+		summary.Stack = stack.SelectAttrValue("type", "")
+	}
+	if dc := elem.SelectElement("current_dc"); dc != nil {
+		if isTrue(dc.SelectAttrValue("present", "")) {
+			summary.DC = dc.SelectAttrValue("name", "")
+			summary.DCID = dc.SelectAttrValue(cibAttrKeyID, "")
+			summary.DCVersion = dc.SelectAttrValue("version", "")
+		}
+		summary.HaveQuorum = isTrue(dc.SelectAttrValue("with_quorum", ""))
+	}
+	if update := elem.SelectElement("last_update"); update != nil {
+		summary.LastUpdate = update.SelectAttrValue("time", "")
+	}
+	if change := elem.SelectElement("last_change"); change != nil {
+		summary.LastChange = change.SelectAttrValue("time", "")
+		summary.LastChangeUser = change.SelectAttrValue("user", "")
+		summary.LastChangeClient = change.SelectAttrValue("client", "")
+		summary.LastChangeOrigin = change.SelectAttrValue("origin", "")
+	}
+	if nodes := elem.SelectElement("nodes_configured"); nodes != nil {
+		summary.NodesConfigured, _ = strconv.Atoi(nodes.SelectAttrValue("number", ""))
+	}
+	if resources := elem.SelectElement("resources_configured"); resources != nil {
+		summary.ResourcesConfigured, _ = strconv.Atoi(resources.SelectAttrValue("number", ""))
+		summary.ResourcesDisabled, _ = strconv.Atoi(resources.SelectAttrValue("disabled", ""))
+		summary.ResourcesBlocked, _ = strconv.Atoi(resources.SelectAttrValue("blocked", ""))
+	}
+	if options := elem.SelectElement("cluster_options"); options != nil {
+		for _, attr := range options.Attr {
+			summary.Options[attr.Key] = attr.Value
+		}
+	}
+
+	return summary
+}
+
+func parseStatusNode(elem *xmltree.Element) StatusNode {
+	node := StatusNode{
+		Name:          elem.SelectAttrValue("name", ""),
+		ID:            elem.SelectAttrValue(cibAttrKeyID, ""),
+		Type:          elem.SelectAttrValue("type", ""),
+		Online:        isTrue(elem.SelectAttrValue("online", "")),
+		Standby:       isTrue(elem.SelectAttrValue("standby", "")),
+		StandbyOnFail: isTrue(elem.SelectAttrValue("standby_onfail", "")),
+		Maintenance:   isTrue(elem.SelectAttrValue("maintenance", "")),
+		Pending:       isTrue(elem.SelectAttrValue("pending", "")),
+		Unclean:       isTrue(elem.SelectAttrValue("unclean", "")),
+		Shutdown:      isTrue(elem.SelectAttrValue("shutdown", "")),
+		ExpectedUp:    isTrue(elem.SelectAttrValue("expected_up", "")),
+		IsDC:          isTrue(elem.SelectAttrValue("is_dc", "")),
+	}
+	node.ResourcesRunning, _ = strconv.Atoi(elem.SelectAttrValue("resources_running", ""))
+	return node
+}
+
+// collectStatusResources walks the resources section of crm_mon, which
+// nests primitives in groups, clones and bundle replicas.
+func collectStatusResources(elem *xmltree.Element, parent string, resources *[]StatusResource) {
+	for _, child := range elem.ChildElements() {
+		switch child.Tag {
+		case "resource":
+			rsc := StatusResource{
+				ID:             child.SelectAttrValue(cibAttrKeyID, ""),
+				Agent:          child.SelectAttrValue("resource_agent", ""),
+				Role:           child.SelectAttrValue("role", ""),
+				Parent:         parent,
+				Active:         isTrue(child.SelectAttrValue("active", "")),
+				Orphaned:       isTrue(child.SelectAttrValue("orphaned", "")),
+				Blocked:        isTrue(child.SelectAttrValue("blocked", "")),
+				Managed:        isTrue(child.SelectAttrValue("managed", "true")),
+				Failed:         isTrue(child.SelectAttrValue("failed", "")),
+				FailureIgnored: isTrue(child.SelectAttrValue("failure_ignored", "")),
+			}
+			for _, node := range child.SelectElements("node") {
+				rsc.Nodes = append(rsc.Nodes, node.SelectAttrValue("name", ""))
+			}
+			*resources = append(*resources, rsc)
+		case "group", "clone", "bundle":
+			collectStatusResources(child, child.SelectAttrValue(cibAttrKeyID, ""), resources)
+		case "replica":
+			collectStatusResources(child, parent, resources)
+		}
+	}
+}
+
+func parseStatusFailure(elem *xmltree.Element) (StatusFailure, error) {
+	failure := StatusFailure{
+		OpKey:        elem.SelectAttrValue("op_key", ""),
+		Node:         elem.SelectAttrValue("node", ""),
+		Task:         elem.SelectAttrValue("task", ""),
+		ExitStatus:   elem.SelectAttrValue("exitstatus", ""),
+		ExitReason:   elem.SelectAttrValue("exitreason", ""),
+		Status:       elem.SelectAttrValue("status", ""),
+		LastRcChange: elem.SelectAttrValue("last-rc-change", ""),
+	}
+
+	ints := []struct {
+		name  string
+		value *int
+	}{
+		{"exitcode", &failure.ExitCode},
+		{"call", &failure.CallID},
+	}
+	for _, i := range ints {
+		n, err := intAttr(elem, i.name, 0)
+		if err != nil {
+			return StatusFailure{}, fmt.Errorf("failure %s on node %s: %w", failure.OpKey, failure.Node, err)
+		}
+		*i.value = n
+	}
+
+	interval, err := intAttr(elem, "interval", 0)
+	if err != nil {
+		return StatusFailure{}, fmt.Errorf("failure %s on node %s: %w", failure.OpKey, failure.Node, err)
+	}
+	failure.Interval = time.Duration(interval) * time.Millisecond
+
+	return failure, nil
+}
@@ -0,0 +1,159 @@
+package cib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const crmMonXML = `<pacemaker-result api-version="2.3" request="crm_mon --one-shot --inactive --output-as=xml">
+	<summary>
+		<stack type="corosync"/>
+		<current_dc present="true" version="2.0.5-ba59be7122" name="la1" id="1" with_quorum="true"/>
+		<last_update time="Sat Oct 17 08:20:01 2026"/>
+		<last_change time="Sat Oct 17 08:15:42 2026" user="root" client="cibadmin" origin="la1"/>
+		<nodes_configured number="2"/>
+		<resources_configured number="4" disabled="1" blocked="0"/>
+		<cluster_options stonith-enabled="true" symmetric-cluster="true" no-quorum-policy="stop" maintenance-mode="false"/>
+	</summary>
+	<nodes>
+		<node name="la1" id="1" online="true" standby="false" standby_onfail="false" maintenance="false" pending="false" unclean="false" shutdown="false" expected_up="true" is_dc="true" resources_running="2" type="member"/>
+		<node name="la2" id="2" online="true" standby="true" standby_onfail="false" maintenance="false" pending="false" unclean="false" shutdown="false" expected_up="true" is_dc="false" resources_running="1" type="member"/>
+	</nodes>
+	<resources>
+		<resource id="p_ip" resource_agent="ocf::heartbeat:IPaddr2" role="Started" active="true" orphaned="false" blocked="false" managed="true" failed="false" failure_ignored="false" nodes_running_on="1">
+			<node name="la1" id="1" cached="true"/>
+		</resource>
+		<clone id="ms_drbd" multi_state="true" unique="false" managed="true" failed="false" failure_ignored="false">
+			<resource id="p_drbd" resource_agent="ocf::linbit:drbd" role="Master" active="true" orphaned="false" blocked="false" managed="true" failed="false" failure_ignored="false" nodes_running_on="1">
+				<node name="la1" id="1" cached="true"/>
+			</resource>
+			<resource id="p_drbd" resource_agent="ocf::linbit:drbd" role="Slave" active="true" orphaned="false" blocked="false" managed="true" failed="false" failure_ignored="false" nodes_running_on="1">
+				<node name="la2" id="2" cached="true"/>
+			</resource>
+		</clone>
+		<group id="g_web" number_resources="1">
+			<resource id="p_web" resource_agent="ocf::heartbeat:apache" role="Stopped" target_role="Stopped" active="false" orphaned="false" blocked="false" managed="true" failed="false" failure_ignored="false" nodes_running_on="0"/>
+		</group>
+	</resources>
+	<node_attributes>
+		<node name="la1">
+			<attribute name="master-p_drbd" value="10000"/>
+		</node>
+		<node name="la2">
+			<attribute name="master-p_drbd" value="1000"/>
+		</node>
+	</node_attributes>
+	<failures>
+		<failure op_key="p_web_start_0" node="la2" exitstatus="error" exitreason="Config file missing" exitcode="1" call="8" status="complete" last-rc-change="2026-10-17 08:15:42 +02:00" queued="0" exec="31" interval="0" task="start"/>
+	</failures>
+	<fence_history>
+		<fence_event action="reboot" target="la3" client="pacemaker-controld.1234" origin="la2" status="success" delegate="la1" completed="2026-10-16 21:03:10Z"/>
+	</fence_history>
+	<tickets>
+		<ticket id="t_site_a" status="granted" standby="false" last-granted="Fri Oct 16 09:00:00 2026"/>
+	</tickets>
+	<status code="0" message="OK"/>
+</pacemaker-result>`
+
+func TestParseClusterStatus(t *testing.T) {
+	actual, err := ParseClusterStatus(crmMonXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := ClusterStatus{
+		Summary: StatusSummary{
+			Stack:               "corosync",
+			DC:                  "la1",
+			DCID:                "1",
+			DCVersion:           "2.0.5-ba59be7122",
+			HaveQuorum:          true,
+			LastUpdate:          "Sat Oct 17 08:20:01 2026",
+			LastChange:          "Sat Oct 17 08:15:42 2026",
+			LastChangeUser:      "root",
+			LastChangeClient:    "cibadmin",
+			LastChangeOrigin:    "la1",
+			NodesConfigured:     2,
+			ResourcesConfigured: 4,
+			ResourcesDisabled:   1,
+			Options: map[string]string{
+				"stonith-enabled":   "true",
+				"symmetric-cluster": "true",
+				"no-quorum-policy":  "stop",
+				"maintenance-mode":  "false",
+			},
+		},
+		Nodes: []StatusNode{
+			{Name: "la1", ID: "1", Type: "member", Online: true, ExpectedUp: true, IsDC: true, ResourcesRunning: 2},
+			{Name: "la2", ID: "2", Type: "member", Online: true, Standby: true, ExpectedUp: true, ResourcesRunning: 1},
+		},
+		Resources: []StatusResource{
+			{ID: "p_ip", Agent: "ocf::heartbeat:IPaddr2", Role: "Started", Active: true, Managed: true, Nodes: []string{"la1"}},
+			{ID: "p_drbd", Agent: "ocf::linbit:drbd", Role: "Master", Parent: "ms_drbd", Active: true, Managed: true, Nodes: []string{"la1"}},
+			{ID: "p_drbd", Agent: "ocf::linbit:drbd", Role: "Slave", Parent: "ms_drbd", Active: true, Managed: true, Nodes: []string{"la2"}},
+			{ID: "p_web", Agent: "ocf::heartbeat:apache", Role: "Stopped", Parent: "g_web", Managed: true},
+		},
+		NodeAttributes: map[string]map[string]string{
+			"la1": {"master-p_drbd": "10000"},
+			"la2": {"master-p_drbd": "1000"},
+		},
+		Failures: []StatusFailure{{
+			OpKey:        "p_web_start_0",
+			Node:         "la2",
+			Task:         "start",
+			ExitStatus:   "error",
+			ExitReason:   "Config file missing",
+			ExitCode:     1,
+			CallID:       8,
+			Status:       "complete",
+			LastRcChange: "2026-10-17 08:15:42 +02:00",
+		}},
+		FenceHistory: []FenceEvent{{
+			Target:    "la3",
+			Action:    FenceReboot,
+			Status:    FenceStatusSuccess,
+			Delegate:  "la1",
+			Origin:    "la2",
+			Client:    "pacemaker-controld.1234",
+			Completed: time.Date(2026, 10, 16, 21, 3, 10, 0, time.UTC),
+		}},
+		Tickets: []Ticket{{ID: "t_site_a", Granted: true, LastGranted: "Fri Oct 16 09:00:00 2026"}},
+	}
+
+	equalTime := cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })
+	if !cmp.Equal(actual, expect, equalTime) {
+		t.Errorf("Unexpected cluster status")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual, equalTime))
+	}
+
+	if _, err := ParseClusterStatus(`<pacemaker-result><status code="102" message="Not connected"/></pacemaker-result>`); err == nil {
+		t.Errorf("Expected error for failed crm_mon")
+	}
+}
+
+func TestStatusFromCrmMon(t *testing.T) {
+	monCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return crmMonXML, "", nil
+		},
+	}
+
+	cib := CIB{StatusSource: StatusFromCrmMon}
+
+	if node := cib.GetNodeOfResource("p_drbd"); node != "la1" {
+		t.Errorf("Unexpected node of p_drbd: '%s'", node)
+	}
+	if node := cib.GetNodeOfResource("p_web"); node != "" {
+		t.Errorf("Unexpected node of p_web: '%s'", node)
+	}
+
+	resources, err := cib.ListResourcesOnNode("la1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(resources, []string{"p_ip", "p_drbd"}) {
+		t.Errorf("Unexpected resources on la1: %v", resources)
+	}
+}
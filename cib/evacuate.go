@@ -0,0 +1,250 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrEvacuationBlocked is returned by EvacuateNode if resources remain on
+// the node that Pacemaker will not move away.
+var ErrEvacuationBlocked = errors.New("evacuation blocked")
+
+// EvacuateOptions controls EvacuateNode.
+type EvacuateOptions struct {
+	// Lifetime of the standby attribute. The default is LifetimeForever.
+	Lifetime AttributeLifetime
+	// Progress receives an event whenever the set of resources on the node
+	// changes. The channel is not closed by EvacuateNode. It may be nil.
+	Progress chan<- EvacuationProgress
+	// RollbackOnTimeout takes the node out of standby again if the context
+	// is done before the node is empty. Nothing is rolled back if the node
+	// was already in standby.
+	RollbackOnTimeout bool
+	// PollInterval is the time between two checks of the cluster state.
+	// The default is the package's CIB poll delay.
+	PollInterval time.Duration
+}
+
+// EvacuationProgress describes the state of an ongoing evacuation.
+type EvacuationProgress struct {
+	Node string
+	// Remaining lists the resources still active on the node.
+	Remaining []string
+	// Moved maps the resources that left the node to the node they are
+	// active on now. Resources that are not active anywhere map to an
+	// empty string.
+	Moved map[string]string
+}
+
+// BlockedResource is a resource that did not leave the node.
+type BlockedResource struct {
+	ID     string
+	Reason string
+}
+
+// EvacuationReport is the result of EvacuateNode.
+type EvacuationReport struct {
+	Node string
+	// Moved maps the resources that left the node to the node they are
+	// active on now, or to an empty string if they were stopped.
+	Moved map[string]string
+	// Blocked lists the resources that are still on the node.
+	Blocked []BlockedResource
+	// RolledBack is true if the standby was removed again.
+	RolledBack bool
+}
+
+// EvacuateNode puts a node into standby and waits until no resources are
+// active on it anymore.
+//
+// If all resources remaining on the node are blocked, i.e. Pacemaker will
+// not move them (because they are unmanaged, in maintenance mode or their
+// stop failed), it returns ErrEvacuationBlocked. If the context is done
+// first, the context's error is returned. In both cases the report lists
+// the resources that are still on the node, with a reason.
+func (c *CIB) EvacuateNode(ctx context.Context, node string, opts EvacuateOptions) (EvacuationReport, error) {
+	report := EvacuationReport{Node: node, Moved: make(map[string]string)}
+
+	if opts.Lifetime == "" {
+		opts.Lifetime = LifetimeForever
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = cibPollRetryDelay
+	}
+
+	wasStandby, err := c.IsStandbyNode(node)
+	if err != nil {
+		return report, err
+	}
+
+	initial, err := c.ListResourcesOnNode(node)
+	if err != nil {
+		return report, err
+	}
+
+	if !wasStandby {
+		err = c.StandbyNodeWithLifetime(node, opts.Lifetime)
+		if err != nil {
+			return report, fmt.Errorf("could not put node %s into standby: %w", node, err)
+		}
+	}
+
+	contextLog := log.WithField("node", node)
+	contextLog.Debugf("Evacuating resources: %s", strings.Join(initial, ", "))
+
+	var remaining []string
+	first := true
+	err = poll(ctx, opts.PollInterval, func() (bool, error) {
+		err := c.ReadConfiguration()
+		if err != nil {
+			return false, err
+		}
+		root := c.Doc.FindElement("/cib")
+		if root == nil {
+			return false, fmt.Errorf("invalid cib state: root element not found")
+		}
+
+		current, err := c.ListResourcesOnNode(node)
+		if err != nil {
+			return false, err
+		}
+		sort.Strings(current)
+
+		for _, id := range initial {
+			if _, ok := report.Moved[id]; ok || contains(current, id) {
+				continue
+			}
+			report.Moved[id] = nodeOfResource(root, id)
+			contextLog.Debugf("Resource %s left the node, now on '%s'", id, report.Moved[id])
+		}
+
+		changed := first || !equalStrings(current, remaining)
+		first = false
+		remaining = current
+
+		if changed && opts.Progress != nil {
+			progress := EvacuationProgress{
+				Node:      node,
+				Remaining: current,
+				Moved:     copyMap(report.Moved),
+			}
+			select {
+			case opts.Progress <- progress:
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+
+		if len(current) == 0 {
+			return true, nil
+		}
+
+		history, err := operationHistory(root)
+		if err != nil {
+			return false, err
+		}
+
+		report.Blocked = nil
+		for _, id := range current {
+			reason := blockedReason(root, history, id, node)
+			if reason == "" {
+				return false, nil
+			}
+			report.Blocked = append(report.Blocked, BlockedResource{ID: id, Reason: reason})
+		}
+
+		return false, fmt.Errorf("%w: %d resource(s) cannot leave node %s", ErrEvacuationBlocked, len(current), node)
+	})
+
+	if err == nil {
+		contextLog.Debug("Node is evacuated")
+		return report, nil
+	}
+
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		report.Blocked = nil
+		for _, id := range remaining {
+			report.Blocked = append(report.Blocked, BlockedResource{ID: id, Reason: "still active on node"})
+		}
+
+		if opts.RollbackOnTimeout && !wasStandby {
+			contextLog.Warning("Evacuation timed out, taking node out of standby")
+			rollbackErr := c.UnStandbyNode(node)
+			if rollbackErr != nil {
+				return report, fmt.Errorf("evacuation of node %s timed out: %v; rollback failed: %w", node, err, rollbackErr)
+			}
+			report.RolledBack = true
+		}
+		return report, fmt.Errorf("evacuation of node %s timed out: %w", node, err)
+	}
+
+	return report, err
+}
+
+// blockedReason returns why Pacemaker will not move a resource away from a
+// node, or an empty string if nothing blocks it.
+func blockedReason(root *xmltree.Element, history OperationHistory, id, node string) string {
+	if isTrue(clusterOption(root, "maintenance-mode")) {
+		return "cluster is in maintenance mode"
+	}
+
+	if attrs, err := effectiveNodeAttributes(root, node); err == nil && isTrue(attrs["maintenance"]) {
+		return "node is in maintenance mode"
+	}
+
+	rscID := lrmResourceID(id)
+
+	defaults := make(map[string]string)
+	if rscDefaults := root.FindElement("configuration/rsc_defaults"); rscDefaults != nil {
+		defaults = nvsetValues(rscDefaults, cibTagMetaAttr)
+	}
+	for elem := findResourceElement(root, rscID); elem != nil && isResourceKind(ResourceKind(elem.Tag)); elem = elem.Parent() {
+		meta := nvsetValues(elem, cibTagMetaAttr)
+		if isTrue(meta["maintenance"]) {
+			return fmt.Sprintf("resource %s is in maintenance mode", elem.SelectAttrValue(cibAttrKeyID, ""))
+		}
+		if value, ok := meta["is-managed"]; ok && !isTrue(value) {
+			return fmt.Sprintf("resource %s is unmanaged", elem.SelectAttrValue(cibAttrKeyID, ""))
+		}
+	}
+	if value, ok := defaults["is-managed"]; ok && !isTrue(value) {
+		return "resources are unmanaged by default"
+	}
+
+	// only the latest stop counts, pending stops and failures that were
+	// followed by a successful operation do not block
+	state := replayRunState(id, history.byNode[node][id], history.isPromotable(id))
+	if state.State == Failed && state.Operation == cibAttrValueStop {
+		return "stop operation failed: " + state.Reason
+	}
+
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,247 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+// evacuationXML is a CIB in which p_a and p_b run on la1. The probe of p_a
+// on la2 found it stopped.
+const evacuationXML = `<cib><configuration>
+	<nodes><node id="1" uname="la1"/><node id="2" uname="la2"/></nodes>
+	<resources>
+		<primitive id="p_a" class="ocf" provider="heartbeat" type="Dummy"/>
+		<primitive id="p_b" class="ocf" provider="heartbeat" type="Dummy"/>
+	</resources>
+	</configuration><status>
+		<node_state id="1" uname="la1"><lrm><lrm_resources>
+			<lrm_resource id="p_a"><lrm_rsc_op id="p_a_last_0" operation="start" call-id="3" rc-code="0"/></lrm_resource>
+			<lrm_resource id="p_b"><lrm_rsc_op id="p_b_last_0" operation="start" call-id="4" rc-code="0"/></lrm_resource>
+		</lrm_resources></lrm></node_state>
+		<node_state id="2" uname="la2"><lrm><lrm_resources>
+			<lrm_resource id="p_a"><lrm_rsc_op id="p_a_last_0" operation="monitor" call-id="1" rc-code="7"/></lrm_resource>
+		</lrm_resources></lrm></node_state>
+	</status></cib>`
+
+// Edits of evacuationXML, as pairs of old and new strings
+var (
+	evacuationStandby = []string{
+		`<node id="1" uname="la1"/>`,
+		`<node id="1" uname="la1"><instance_attributes id="nodes-1"><nvpair id="nodes-1-standby" name="standby" value="on"/></instance_attributes></node>`,
+	}
+	evacuationMovedA = []string{
+		`operation="start" call-id="3"`, `operation="stop" call-id="5"`,
+		`operation="monitor" call-id="1" rc-code="7"`, `operation="start" call-id="6" rc-code="0"`,
+	}
+	evacuationStoppedB = []string{`operation="start" call-id="4"`, `operation="stop" call-id="7"`}
+)
+
+// editXML applies edits, each a list of pairs of old and new strings, to a
+// CIB.
+func editXML(xml string, edits ...[]string) string {
+	var pairs []string
+	for _, edit := range edits {
+		pairs = append(pairs, edit...)
+	}
+	return strings.NewReplacer(pairs...).Replace(xml)
+}
+
+func TestEvacuateNode(t *testing.T) {
+	states := []string{
+		editXML(evacuationXML, evacuationStandby),
+		editXML(evacuationXML, evacuationStandby, evacuationMovedA),
+		editXML(evacuationXML, evacuationStandby, evacuationMovedA, evacuationStoppedB),
+	}
+
+	standby := false
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			if !standby {
+				return evacuationXML, "", nil
+			}
+			state := states[len(states)-1]
+			if reads < len(states) {
+				state = states[reads]
+			}
+			reads++
+			return state, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			standby = true
+			return "", "", nil
+		},
+	}
+
+	progress := make(chan EvacuationProgress, 10)
+	var cib CIB
+	report, err := cib.EvacuateNode(context.Background(), "la1", EvacuateOptions{
+		Progress:     progress,
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(progress)
+	if reads != len(states) {
+		t.Errorf("Expected one read of the CIB per poll, got %d reads", reads)
+	}
+
+	expectMoved := map[string]string{"p_a": "la2", "p_b": ""}
+	if !cmp.Equal(report.Moved, expectMoved) {
+		t.Errorf("Unexpected moved resources")
+		t.Errorf("Expected: %v", expectMoved)
+		t.Errorf("Actual: %v", report.Moved)
+	}
+	if len(report.Blocked) != 0 || report.RolledBack {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	var remaining [][]string
+	for p := range progress {
+		remaining = append(remaining, p.Remaining)
+	}
+	expectRemaining := [][]string{{"p_a", "p_b"}, {"p_b"}, nil}
+	if !cmp.Equal(remaining, expectRemaining) {
+		t.Errorf("Unexpected progress")
+		t.Errorf("Expected: %v", expectRemaining)
+		t.Errorf("Actual: %v", remaining)
+	}
+}
+
+func TestEvacuateNodeBlocked(t *testing.T) {
+	// p_a has left la1, the unmanaged p_b cannot
+	unmanaged := []string{
+		`<primitive id="p_b" class="ocf" provider="heartbeat" type="Dummy"/>`,
+		`<primitive id="p_b" class="ocf" provider="heartbeat" type="Dummy">
+			<meta_attributes id="p_b-meta_attributes">
+				<nvpair id="p_b-meta_attributes-is-managed" name="is-managed" value="false"/>
+			</meta_attributes>
+		</primitive>`,
+	}
+
+	standby := false
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			if standby {
+				return editXML(evacuationXML, evacuationStandby, evacuationMovedA, unmanaged), "", nil
+			}
+			return editXML(evacuationXML, evacuationMovedA, unmanaged), "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			standby = true
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	report, err := cib.EvacuateNode(context.Background(), "la1", EvacuateOptions{PollInterval: time.Millisecond})
+	if !errors.Is(err, ErrEvacuationBlocked) {
+		t.Fatalf("Expected ErrEvacuationBlocked, got %v", err)
+	}
+
+	expect := []BlockedResource{{ID: "p_b", Reason: "resource p_b is unmanaged"}}
+	if !cmp.Equal(report.Blocked, expect) {
+		t.Errorf("Unexpected blocked resources")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", report.Blocked)
+	}
+}
+
+func TestEvacuateNodeRollback(t *testing.T) {
+	standby := false
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			if standby {
+				return editXML(evacuationXML, evacuationStandby, evacuationStoppedB), "", nil
+			}
+			return editXML(evacuationXML, evacuationStoppedB), "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			standby = !standby
+			return "", "", nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var cib CIB
+	report, err := cib.EvacuateNode(ctx, "la1", EvacuateOptions{
+		RollbackOnTimeout: true,
+		PollInterval:      time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected timeout, got %v", err)
+	}
+	if !report.RolledBack {
+		t.Errorf("Expected standby to be rolled back")
+	}
+	if standby {
+		t.Errorf("Node is still in standby")
+	}
+
+	expect := []BlockedResource{{ID: "p_a", Reason: "still active on node"}}
+	if !cmp.Equal(report.Blocked, expect) {
+		t.Errorf("Unexpected blocked resources: %+v", report.Blocked)
+	}
+}
+
+func TestBlockedReason(t *testing.T) {
+	cases := []struct {
+		desc   string
+		ops    string
+		expect string
+	}{{
+		desc: "failed stop",
+		ops: `<lrm_rsc_op id="p_a_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_a_last_failure_0" operation="stop" call-id="4" rc-code="1" op-status="0" interval="0" exit-reason="Device busy"/>`,
+		expect: "stop operation failed: stop returned 1: Device busy",
+	}, {
+		desc: "pending stop",
+		ops: `<lrm_rsc_op id="p_a_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_a_pending_0" operation="stop" call-id="-1" rc-code="193" op-status="-1" interval="0"/>`,
+		expect: "",
+	}, {
+		desc: "stale stop failure",
+		ops: `<lrm_rsc_op id="p_a_last_failure_0" operation="stop" call-id="3" rc-code="1" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_a_last_0" operation="start" call-id="5" rc-code="0" op-status="0" interval="0"/>`,
+		expect: "",
+	}}
+
+	for _, c := range cases {
+		xml := `<cib><configuration>
+	<nodes><node id="1" uname="la1"/></nodes>
+	<resources><primitive id="p_a" class="ocf" provider="heartbeat" type="Dummy"/></resources>
+	</configuration><status>
+		<node_state id="1" uname="la1"><lrm><lrm_resources>
+			<lrm_resource id="p_a">` + c.ops + `</lrm_resource>
+		</lrm_resources></lrm></node_state>
+	</status></cib>`
+		doc := xmltree.NewDocument()
+		if err := doc.ReadFromString(xml); err != nil {
+			t.Fatal(err)
+		}
+		history, err := operationHistory(doc.Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual := blockedReason(doc.Root(), history, "p_a", "la1")
+		if actual != c.expect {
+			t.Errorf("Unexpected reason for case \"%s\": '%s'", c.desc, actual)
+		}
+	}
+}
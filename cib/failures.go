@@ -0,0 +1,251 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// Prefixes of the transient node attributes that record failures
+const (
+	failCountPrefix   = "fail-count-"
+	lastFailurePrefix = "last-failure-"
+)
+
+// FailCount is the number of failures of a resource on a node, as recorded
+// by the fail-count-* and last-failure-* transient node attributes.
+type FailCount struct {
+	Resource string
+	Node     string
+	// Operation and Interval identify the operation that failed. Pacemaker
+	// versions before 2.0 count the failures of a resource in a single
+	// attribute, in which case both are empty.
+	Operation string
+	Interval  time.Duration
+	// Count saturates at INFINITY, which Pacemaker uses e.g. for failed
+	// starts
+	Count       Score
+	LastFailure time.Time
+}
+
+// FailCounts returns the fail counts of a resource on all nodes, or of all
+// resources if id is empty. The fail counts of groups, clones and bundles
+// are the ones of their primitives. The result is sorted by resource, node,
+// operation and interval.
+func (c *CIB) FailCounts(id string) ([]FailCount, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return failCounts(root, id, "")
+}
+
+// FailedActions returns the failed operations recorded in the status
+// section, like the "Failed Resource Actions" of crm_mon. An operation that
+// is recorded both as last and as last failure is only returned once. The
+// result is sorted by node, resource and call ID.
+func (c *CIB) FailedActions() ([]LrmOperation, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	history, err := operationHistory(root)
+	if err != nil {
+		return nil, err
+	}
+
+	type opKey struct {
+		operation string
+		interval  time.Duration
+		callID    int
+	}
+
+	var failed []LrmOperation
+	for _, node := range history.Nodes() {
+		resources := history.byNode[node]
+		for _, lrmID := range sortedKeys(resources) {
+			seen := make(map[opKey]bool)
+			for _, op := range resources[lrmID] {
+				if !op.Failed() {
+					continue
+				}
+				key := opKey{op.Operation, op.Interval, op.CallID}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				failed = append(failed, op)
+			}
+		}
+	}
+	return failed, nil
+}
+
+// CleanupResource forgets the failures of a resource on a node, or on all
+// nodes if node is empty, like crm_resource --cleanup. If id is empty, the
+// failures of all resources are cleaned up. It then waits until the fail
+// counts have cleared or the context is done.
+func (c *CIB) CleanupResource(ctx context.Context, id, node string) error {
+	return c.cleanupResource(ctx, "--cleanup", id, node)
+}
+
+// RefreshResource forgets the whole operation history of a resource on a
+// node, or on all nodes if node is empty, so that Pacemaker probes its
+// state again, like crm_resource --refresh. Otherwise it behaves like
+// CleanupResource.
+func (c *CIB) RefreshResource(ctx context.Context, id, node string) error {
+	return c.cleanupResource(ctx, "--refresh", id, node)
+}
+
+func (c *CIB) cleanupResource(ctx context.Context, mode, id, node string) error {
+	args := []string{mode}
+	if id != "" {
+		args = append(args, "--resource", id)
+	}
+	if node != "" {
+		args = append(args, "--node", node)
+	}
+
+	_, stderr, err := resourceCommand.execute("", args...)
+	if err != nil {
+		return fmt.Errorf("could not clean up resource '%s': %w: %s", id, err, strings.TrimSpace(stderr))
+	}
+
+	contextLog := log.WithFields(log.Fields{"resource": id, "node": node})
+	return poll(ctx, cibPollRetryDelay, func() (bool, error) {
+		err := c.ReadConfiguration()
+		if err != nil {
+			return false, fmt.Errorf("could not read configuration: %w", err)
+		}
+
+		root := c.Doc.FindElement("/cib")
+		if root == nil {
+			return false, fmt.Errorf("invalid cib state: root element not found")
+		}
+
+		counts, err := failCounts(root, id, node)
+		if err != nil {
+			return false, err
+		}
+		if len(counts) > 0 {
+			contextLog.Debugf("Waiting for %d fail count(s) to clear", len(counts))
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// failCounts collects the fail counts of a resource, or of all resources if
+// id is empty, restricted to a node if node is not empty.
+func failCounts(root *xmltree.Element, id, node string) ([]FailCount, error) {
+	// fail counts are recorded for primitives
+	resources := map[string]bool{id: true}
+	if rscElem := findResourceElement(root, id); id != "" && rscElem != nil {
+		for _, primitive := range primitiveIDs(rscElem) {
+			resources[primitive] = true
+		}
+	}
+
+	var counts []FailCount
+	for _, state := range root.FindElements("status/node_state") {
+		uname := state.SelectAttrValue("uname", "")
+		if uname == "" || (node != "" && uname != node) {
+			continue
+		}
+
+		attrs := transientAttributes(state)
+		for name, value := range attrs {
+			if !strings.HasPrefix(name, failCountPrefix) {
+				continue
+			}
+			count, err := failCountFromAttribute(uname, strings.TrimPrefix(name, failCountPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if id != "" && !resources[count.Resource] {
+				continue
+			}
+
+			count.Count, err = ParseScore(value)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: attribute %s: %w", uname, name, err)
+			}
+			if count.Count == 0 {
+				continue
+			}
+
+			last := attrs[lastFailurePrefix+strings.TrimPrefix(name, failCountPrefix)]
+			if last != "" {
+				seconds, err := strconv.ParseInt(last, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("node %s: invalid last failure '%s': %w", uname, last, err)
+				}
+				count.LastFailure = time.Unix(seconds, 0)
+			}
+
+			counts = append(counts, count)
+		}
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		return a.Interval < b.Interval
+	})
+
+	return counts, nil
+}
+
+// failCountFromAttribute parses the part of a fail count attribute name
+// after the prefix, which is either "<resource>" or
+// "<resource>#<operation>_<interval in ms>".
+func failCountFromAttribute(node, suffix string) (FailCount, error) {
+	count := FailCount{Node: node}
+
+	i := strings.LastIndex(suffix, "#")
+	if i < 0 {
+		count.Resource = lrmResourceID(suffix)
+		return count, nil
+	}
+	count.Resource = lrmResourceID(suffix[:i])
+
+	op := suffix[i+1:]
+	j := strings.LastIndex(op, "_")
+	if j < 0 {
+		return FailCount{}, fmt.Errorf("node %s: invalid fail count attribute %s%s", node, failCountPrefix, suffix)
+	}
+	interval, err := strconv.Atoi(op[j+1:])
+	if err != nil {
+		return FailCount{}, fmt.Errorf("node %s: invalid interval in fail count attribute %s%s: %w", node, failCountPrefix, suffix, err)
+	}
+	count.Operation = op[:j]
+	count.Interval = time.Duration(interval) * time.Millisecond
+
+	return count, nil
+}
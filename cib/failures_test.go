@@ -0,0 +1,213 @@
+package cib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const failuresXML = `<cib><configuration>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2"/>
+	</nodes>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1">
+			<transient_attributes id="1">
+				<instance_attributes id="status-1">
+					<nvpair id="status-1-fail-count-p_db.monitor_10000" name="fail-count-p_db#monitor_10000" value="2"/>
+					<nvpair id="status-1-last-failure-p_db.monitor_10000" name="last-failure-p_db#monitor_10000" value="1760000300"/>
+				</instance_attributes>
+			</transient_attributes>
+			<lrm id="1">
+				<lrm_resources>
+					<lrm_resource id="p_db" type="Dummy" class="ocf" provider="heartbeat">
+						<lrm_rsc_op id="p_db_last_0" operation="start" call-id="14" rc-code="0" op-status="0" interval="0" transition-key="4:5:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+						<lrm_rsc_op id="p_db_monitor_10000" operation="monitor" call-id="12" rc-code="7" op-status="0" interval="10000" exit-reason="Process died" last-rc-change="1760000300" transition-key="5:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+						<lrm_rsc_op id="p_db_last_failure_0" operation="monitor" call-id="12" rc-code="7" op-status="0" interval="10000" exit-reason="Process died" last-rc-change="1760000300" transition-key="5:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+					</lrm_resource>
+				</lrm_resources>
+			</lrm>
+		</node_state>
+		<node_state id="2" uname="la2">
+			<transient_attributes id="2">
+				<instance_attributes id="status-2">
+					<nvpair id="status-2-fail-count-p_web" name="fail-count-p_web:1" value="INFINITY"/>
+					<nvpair id="status-2-fail-count-p_db.start_0" name="fail-count-p_db#start_0" value="0"/>
+				</instance_attributes>
+			</transient_attributes>
+			<lrm id="2">
+				<lrm_resources>
+					<lrm_resource id="p_web:1" type="apache" class="ocf" provider="heartbeat">
+						<lrm_rsc_op id="p_web_last_failure_0" operation="start" call-id="8" rc-code="1" op-status="0" interval="0" exit-reason="Config file missing" transition-key="8:4:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+						<lrm_rsc_op id="p_web_last_0" operation="stop" call-id="9" rc-code="0" op-status="0" interval="0" transition-key="2:5:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+					</lrm_resource>
+				</lrm_resources>
+			</lrm>
+		</node_state>
+	</status></cib>`
+
+func TestFailCounts(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return failuresXML, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.FailCounts("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []FailCount{{
+		Resource:    "p_db",
+		Node:        "la1",
+		Operation:   "monitor",
+		Interval:    10 * time.Second,
+		Count:       2,
+		LastFailure: time.Unix(1760000300, 0),
+	}, {
+		Resource: "p_web",
+		Node:     "la2",
+		Count:    ScoreInfinity,
+	}}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected fail counts")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	actual, err = cib.FailCounts("p_web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 1 || actual[0].Node != "la2" {
+		t.Errorf("Unexpected fail counts of p_web: %+v", actual)
+	}
+}
+
+func TestFailedActions(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return failuresXML, "", nil
+		},
+	}
+
+	var cib CIB
+	actions, err := cib.FailedActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for _, op := range actions {
+		actual = append(actual, op.Node+" "+op.ID+" "+op.ExitReason)
+	}
+	expect := []string{
+		"la1 p_db_monitor_10000 Process died",
+		"la2 p_web_last_failure_0 Config file missing",
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected failed actions")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", actual)
+	}
+}
+
+func TestCleanupResource(t *testing.T) {
+	cleaned := strings.Replace(failuresXML, `name="fail-count-p_db#monitor_10000" value="2"`, `name="fail-count-p_db#monitor_10000" value="0"`, 1)
+
+	var args []string
+	resourceCommand = &argsCommand{
+		func(_ string, a []string) (string, string, error) {
+			args = a
+			return "", "", nil
+		},
+	}
+
+	// the fail count clears after the second read
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			if reads < 3 {
+				return failuresXML, "", nil
+			}
+			return cleaned, "", nil
+		},
+	}
+
+	cibPollRetryDelay = 1 * time.Millisecond
+
+	var cib CIB
+	err := cib.CleanupResource(context.Background(), "p_db", "la1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(args, []string{"--cleanup", "--resource", "p_db", "--node", "la1"}) {
+		t.Errorf("Unexpected arguments for crm_resource: %v", args)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 reads of the CIB, got %d", reads)
+	}
+
+	// the fail count of p_web never clears
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return failuresXML, "", nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = cib.RefreshResource(ctx, "p_web", "")
+	if err == nil {
+		t.Errorf("Expected timeout")
+	}
+	if !cmp.Equal(args, []string{"--refresh", "--resource", "p_web"}) {
+		t.Errorf("Unexpected arguments for crm_resource: %v", args)
+	}
+}
+
+func TestCleanupResourceClone(t *testing.T) {
+	withClone := strings.Replace(failuresXML, `</nodes>`, `</nodes>
+	<resources>
+		<clone id="cl_web">
+			<primitive id="p_web" class="ocf" provider="heartbeat" type="apache"/>
+		</clone>
+	</resources>`, 1)
+	cleaned := strings.Replace(withClone, `name="fail-count-p_web:1" value="INFINITY"`, `name="fail-count-p_web:1" value="0"`, 1)
+
+	resourceCommand = &argsCommand{
+		func(_ string, _ []string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	// the fail count of the clone's primitive clears after the second read
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			if reads < 3 {
+				return withClone, "", nil
+			}
+			return cleaned, "", nil
+		},
+	}
+
+	cibPollRetryDelay = 1 * time.Millisecond
+
+	var cib CIB
+	err := cib.CleanupResource(context.Background(), "cl_web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 reads of the CIB, got %d", reads)
+	}
+}
@@ -0,0 +1,387 @@
+package cib
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+const (
+	cibTagFencingTopology = "fencing-topology"
+	cibTagFencingLevel    = "fencing-level"
+)
+
+// FencingLevel is an entry of the fencing topology. Exactly one of Target,
+// TargetPattern and TargetAttribute selects the nodes the level applies to.
+type FencingLevel struct {
+	ID string
+	// Index orders the levels of a node, lower indexes are tried first.
+	// Valid indexes are 1 to 9.
+	Index int
+	// Target is the name of a node
+	Target string
+	// TargetPattern is a regular expression matching node names
+	TargetPattern string
+	// TargetAttribute and TargetValue select all nodes whose attribute has
+	// the given value
+	TargetAttribute string
+	TargetValue     string
+	// Devices are the stonith devices that all have to succeed for the
+	// level to succeed
+	Devices []string
+}
+
+// targetString describes the target of the level for messages and IDs.
+func (l FencingLevel) targetString() string {
+	switch {
+	case l.Target != "":
+		return l.Target
+	case l.TargetPattern != "":
+		return l.TargetPattern
+	default:
+		return l.TargetAttribute + "=" + l.TargetValue
+	}
+}
+
+func (l FencingLevel) sameTarget(other FencingLevel) bool {
+	return l.Target == other.Target && l.TargetPattern == other.TargetPattern &&
+		l.TargetAttribute == other.TargetAttribute && l.TargetValue == other.TargetValue
+}
+
+// Matches reports whether the level applies to a node with the given name
+// and attributes.
+func (l FencingLevel) Matches(node string, attrs map[string]string) bool {
+	switch {
+	case l.Target != "":
+		return l.Target == node
+	case l.TargetPattern != "":
+		re, err := regexp.Compile(l.TargetPattern)
+		return err == nil && re.MatchString(node)
+	case l.TargetAttribute != "":
+		value, ok := attrs[l.TargetAttribute]
+		return ok && value == l.TargetValue
+	}
+	return false
+}
+
+// ListFencingLevels returns all levels of the fencing topology in document
+// order.
+func (c *CIB) ListFencingLevels() ([]FencingLevel, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return fencingLevels(root)
+}
+
+// AddFencingLevel adds a level to the fencing topology and returns its ID.
+// If the level has no ID, a conventional one is generated. All devices have
+// to be configured stonith resources, and a target can have only one level
+// per index.
+func (c *CIB) AddFencingLevel(level FencingLevel) (string, error) {
+	targets := 0
+	for _, t := range []string{level.Target, level.TargetPattern, level.TargetAttribute} {
+		if t != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return "", fmt.Errorf("fencing level needs exactly one of target, target pattern and target attribute")
+	}
+	if level.TargetPattern != "" {
+		if _, err := regexp.Compile(level.TargetPattern); err != nil {
+			return "", fmt.Errorf("invalid target pattern: %w", err)
+		}
+	}
+	if level.Index < 1 || level.Index > 9 {
+		return "", fmt.Errorf("invalid fencing level index %d, must be between 1 and 9", level.Index)
+	}
+	if len(level.Devices) == 0 {
+		return "", fmt.Errorf("fencing level needs at least one device")
+	}
+
+	err := c.ReadConfiguration()
+	if err != nil {
+		return "", fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return "", fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	for _, device := range level.Devices {
+		if !isStonithDevice(root, device) {
+			return "", fmt.Errorf("%s is not a configured stonith device", device)
+		}
+	}
+
+	existing, err := fencingLevels(root)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range existing {
+		if l.sameTarget(level) && l.Index == level.Index {
+			return "", fmt.Errorf("target %s already has fencing level %d (%s)", level.targetString(), level.Index, l.ID)
+		}
+	}
+
+	ids := NewIDAllocator(c.Doc)
+	if level.ID == "" {
+		level.ID = ids.Allocate("fl", level.targetString(), strconv.Itoa(level.Index))
+	} else if err := ids.Reserve(level.ID); err != nil {
+		return "", err
+	}
+
+	configuration := root.FindElement("configuration")
+	if configuration == nil {
+		configuration = root.CreateElement("configuration")
+	}
+	topology := configuration.FindElement(cibTagFencingTopology)
+	if topology == nil {
+		topology = configuration.CreateElement(cibTagFencingTopology)
+	}
+
+	elem := topology.CreateElement(cibTagFencingLevel)
+	elem.CreateAttr(cibAttrKeyID, level.ID)
+	elem.CreateAttr("index", strconv.Itoa(level.Index))
+	switch {
+	case level.Target != "":
+		elem.CreateAttr("target", level.Target)
+	case level.TargetPattern != "":
+		elem.CreateAttr("target-pattern", level.TargetPattern)
+	default:
+		elem.CreateAttr("target-attribute", level.TargetAttribute)
+		elem.CreateAttr("target-value", level.TargetValue)
+	}
+	elem.CreateAttr("devices", strings.Join(level.Devices, ","))
+
+	err = c.Update()
+	if err != nil {
+		return "", fmt.Errorf("could not update CIB: %w", err)
+	}
+	return level.ID, nil
+}
+
+// RemoveFencingLevels removes the levels matching the given level from the
+// fencing topology and returns how many were removed. If the level has an
+// ID, only the level with that ID is removed. Otherwise all levels with the
+// same target are removed, restricted to the same index if Index is set.
+func (c *CIB) RemoveFencingLevels(level FencingLevel) (int, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return 0, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return 0, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	removed := 0
+	for _, elem := range root.FindElements("configuration/" + cibTagFencingTopology + "/" + cibTagFencingLevel) {
+		l, err := parseFencingLevel(elem)
+		if err != nil {
+			return 0, err
+		}
+
+		var match bool
+		if level.ID != "" {
+			match = l.ID == level.ID
+		} else {
+			match = l.sameTarget(level) && (level.Index == 0 || l.Index == level.Index)
+		}
+		if match {
+			elem.Parent().RemoveChild(elem)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	err = c.Update()
+	if err != nil {
+		return 0, fmt.Errorf("could not update CIB: %w", err)
+	}
+	return removed, nil
+}
+
+// NodesWithoutFencing returns the cluster and remote nodes that cannot be
+// fenced. It returns nothing if STONITH is disabled.
+//
+// A node with fencing levels can be fenced if one of its levels only uses
+// configured devices. A node without fencing levels can be fenced if any
+// stonith device can target it according to its pcmk_host_list,
+// pcmk_host_map and pcmk_host_check parameters. Devices that query the
+// agent for their targets are assumed to be able to fence every node.
+func (c *CIB) NodesWithoutFencing() ([]string, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	// stonith-enabled defaults to true
+	if value := clusterOption(root, "stonith-enabled"); value != "" && !isTrue(value) {
+		return nil, nil
+	}
+
+	levels, err := fencingLevels(root)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := stonithDevices(root)
+
+	var nodes []string
+	for _, elem := range root.FindElements("configuration/nodes/node") {
+		if name := elem.SelectAttrValue("uname", ""); name != "" {
+			nodes = append(nodes, name)
+		}
+	}
+	for _, remote := range listRemoteNodes(root) {
+		if remote.Type == NodeTypeRemote && !contains(nodes, remote.Name) {
+			nodes = append(nodes, remote.Name)
+		}
+	}
+
+	var unfenced []string
+	for _, node := range nodes {
+		attrs, err := effectiveNodeAttributes(root, node)
+		if err != nil {
+			attrs = map[string]string{}
+		}
+
+		hasLevels := false
+		fenceable := false
+		for _, level := range levels {
+			if !level.Matches(node, attrs) {
+				continue
+			}
+			hasLevels = true
+			usable := true
+			for _, device := range level.Devices {
+				if !isStonithDevice(root, device) {
+					usable = false
+				}
+			}
+			if usable {
+				fenceable = true
+			}
+		}
+
+		if !hasLevels {
+			for _, device := range devices {
+				if deviceCanFence(device, node) {
+					fenceable = true
+					break
+				}
+			}
+		}
+
+		if !fenceable {
+			unfenced = append(unfenced, node)
+		}
+	}
+
+	return unfenced, nil
+}
+
+func fencingLevels(root *xmltree.Element) ([]FencingLevel, error) {
+	var levels []FencingLevel
+	for _, elem := range root.FindElements("configuration/" + cibTagFencingTopology + "/" + cibTagFencingLevel) {
+		level, err := parseFencingLevel(elem)
+		if err != nil {
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func parseFencingLevel(elem *xmltree.Element) (FencingLevel, error) {
+	level := FencingLevel{
+		ID:              elem.SelectAttrValue(cibAttrKeyID, ""),
+		Target:          elem.SelectAttrValue("target", ""),
+		TargetPattern:   elem.SelectAttrValue("target-pattern", ""),
+		TargetAttribute: elem.SelectAttrValue("target-attribute", ""),
+		TargetValue:     elem.SelectAttrValue("target-value", ""),
+	}
+
+	index, err := strconv.Atoi(elem.SelectAttrValue("index", ""))
+	if err != nil {
+		return FencingLevel{}, fmt.Errorf("fencing level %s: invalid index: %w", level.ID, err)
+	}
+	level.Index = index
+
+	for _, device := range strings.Split(elem.SelectAttrValue("devices", ""), ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			level.Devices = append(level.Devices, device)
+		}
+	}
+
+	return level, nil
+}
+
+// isStonithDevice checks if a primitive of class stonith with the given ID
+// is configured.
+func isStonithDevice(root *xmltree.Element, id string) bool {
+	elem := findResourceElement(root, id)
+	return elem != nil && elem.Tag == string(KindPrimitive) && elem.SelectAttrValue("class", "") == "stonith"
+}
+
+// stonithDevices returns all configured stonith primitives.
+func stonithDevices(root *xmltree.Element) []*xmltree.Element {
+	var devices []*xmltree.Element
+	for _, elem := range root.FindElements("configuration/resources//primitive[@class='stonith']") {
+		devices = append(devices, elem)
+	}
+	return devices
+}
+
+// deviceCanFence decides from a stonith device's parameters whether it can
+// fence a node, the way the fencer does.
+func deviceCanFence(device *xmltree.Element, node string) bool {
+	params := nvsetValues(device, cibTagInstAttr)
+
+	hostList := strings.FieldsFunc(params[paramHostList], isHostListSeparator)
+	hostMap := make(map[string]bool)
+	for _, entry := range strings.FieldsFunc(params[paramHostMap], isHostListSeparator) {
+		if i := strings.IndexAny(entry, ":="); i > 0 {
+			hostMap[entry[:i]] = true
+		}
+	}
+
+	check := params[paramHostCheck]
+	if check == "" {
+		check = "dynamic-list"
+		if len(hostList) > 0 || len(hostMap) > 0 {
+			check = "static-list"
+		}
+	}
+
+	switch check {
+	case "none":
+		return true
+	case "static-list":
+		return contains(hostList, node) || hostMap[node]
+	default:
+		// the agent is asked for its targets, which we cannot do here
+		return true
+	}
+}
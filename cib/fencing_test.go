@@ -0,0 +1,244 @@
+package cib
+
+import (
+	"testing"
+
+	xmltree "github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+const fencingXML = `<cib><configuration>
+	<crm_config>
+		<cluster_property_set id="cib-bootstrap-options"></cluster_property_set>
+	</crm_config>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2">
+			<instance_attributes id="nodes-2">
+				<nvpair id="nodes-2-rack" name="rack" value="1"/>
+			</instance_attributes>
+		</node>
+		<node id="3" uname="la3"/>
+		<node id="4" uname="lb4"/>
+	</nodes>
+	<resources>
+		<primitive id="st_ipmi_la1" class="stonith" type="fence_ipmilan">
+			<instance_attributes id="st_ipmi_la1-instance_attributes">
+				<nvpair id="st_ipmi_la1-instance_attributes-pcmk_host_list" name="pcmk_host_list" value="la1"/>
+			</instance_attributes>
+		</primitive>
+		<primitive id="st_pdu" class="stonith" type="fence_apc">
+			<instance_attributes id="st_pdu-instance_attributes">
+				<nvpair id="st_pdu-instance_attributes-pcmk_host_check" name="pcmk_host_check" value="static-list"/>
+				<nvpair id="st_pdu-instance_attributes-pcmk_host_map" name="pcmk_host_map" value="la1:1;la2:2"/>
+			</instance_attributes>
+		</primitive>
+		<primitive id="p_dummy" class="ocf" provider="heartbeat" type="Dummy"/>
+	</resources>
+	<fencing-topology>
+		<fencing-level id="fl-la1-1" target="la1" index="1" devices="st_ipmi_la1"/>
+		<fencing-level id="fl-la1-2" target="la1" index="2" devices="st_pdu"/>
+		<fencing-level id="fl-rack1-1" target-attribute="rack" target-value="1" index="1" devices="st_pdu"/>
+		<fencing-level id="fl-lb-1" target-pattern="^lb" index="1" devices="st_missing"/>
+	</fencing-topology>
+	</configuration></cib>`
+
+func TestListFencingLevels(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return fencingXML, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.ListFencingLevels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []FencingLevel{
+		{ID: "fl-la1-1", Index: 1, Target: "la1", Devices: []string{"st_ipmi_la1"}},
+		{ID: "fl-la1-2", Index: 2, Target: "la1", Devices: []string{"st_pdu"}},
+		{ID: "fl-rack1-1", Index: 1, TargetAttribute: "rack", TargetValue: "1", Devices: []string{"st_pdu"}},
+		{ID: "fl-lb-1", Index: 1, TargetPattern: "^lb", Devices: []string{"st_missing"}},
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected fencing levels")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	// la2 uses its rack level, la3 has no level and no device lists it, and
+	// the level of lb4 refers to a missing device
+	unfenced, err := cib.NodesWithoutFencing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(unfenced, []string{"la3", "lb4"}) {
+		t.Errorf("Unexpected nodes without fencing: %v", unfenced)
+	}
+}
+
+func TestNodesWithoutFencingHostMap(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return `<cib><configuration>
+<nodes><node id="1" uname="n1"/><node id="2" uname="n2"/></nodes>
+<resources>
+	<primitive id="st_map" class="stonith" type="fence_apc">
+		<instance_attributes id="st_map-instance_attributes">
+			<nvpair id="st_map-instance_attributes-pcmk_host_map" name="pcmk_host_map" value="n1:1"/>
+		</instance_attributes>
+	</primitive>
+</resources>
+</configuration></cib>`, "", nil
+		},
+	}
+
+	// a host map alone implies pcmk_host_check=static-list
+	var cib CIB
+	unfenced, err := cib.NodesWithoutFencing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(unfenced, []string{"n2"}) {
+		t.Errorf("Unexpected nodes without fencing: %v", unfenced)
+	}
+}
+
+func TestAddFencingLevel(t *testing.T) {
+	cases := []struct {
+		desc        string
+		level       FencingLevel
+		expectID    string
+		expectXML   string
+		expectError bool
+	}{{
+		desc:      "node target",
+		level:     FencingLevel{Index: 1, Target: "la3", Devices: []string{"st_pdu", "st_ipmi_la1"}},
+		expectID:  "fl-la3-1",
+		expectXML: `<fencing-level id="fl-la3-1" index="1" target="la3" devices="st_pdu,st_ipmi_la1"/>`,
+	}, {
+		desc:      "attribute target",
+		level:     FencingLevel{Index: 2, TargetAttribute: "rack", TargetValue: "1", Devices: []string{"st_pdu"}},
+		expectID:  "fl-rack.1-2",
+		expectXML: `<fencing-level id="fl-rack.1-2" index="2" target-attribute="rack" target-value="1" devices="st_pdu"/>`,
+	}, {
+		desc:        "duplicate index",
+		level:       FencingLevel{Index: 1, Target: "la1", Devices: []string{"st_pdu"}},
+		expectError: true,
+	}, {
+		desc:        "not a stonith device",
+		level:       FencingLevel{Index: 1, Target: "la3", Devices: []string{"p_dummy"}},
+		expectError: true,
+	}, {
+		desc:        "two targets",
+		level:       FencingLevel{Index: 1, Target: "la3", TargetPattern: "la.*", Devices: []string{"st_pdu"}},
+		expectError: true,
+	}, {
+		desc:        "invalid index",
+		level:       FencingLevel{Index: 10, Target: "la3", Devices: []string{"st_pdu"}},
+		expectError: true,
+	}}
+
+	for _, c := range cases {
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return fencingXML, "", nil
+			},
+		}
+
+		var updated string
+		updateCommand = &testCommand{
+			func(actual string) (string, string, error) {
+				updated = actual
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		id, err := cib.AddFencingLevel(c.level)
+		if err != nil {
+			if !c.expectError {
+				t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			}
+			continue
+		}
+		if c.expectError {
+			t.Errorf("Expected error in case '%s'", c.desc)
+			continue
+		}
+		if id != c.expectID {
+			t.Errorf("Unexpected ID in case '%s': %s", c.desc, id)
+		}
+
+		elem := cib.Doc.FindElement("//fencing-level[@id='" + id + "']")
+		if elem == nil {
+			t.Errorf("Level not found in update in case '%s': %s", c.desc, updated)
+			continue
+		}
+		doc := xmltree.NewDocument()
+		doc.SetRoot(elem.Copy())
+		actual, _ := doc.WriteToString()
+		if normalizeXML(t, actual) != normalizeXML(t, c.expectXML) {
+			t.Errorf("XML does not match (input '%s')", c.desc)
+			t.Errorf("Expected: %s", c.expectXML)
+			t.Errorf("Actual: %s", actual)
+		}
+	}
+}
+
+func TestRemoveFencingLevels(t *testing.T) {
+	cases := []struct {
+		desc   string
+		level  FencingLevel
+		expect []string
+	}{{
+		desc:   "all levels of a node",
+		level:  FencingLevel{Target: "la1"},
+		expect: []string{"fl-rack1-1", "fl-lb-1"},
+	}, {
+		desc:   "one index",
+		level:  FencingLevel{Target: "la1", Index: 2},
+		expect: []string{"fl-la1-1", "fl-rack1-1", "fl-lb-1"},
+	}, {
+		desc:   "by ID",
+		level:  FencingLevel{ID: "fl-lb-1"},
+		expect: []string{"fl-la1-1", "fl-la1-2", "fl-rack1-1"},
+	}, {
+		desc:   "attribute target",
+		level:  FencingLevel{TargetAttribute: "rack", TargetValue: "1"},
+		expect: []string{"fl-la1-1", "fl-la1-2", "fl-lb-1"},
+	}}
+
+	for _, c := range cases {
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return fencingXML, "", nil
+			},
+		}
+		updateCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		removed, err := cib.RemoveFencingLevels(c.level)
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if removed != 4-len(c.expect) {
+			t.Errorf("Unexpected number of removed levels in case '%s': %d", c.desc, removed)
+		}
+
+		var remaining []string
+		for _, elem := range cib.Doc.FindElements("//fencing-level") {
+			remaining = append(remaining, elem.SelectAttrValue("id", ""))
+		}
+		if !cmp.Equal(remaining, c.expect) {
+			t.Errorf("Unexpected remaining levels in case '%s': %v", c.desc, remaining)
+		}
+	}
+}
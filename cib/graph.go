@@ -0,0 +1,691 @@
+package cib
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DependencyKind is the type of relationship between two resources.
+type DependencyKind string
+
+const (
+	// DependencyOrder means that a resource has to be started after another one
+	DependencyOrder DependencyKind = "order"
+	// DependencyColocation means that a resource is placed relative to another one
+	DependencyColocation DependencyKind = "colocation"
+)
+
+var (
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// Dependency is an edge in the dependency graph: To depends on From.
+//
+// For order constraints, From is the "first" and To is the "then" resource.
+// For colocation constraints, From is the "with-rsc" and To is the "rsc"
+// resource, i.e. From is placed first and To follows it.
+type Dependency struct {
+	From  string
+	To    string
+	Kind  DependencyKind
+	Score Score
+	// Constraint is the ID of the constraint that defines this
+	// dependency, or the ID of the group for implicit dependencies.
+	Constraint string
+	// Implicit is true for the order and colocation between consecutive
+	// group members.
+	Implicit bool
+}
+
+// GraphNode is a resource, group, clone, master or bundle in the dependency
+// graph.
+type GraphNode struct {
+	ID string
+	// Kind is empty if the node is referenced by a constraint but not
+	// configured as a resource.
+	Kind     ResourceKind
+	Parent   string
+	Children []string
+}
+
+// Cycle is a set of resources that depend on each other in a loop.
+type Cycle struct {
+	Kind      DependencyKind
+	Resources []string
+}
+
+// Conflict describes constraints that contradict each other.
+type Conflict struct {
+	// Kind is the kind of the contradicting constraints
+	Kind      DependencyKind
+	Resources []string
+	// Constraints are the contradicting constraints. A -INFINITY
+	// colocation is followed by the INFINITY colocations that place the
+	// resources together, except for the implicit ones of groups.
+	Constraints []string
+	Reason      string
+}
+
+// DependencyGraph is a graph of the order and colocation relationships
+// between resources.
+type DependencyGraph struct {
+	nodes map[string]*GraphNode
+	// ids contains the node IDs in document order
+	ids   []string
+	index map[string]int
+	edges []Dependency
+}
+
+// DependencyGraph builds a dependency graph from the resources and the
+// order and colocation constraints of the CIB.
+func (c *CIB) DependencyGraph() (*DependencyGraph, error) {
+	resources, err := c.ListResources()
+	if err != nil {
+		return nil, fmt.Errorf("could not list resources: %w", err)
+	}
+
+	cons, err := c.ListConstraints()
+	if err != nil {
+		return nil, fmt.Errorf("could not list constraints: %w", err)
+	}
+
+	return newDependencyGraph(resources, cons), nil
+}
+
+func newDependencyGraph(resources []Resource, cons Constraints) *DependencyGraph {
+	g := &DependencyGraph{
+		nodes: make(map[string]*GraphNode),
+		index: make(map[string]int),
+	}
+
+	for _, rsc := range resources {
+		node := g.addNode(rsc.ID)
+		node.Kind = rsc.Kind
+		node.Parent = rsc.Parent
+		node.Children = rsc.Children
+
+		if rsc.Kind == KindGroup {
+			for i := 1; i < len(rsc.Children); i++ {
+				for _, kind := range []DependencyKind{DependencyOrder, DependencyColocation} {
+					g.edges = append(g.edges, Dependency{
+						From:       rsc.Children[i-1],
+						To:         rsc.Children[i],
+						Kind:       kind,
+						Score:      ScoreInfinity,
+						Constraint: rsc.ID,
+						Implicit:   true,
+					})
+				}
+			}
+		}
+	}
+
+	for _, col := range cons.Colocations {
+		score, _ := ParseScore(col.Score)
+		if col.Rsc != "" && col.WithRsc != "" {
+			g.addEdge(col.WithRsc, col.Rsc, DependencyColocation, score, col.ID)
+		}
+
+		// The members of a sequential set are placed first to last, but
+		// multiple sets are placed last to first.
+		for i, set := range col.Sets {
+			if set.Sequential {
+				for j := 1; j < len(set.Resources); j++ {
+					g.addEdge(set.Resources[j-1], set.Resources[j], DependencyColocation, score, col.ID)
+				}
+			}
+			if i+1 < len(col.Sets) {
+				for _, from := range col.Sets[i+1].Resources {
+					for _, to := range set.Resources {
+						g.addEdge(from, to, DependencyColocation, score, col.ID)
+					}
+				}
+			}
+		}
+	}
+
+	for _, ord := range cons.Orders {
+		score := ord.orderScore()
+		if ord.First != "" && ord.Then != "" {
+			g.addEdge(ord.First, ord.Then, DependencyOrder, score, ord.ID)
+		}
+
+		for i, set := range ord.Sets {
+			if set.Sequential {
+				for j := 1; j < len(set.Resources); j++ {
+					g.addEdge(set.Resources[j-1], set.Resources[j], DependencyOrder, score, ord.ID)
+				}
+			}
+			if i+1 < len(ord.Sets) {
+				for _, from := range set.Resources {
+					for _, to := range ord.Sets[i+1].Resources {
+						g.addEdge(from, to, DependencyOrder, score, ord.ID)
+					}
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+func (g *DependencyGraph) addNode(id string) *GraphNode {
+	if node, ok := g.nodes[id]; ok {
+		return node
+	}
+	node := &GraphNode{ID: id}
+	g.nodes[id] = node
+	g.index[id] = len(g.ids)
+	g.ids = append(g.ids, id)
+	return node
+}
+
+func (g *DependencyGraph) addEdge(from, to string, kind DependencyKind, score Score, constraint string) {
+	g.addNode(from)
+	g.addNode(to)
+	g.edges = append(g.edges, Dependency{
+		From:       from,
+		To:         to,
+		Kind:       kind,
+		Score:      score,
+		Constraint: constraint,
+	})
+}
+
+// Node returns the graph node with the given ID.
+func (g *DependencyGraph) Node(id string) (GraphNode, bool) {
+	node, ok := g.nodes[id]
+	if !ok {
+		return GraphNode{}, false
+	}
+	return *node, true
+}
+
+// Nodes returns all nodes of the graph in document order.
+func (g *DependencyGraph) Nodes() []GraphNode {
+	nodes := make([]GraphNode, 0, len(g.ids))
+	for _, id := range g.ids {
+		nodes = append(nodes, *g.nodes[id])
+	}
+	return nodes
+}
+
+// Edges returns all dependencies of the graph.
+func (g *DependencyGraph) Edges() []Dependency {
+	return append([]Dependency(nil), g.edges...)
+}
+
+// StartOrder returns all nodes of the graph sorted so that every resource
+// comes after the resources it is ordered after. Resources without an order
+// relationship keep their document order. If the order constraints contain
+// a loop, ErrDependencyCycle is returned.
+func (g *DependencyGraph) StartOrder() ([]string, error) {
+	edges := g.startEdges()
+	inDegree := make(map[string]int)
+	for _, e := range edges {
+		inDegree[e.To]++
+	}
+
+	var ready []string
+	for _, id := range g.ids {
+		if inDegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	var result []string
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		result = append(result, id)
+
+		for _, e := range edges {
+			if e.From != id {
+				continue
+			}
+			inDegree[e.To]--
+			if inDegree[e.To] == 0 {
+				ready = append(ready, e.To)
+				g.sortByDocument(ready)
+			}
+		}
+	}
+
+	if len(result) < len(g.ids) {
+		var remaining []string
+		for _, id := range g.ids {
+			if inDegree[id] > 0 {
+				remaining = append(remaining, id)
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(remaining, ", "))
+	}
+
+	return result, nil
+}
+
+// startEdges returns the order dependencies, extended so that containers
+// start before their members and everything ordered after a container
+// starts after all of its members.
+func (g *DependencyGraph) startEdges() []Dependency {
+	var edges []Dependency
+	for _, id := range g.ids {
+		for _, child := range g.nodes[id].Children {
+			edges = append(edges, Dependency{From: id, To: child, Kind: DependencyOrder, Implicit: true})
+		}
+	}
+	for _, e := range g.edges {
+		if e.Kind != DependencyOrder {
+			continue
+		}
+		edges = append(edges, e)
+		for _, descendant := range g.descendants(e.From) {
+			if descendant == e.To {
+				continue
+			}
+			edges = append(edges, Dependency{From: descendant, To: e.To, Kind: DependencyOrder, Implicit: true})
+		}
+	}
+	return edges
+}
+
+// StopOrder returns all nodes of the graph in the order they have to be
+// stopped, which is the reverse of StartOrder.
+func (g *DependencyGraph) StopOrder() ([]string, error) {
+	order, err := g.StartOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order, nil
+}
+
+// Cycles finds all loops of order or colocation dependencies.
+func (g *DependencyGraph) Cycles() []Cycle {
+	var cycles []Cycle
+	for _, kind := range []DependencyKind{DependencyOrder, DependencyColocation} {
+		for _, scc := range g.stronglyConnected(kind) {
+			cycles = append(cycles, Cycle{Kind: kind, Resources: scc})
+		}
+	}
+	return cycles
+}
+
+// stronglyConnected returns all strongly connected components of the graph
+// restricted to one dependency kind that form a loop, using Tarjan's
+// algorithm.
+func (g *DependencyGraph) stronglyConnected(kind DependencyKind) [][]string {
+	adjacent := make(map[string][]string)
+	selfLoop := make(map[string]bool)
+	for _, e := range g.edges {
+		if e.Kind != kind {
+			continue
+		}
+		if e.From == e.To {
+			selfLoop[e.From] = true
+		}
+		adjacent[e.From] = append(adjacent[e.From], e.To)
+	}
+
+	counter := 0
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var result [][]string
+
+	var connect func(id string)
+	connect = func(id string) {
+		index[id] = counter
+		lowlink[id] = counter
+		counter++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, next := range adjacent[id] {
+			if _, visited := index[next]; !visited {
+				connect(next)
+				if lowlink[next] < lowlink[id] {
+					lowlink[id] = lowlink[next]
+				}
+			} else if onStack[next] && index[next] < lowlink[id] {
+				lowlink[id] = index[next]
+			}
+		}
+
+		if lowlink[id] != index[id] {
+			return
+		}
+
+		var scc []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc = append(scc, top)
+			if top == id {
+				break
+			}
+		}
+		if len(scc) > 1 || selfLoop[id] {
+			g.sortByDocument(scc)
+			result = append(result, scc)
+		}
+	}
+
+	for _, id := range g.ids {
+		if _, visited := index[id]; !visited {
+			connect(id)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return g.index[result[i][0]] < g.index[result[j][0]]
+	})
+	return result
+}
+
+// Conflicts finds constraints that cannot be satisfied at the same time:
+// colocations of the same two resources with opposite scores, -INFINITY
+// colocations between resources that are mandatorily colocated through
+// other constraints, and loops of mandatory order constraints.
+func (g *DependencyGraph) Conflicts() []Conflict {
+	var conflicts []Conflict
+
+	type pairScores struct {
+		positive []string
+		negative []string
+	}
+	var pairs []string
+	byPair := make(map[string]*pairScores)
+	reported := make(map[string]bool)
+
+	for _, e := range g.edges {
+		if e.Kind != DependencyColocation || e.From == e.To {
+			continue
+		}
+
+		a, b := e.From, e.To
+		if g.index[a] > g.index[b] {
+			a, b = b, a
+		}
+		key := a + "\x00" + b
+		scores, ok := byPair[key]
+		if !ok {
+			scores = &pairScores{}
+			byPair[key] = scores
+			pairs = append(pairs, key)
+		}
+		if e.Score > 0 {
+			scores.positive = appendUnique(scores.positive, e.Constraint)
+		} else if e.Score < 0 {
+			scores.negative = appendUnique(scores.negative, e.Constraint)
+		}
+	}
+
+	for _, key := range pairs {
+		scores := byPair[key]
+		if len(scores.positive) == 0 || len(scores.negative) == 0 {
+			continue
+		}
+		reported[key] = true
+		conflicts = append(conflicts, Conflict{
+			Kind:        DependencyColocation,
+			Resources:   strings.Split(key, "\x00"),
+			Constraints: append(scores.positive, scores.negative...),
+			Reason:      "colocation constraints with opposite scores",
+		})
+	}
+
+	for _, e := range g.edges {
+		if e.Kind != DependencyColocation || e.Score > ScoreMinusInfinity || e.From == e.To {
+			continue
+		}
+		a, b := e.From, e.To
+		if g.index[a] > g.index[b] {
+			a, b = b, a
+		}
+		key := a + "\x00" + b
+		if reported[key] {
+			continue
+		}
+		chain, ok := g.colocationChain(a, b)
+		if !ok {
+			continue
+		}
+		reported[key] = true
+		conflicts = append(conflicts, Conflict{
+			Kind:        DependencyColocation,
+			Resources:   []string{a, b},
+			Constraints: append([]string{e.Constraint}, chain...),
+			Reason:      "resources must not run together but are colocated with INFINITY through other constraints",
+		})
+	}
+
+	for _, scc := range g.stronglyConnected(DependencyOrder) {
+		members := make(map[string]bool)
+		for _, id := range scc {
+			members[id] = true
+		}
+
+		var constraints []string
+		mandatory := true
+		for _, e := range g.edges {
+			if e.Kind != DependencyOrder || !members[e.From] || !members[e.To] {
+				continue
+			}
+			if e.Score <= 0 {
+				mandatory = false
+			}
+			constraints = appendUnique(constraints, e.Constraint)
+		}
+		if !mandatory {
+			continue
+		}
+		conflicts = append(conflicts, Conflict{
+			Kind:        DependencyOrder,
+			Resources:   scc,
+			Constraints: constraints,
+			Reason:      "mandatory order constraints form a loop",
+		})
+	}
+
+	return conflicts
+}
+
+// colocationChain finds a path of INFINITY colocations between two
+// resources, regardless of their direction. It returns the constraints
+// along the path, without the implicit colocations of groups, and false if
+// there is no such path.
+func (g *DependencyGraph) colocationChain(from, to string) ([]string, bool) {
+	via := map[string]*Dependency{from: nil}
+	queue := []string{from}
+	for len(queue) > 0 && via[to] == nil {
+		id := queue[0]
+		queue = queue[1:]
+		for i := range g.edges {
+			e := &g.edges[i]
+			if e.Kind != DependencyColocation || e.Score < ScoreInfinity {
+				continue
+			}
+			next := e.To
+			if e.To == id {
+				next = e.From
+			} else if e.From != id {
+				continue
+			}
+			if _, ok := via[next]; ok {
+				continue
+			}
+			via[next] = e
+			queue = append(queue, next)
+		}
+	}
+	if _, ok := via[to]; !ok || from == to {
+		return nil, false
+	}
+
+	var chain []string
+	for id := to; id != from; {
+		e := via[id]
+		if !e.Implicit {
+			chain = append([]string{e.Constraint}, chain...)
+		}
+		if e.From == id {
+			id = e.To
+		} else {
+			id = e.From
+		}
+	}
+	return chain, true
+}
+
+// Dependents returns all resources that transitively depend on the given
+// resource through order or colocation constraints, in document order.
+//
+// Dependencies of the groups and clones containing the resource are taken
+// into account, and the members of a dependent group or clone are part of
+// the result as well.
+func (g *DependencyGraph) Dependents(id string) []string {
+	excluded := map[string]bool{id: true}
+	queue := []string{id}
+	for _, ancestor := range g.ancestors(id) {
+		excluded[ancestor] = true
+		queue = append(queue, ancestor)
+	}
+	for _, descendant := range g.descendants(id) {
+		excluded[descendant] = true
+		queue = append(queue, descendant)
+	}
+
+	visited := make(map[string]bool)
+	for _, q := range queue {
+		visited[q] = true
+	}
+
+	var result []string
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, e := range g.edges {
+			if e.From != current {
+				continue
+			}
+			reached := append([]string{e.To}, g.descendants(e.To)...)
+			for _, r := range reached {
+				if visited[r] {
+					continue
+				}
+				visited[r] = true
+				queue = append(queue, r)
+				if !excluded[r] {
+					result = append(result, r)
+				}
+			}
+		}
+	}
+
+	g.sortByDocument(result)
+	return result
+}
+
+func (g *DependencyGraph) ancestors(id string) []string {
+	var result []string
+	node, ok := g.nodes[id]
+	for ok && node.Parent != "" {
+		result = append(result, node.Parent)
+		node, ok = g.nodes[node.Parent]
+	}
+	return result
+}
+
+func (g *DependencyGraph) descendants(id string) []string {
+	var result []string
+	node, ok := g.nodes[id]
+	if !ok {
+		return nil
+	}
+	for _, child := range node.Children {
+		result = append(result, child)
+		result = append(result, g.descendants(child)...)
+	}
+	return result
+}
+
+func (g *DependencyGraph) sortByDocument(ids []string) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		return g.index[ids[i]] < g.index[ids[j]]
+	})
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format. Groups, clones and
+// bundles are drawn as clusters around their members, order dependencies as
+// solid and colocation dependencies as dashed edges labelled with their
+// score.
+func (g *DependencyGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("digraph dependencies {\n")
+	for _, id := range g.ids {
+		if g.nodes[id].Parent == "" {
+			g.writeDOTNode(&b, id, "\t")
+		}
+	}
+	for _, e := range g.edges {
+		style := "solid"
+		if e.Kind == DependencyColocation {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s, style=%s];\n",
+			dotQuote(e.From), dotQuote(e.To), dotQuote(e.Score.String()), style)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g *DependencyGraph) writeDOTNode(b *strings.Builder, id, indent string) {
+	node := g.nodes[id]
+
+	shape := "box"
+	switch node.Kind {
+	case KindGroup, KindClone, KindMaster, KindBundle:
+		shape = "folder"
+	case "":
+		shape = "box, style=dotted"
+	}
+
+	if len(node.Children) == 0 {
+		fmt.Fprintf(b, "%s%s [shape=%s];\n", indent, dotQuote(id), shape)
+		return
+	}
+
+	fmt.Fprintf(b, "%ssubgraph %s {\n", indent, dotQuote("cluster_"+id))
+	fmt.Fprintf(b, "%s\tlabel=%s;\n", indent, dotQuote(id))
+	fmt.Fprintf(b, "%s\t%s [shape=%s];\n", indent, dotQuote(id), shape)
+	for _, child := range node.Children {
+		g.writeDOTNode(b, child, indent+"\t")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -0,0 +1,227 @@
+package cib
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const graphTestXML = `<cib><configuration>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2"/>
+	<primitive id="p_pblock" class="ocf" provider="heartbeat" type="portblock"/>
+	<group id="g_target">
+		<primitive id="p_target" class="ocf" provider="heartbeat" type="iSCSITarget"/>
+		<primitive id="p_lu1" class="ocf" provider="heartbeat" type="iSCSILogicalUnit"/>
+	</group>
+	<primitive id="p_punblock" class="ocf" provider="heartbeat" type="portblock"/>
+	<primitive id="p_other" class="ocf" provider="heartbeat" type="Dummy"/>
+</resources>
+<constraints>
+	<rsc_order id="o_pblock" score="INFINITY" first="p_ip" then="p_pblock"/>
+	<rsc_order id="o_target" score="INFINITY" first="p_pblock" then="g_target"/>
+	<rsc_order id="o_punblock" kind="Mandatory" first="g_target" then="p_punblock"/>
+	<rsc_colocation id="co_pblock" score="INFINITY" rsc="p_pblock" with-rsc="p_ip"/>
+	<rsc_colocation id="co_target" score="INFINITY" rsc="g_target" with-rsc="p_pblock"/>
+	<rsc_colocation id="co_punblock" score="INFINITY" rsc="p_punblock" with-rsc="p_ip"/>
+</constraints>
+</configuration></cib>`
+
+func readGraph(t *testing.T, xml string) *DependencyGraph {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	g, err := cib.DependencyGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestDependencyGraphOrder(t *testing.T) {
+	g := readGraph(t, graphTestXML)
+
+	start, err := g.StartOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"p_ip", "p_pblock", "g_target", "p_target", "p_lu1", "p_punblock", "p_other"}
+	if !cmp.Equal(start, expect) {
+		t.Errorf("Unexpected start order")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", start)
+	}
+
+	stop, err := g.StopOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"p_other", "p_punblock", "p_lu1", "p_target", "g_target", "p_pblock", "p_ip"}
+	if !cmp.Equal(stop, expect) {
+		t.Errorf("Unexpected stop order")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", stop)
+	}
+}
+
+func TestDependencyGraphDependents(t *testing.T) {
+	g := readGraph(t, graphTestXML)
+
+	cases := []struct {
+		desc   string
+		id     string
+		expect []string
+	}{{
+		desc:   "start of the chain",
+		id:     "p_ip",
+		expect: []string{"p_pblock", "g_target", "p_target", "p_lu1", "p_punblock"},
+	}, {
+		desc:   "group member inherits group dependents",
+		id:     "p_target",
+		expect: []string{"p_lu1", "p_punblock"},
+	}, {
+		desc:   "last group member",
+		id:     "p_lu1",
+		expect: []string{"p_punblock"},
+	}, {
+		desc:   "end of the chain",
+		id:     "p_punblock",
+		expect: nil,
+	}, {
+		desc:   "unrelated resource",
+		id:     "p_other",
+		expect: nil,
+	}}
+
+	for _, c := range cases {
+		actual := g.Dependents(c.id)
+		if !cmp.Equal(actual, c.expect) {
+			t.Errorf("Dependents do not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %v", c.expect)
+			t.Errorf("Actual: %v", actual)
+		}
+	}
+}
+
+func TestDependencyGraphResourceSets(t *testing.T) {
+	xml := `<cib><configuration><resources/><constraints>
+	<rsc_order id="o_set" score="INFINITY">
+		<resource_set id="o_set-0"><resource_ref id="A"/><resource_ref id="B"/></resource_set>
+		<resource_set id="o_set-1" sequential="false"><resource_ref id="C"/><resource_ref id="D"/></resource_set>
+	</rsc_order>
+	<rsc_colocation id="co_set" score="INFINITY">
+		<resource_set id="co_set-0"><resource_ref id="A"/><resource_ref id="B"/></resource_set>
+		<resource_set id="co_set-1"><resource_ref id="C"/></resource_set>
+	</rsc_colocation>
+	</constraints></configuration></cib>`
+	g := readGraph(t, xml)
+
+	var order, colocation []string
+	for _, e := range g.Edges() {
+		edge := e.From + "->" + e.To
+		if e.Kind == DependencyOrder {
+			order = append(order, edge)
+		} else {
+			colocation = append(colocation, edge)
+		}
+	}
+
+	expect := []string{"A->B", "A->C", "A->D", "B->C", "B->D"}
+	if !cmp.Equal(order, expect) {
+		t.Errorf("Unexpected order edges")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", order)
+	}
+
+	expect = []string{"A->B", "C->A", "C->B"}
+	if !cmp.Equal(colocation, expect) {
+		t.Errorf("Unexpected colocation edges")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", colocation)
+	}
+}
+
+func TestDependencyGraphConflicts(t *testing.T) {
+	xml := `<cib><configuration><resources>
+		<primitive id="A"/><primitive id="B"/><primitive id="C"/><primitive id="D"/>
+	</resources><constraints>
+		<rsc_colocation id="co_ab" score="INFINITY" rsc="A" with-rsc="B"/>
+		<rsc_colocation id="co_ba" score="-100" rsc="B" with-rsc="A"/>
+		<rsc_colocation id="co_bc" score="INFINITY" rsc="B" with-rsc="C"/>
+		<rsc_colocation id="co_ac" score="-INFINITY" rsc="A" with-rsc="C"/>
+		<rsc_order id="o_cd" first="C" then="D"/>
+		<rsc_order id="o_dc" first="D" then="C"/>
+	</constraints></configuration></cib>`
+	g := readGraph(t, xml)
+
+	expect := []Conflict{{
+		Kind:        DependencyColocation,
+		Resources:   []string{"A", "B"},
+		Constraints: []string{"co_ab", "co_ba"},
+		Reason:      "colocation constraints with opposite scores",
+	}, {
+		Kind:        DependencyColocation,
+		Resources:   []string{"A", "C"},
+		Constraints: []string{"co_ac", "co_ab", "co_bc"},
+		Reason:      "resources must not run together but are colocated with INFINITY through other constraints",
+	}, {
+		Kind:        DependencyOrder,
+		Resources:   []string{"C", "D"},
+		Constraints: []string{"o_cd", "o_dc"},
+		Reason:      "mandatory order constraints form a loop",
+	}}
+
+	actual := g.Conflicts()
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected conflicts")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	cycles := g.Cycles()
+	expectCycles := []Cycle{
+		{Kind: DependencyOrder, Resources: []string{"C", "D"}},
+		{Kind: DependencyColocation, Resources: []string{"A", "B"}},
+	}
+	if !cmp.Equal(cycles, expectCycles) {
+		t.Errorf("Unexpected cycles")
+		t.Errorf("Expected: %+v", expectCycles)
+		t.Errorf("Actual: %+v", cycles)
+	}
+
+	_, err := g.StartOrder()
+	if !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("Expected ErrDependencyCycle, got %v", err)
+	}
+}
+
+func TestDependencyGraphDOT(t *testing.T) {
+	g := readGraph(t, graphTestXML)
+
+	var buf bytes.Buffer
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+
+	expect := []string{
+		"digraph dependencies {",
+		`subgraph "cluster_g_target" {`,
+		`"p_ip" -> "p_pblock" [label="INFINITY", style=solid];`,
+		`"p_ip" -> "p_pblock" [label="INFINITY", style=dashed];`,
+		`"p_target" -> "p_lu1" [label="INFINITY", style=solid];`,
+	}
+	for _, e := range expect {
+		if !strings.Contains(dot, e) {
+			t.Errorf("DOT output does not contain %s", e)
+			t.Errorf("Actual: %s", dot)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// HealthStrategy determines how Pacemaker reacts to node health attributes.
+type HealthStrategy string
+
+const (
+	// HealthStrategyNone ignores node health attributes. This is the default.
+	HealthStrategyNone HealthStrategy = "none"
+	// HealthStrategyMigrateOnRed moves resources away from nodes with any
+	// red health attribute.
+	HealthStrategyMigrateOnRed HealthStrategy = "migrate-on-red"
+	// HealthStrategyOnlyGreen only runs resources on nodes whose health
+	// attributes are all green.
+	HealthStrategyOnlyGreen HealthStrategy = "only-green"
+	// HealthStrategyProgressive adds up the scores of all health attributes
+	// and the base score, using the configured red, yellow and green
+	// scores.
+	HealthStrategyProgressive HealthStrategy = "progressive"
+	// HealthStrategyCustom tracks the health attributes, but does not
+	// apply them to resource placement. Location rules have to refer to the
+	// health attributes instead.
+	HealthStrategyCustom HealthStrategy = "custom"
+)
+
+// healthAttributePrefix is the prefix of node attributes that are
+// interpreted as health attributes.
+const healthAttributePrefix = "#health"
+
+// HealthConfig is the cluster-wide configuration of node health handling.
+type HealthConfig struct {
+	Strategy HealthStrategy
+	// Base is the score every node starts with. It is only used by
+	// HealthStrategyProgressive.
+	Base Score
+	// Red, Yellow and Green are the scores of health attributes with the
+	// respective value. They are only used by HealthStrategyProgressive.
+	Red    Score
+	Yellow Score
+	Green  Score
+}
+
+// NodeHealth is the health of a node as Pacemaker derives it.
+type NodeHealth struct {
+	Node string
+	// Attributes contains the effective health attributes of the node
+	Attributes map[string]string
+	// Score is added to the location score of every resource on the node.
+	// It is always 0 with HealthStrategyNone and HealthStrategyCustom, as
+	// Pacemaker does not apply health scores with these strategies.
+	Score Score
+}
+
+// Allowed reports whether resources may run on the node as far as its
+// health is concerned.
+func (h NodeHealth) Allowed() bool {
+	return h.Score != ScoreMinusInfinity
+}
+
+// GetHealthConfig reads the node health configuration. Unset properties
+// have their Pacemaker default values.
+func (c *CIB) GetHealthConfig() (HealthConfig, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return HealthConfig{}, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return HealthConfig{}, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return healthConfig(root)
+}
+
+// HealthConfigUpdate is a change of the node health configuration.
+// Scores that are nil keep their current value.
+type HealthConfigUpdate struct {
+	Strategy HealthStrategy
+	Base     *Score
+	Red      *Score
+	Yellow   *Score
+	Green    *Score
+}
+
+// SetHealthConfig writes the node health strategy and the scores that are
+// set in the update. Other scores are not modified, so changing only the
+// strategy keeps custom scores.
+func (c *CIB) SetHealthConfig(update HealthConfigUpdate) error {
+	switch update.Strategy {
+	case HealthStrategyNone, HealthStrategyMigrateOnRed, HealthStrategyOnlyGreen,
+		HealthStrategyProgressive, HealthStrategyCustom:
+	default:
+		return fmt.Errorf("invalid node health strategy '%s'", update.Strategy)
+	}
+
+	values := []clusterPropertyValue{{NodeHealthStrategy, string(update.Strategy)}}
+	scores := []struct {
+		prop  ClusterProperty
+		score *Score
+	}{
+		{NodeHealthBase, update.Base},
+		{NodeHealthRed, update.Red},
+		{NodeHealthYellow, update.Yellow},
+		{NodeHealthGreen, update.Green},
+	}
+	for _, s := range scores {
+		if s.score != nil {
+			values = append(values, clusterPropertyValue{s.prop, s.score.String()})
+		}
+	}
+
+	return c.setClusterProperties(values...)
+}
+
+// SetNodeHealth sets a health attribute of a node. The name is prefixed
+// with "#health-" unless it already starts with "#health". The value is
+// either red, yellow, green or a score.
+//
+// Health attributes are usually set by health agents with LifetimeReboot.
+func (c *CIB) SetNodeHealth(node, name, value string, lifetime AttributeLifetime) error {
+	if _, err := healthValueScore(HealthConfig{Strategy: HealthStrategyCustom}, value); err != nil {
+		return err
+	}
+
+	return c.SetNodeAttribute(node, healthAttributeName(name), value, lifetime)
+}
+
+// DeleteNodeHealth removes a health attribute of a node. The name is
+// handled like in SetNodeHealth.
+func (c *CIB) DeleteNodeHealth(node, name string, lifetime AttributeLifetime) error {
+	return c.DeleteNodeAttribute(node, healthAttributeName(name), lifetime)
+}
+
+// GetNodeHealth returns the health attributes and the resulting health
+// score of a node.
+func (c *CIB) GetNodeHealth(node string) (NodeHealth, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return NodeHealth{}, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return NodeHealth{}, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	config, err := healthConfig(root)
+	if err != nil {
+		return NodeHealth{}, err
+	}
+
+	return nodeHealth(root, config, node)
+}
+
+// ListNodeHealth returns the health of all configured nodes.
+func (c *CIB) ListNodeHealth() ([]NodeHealth, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	config, err := healthConfig(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []NodeHealth
+	for _, elem := range root.FindElements("configuration/nodes/node") {
+		uname := elem.SelectAttrValue("uname", "")
+		if uname == "" {
+			continue
+		}
+		health, err := nodeHealth(root, config, uname)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, health)
+	}
+
+	return result, nil
+}
+
+func healthAttributeName(name string) string {
+	if strings.HasPrefix(name, healthAttributePrefix) {
+		return name
+	}
+	return healthAttributePrefix + "-" + name
+}
+
+func healthConfig(root *xmltree.Element) (HealthConfig, error) {
+	// only red has a default other than 0
+	config := HealthConfig{Strategy: HealthStrategyNone, Red: ScoreMinusInfinity}
+	if value := clusterOption(root, "node-health-strategy"); value != "" {
+		config.Strategy = HealthStrategy(value)
+	}
+
+	scores := []struct {
+		name  string
+		score *Score
+	}{
+		{"node-health-base", &config.Base},
+		{"node-health-red", &config.Red},
+		{"node-health-yellow", &config.Yellow},
+		{"node-health-green", &config.Green},
+	}
+	for _, s := range scores {
+		value := clusterOption(root, s.name)
+		if value == "" {
+			continue
+		}
+		score, err := ParseScore(value)
+		if err != nil {
+			return HealthConfig{}, fmt.Errorf("invalid cluster option %s: %w", s.name, err)
+		}
+		*s.score = score
+	}
+
+	return config, nil
+}
+
+func nodeHealth(root *xmltree.Element, config HealthConfig, node string) (NodeHealth, error) {
+	attrs, err := effectiveNodeAttributes(root, node)
+	if err != nil {
+		return NodeHealth{}, err
+	}
+
+	health := NodeHealth{Node: node, Attributes: make(map[string]string)}
+	for name, value := range attrs {
+		if strings.HasPrefix(name, healthAttributePrefix) {
+			health.Attributes[name] = value
+		}
+	}
+
+	health.Score, err = healthScore(config, health.Attributes)
+	if err != nil {
+		return NodeHealth{}, fmt.Errorf("node %s: %w", node, err)
+	}
+
+	return health, nil
+}
+
+// healthScore derives the health score of a node from its health attributes
+// the way Pacemaker's scheduler does.
+func healthScore(config HealthConfig, attrs map[string]string) (Score, error) {
+	switch config.Strategy {
+	case HealthStrategyNone, HealthStrategyCustom, "":
+		return 0, nil
+	}
+
+	var score Score
+	if config.Strategy == HealthStrategyProgressive {
+		score = config.Base
+	}
+
+	// sum in a fixed order, so that errors are deterministic
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := healthValueScore(config, attrs[name])
+		if err != nil {
+			return 0, fmt.Errorf("health attribute %s: %w", name, err)
+		}
+		score = score.Add(value)
+	}
+
+	return score, nil
+}
+
+// healthValueScore converts the value of a single health attribute into a
+// score, according to the strategy.
+func healthValueScore(config HealthConfig, value string) (Score, error) {
+	red, yellow, green := config.Red, config.Yellow, config.Green
+	switch config.Strategy {
+	case HealthStrategyMigrateOnRed:
+		red, yellow, green = ScoreMinusInfinity, 0, 0
+	case HealthStrategyOnlyGreen:
+		red, yellow, green = ScoreMinusInfinity, ScoreMinusInfinity, 0
+	}
+
+	switch strings.ToLower(value) {
+	case "red":
+		return red, nil
+	case "yellow":
+		return yellow, nil
+	case "green":
+		return green, nil
+	}
+
+	score, err := ParseScore(value)
+	if err != nil || value == "" {
+		return 0, fmt.Errorf("invalid health value '%s'", value)
+	}
+	return score, nil
+}
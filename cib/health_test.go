@@ -0,0 +1,284 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHealthScore(t *testing.T) {
+	attrs := map[string]string{
+		"#health-cpu":  "yellow",
+		"#health-disk": "green",
+		"#health-temp": "-20",
+	}
+
+	cases := []struct {
+		desc   string
+		config HealthConfig
+		attrs  map[string]string
+		expect Score
+	}{{
+		desc:   "none",
+		config: HealthConfig{Strategy: HealthStrategyNone},
+		attrs:  map[string]string{"#health-cpu": "red"},
+		expect: 0,
+	}, {
+		desc:   "migrate-on-red with red",
+		config: HealthConfig{Strategy: HealthStrategyMigrateOnRed},
+		attrs:  map[string]string{"#health-cpu": "red", "#health-disk": "green"},
+		expect: ScoreMinusInfinity,
+	}, {
+		desc:   "migrate-on-red with yellow",
+		config: HealthConfig{Strategy: HealthStrategyMigrateOnRed},
+		attrs:  map[string]string{"#health-cpu": "yellow"},
+		expect: 0,
+	}, {
+		desc:   "only-green with yellow",
+		config: HealthConfig{Strategy: HealthStrategyOnlyGreen},
+		attrs:  map[string]string{"#health-cpu": "yellow"},
+		expect: ScoreMinusInfinity,
+	}, {
+		desc:   "progressive",
+		config: HealthConfig{Strategy: HealthStrategyProgressive, Base: 100, Red: -100, Yellow: -10, Green: 5},
+		attrs:  attrs,
+		expect: 75,
+	}, {
+		desc:   "custom is not applied",
+		config: HealthConfig{Strategy: HealthStrategyCustom, Base: 100, Red: -100, Yellow: -10, Green: 5},
+		attrs:  attrs,
+		expect: 0,
+	}}
+
+	for _, c := range cases {
+		actual, err := healthScore(c.config, c.attrs)
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("Score does not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %s", c.expect)
+			t.Errorf("Actual: %s", actual)
+		}
+	}
+
+	_, err := healthScore(HealthConfig{Strategy: HealthStrategyProgressive}, map[string]string{"#health-cpu": "purple"})
+	if err == nil {
+		t.Errorf("Expected error for invalid health value")
+	}
+}
+
+func TestNodeHealth(t *testing.T) {
+	xml := `<cib><configuration>
+	<crm_config>
+		<cluster_property_set id="cib-bootstrap-options">
+			<nvpair id="cib-bootstrap-options-node-health-strategy" name="node-health-strategy" value="migrate-on-red"/>
+		</cluster_property_set>
+	</crm_config>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2">
+			<instance_attributes id="nodes-2">
+				<nvpair id="nodes-2-.health-disk" name="#health-disk" value="green"/>
+			</instance_attributes>
+		</node>
+	</nodes>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1">
+			<transient_attributes id="1">
+				<instance_attributes id="status-1">
+					<nvpair id="status-1-.health-cpu" name="#health-cpu" value="red"/>
+					<nvpair id="status-1-site" name="site" value="a"/>
+				</instance_attributes>
+			</transient_attributes>
+		</node_state>
+	</status></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.ListNodeHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []NodeHealth{{
+		Node:       "la1",
+		Attributes: map[string]string{"#health-cpu": "red"},
+		Score:      ScoreMinusInfinity,
+	}, {
+		Node:       "la2",
+		Attributes: map[string]string{"#health-disk": "green"},
+		Score:      0,
+	}}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected node health")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+	if actual[0].Allowed() || !actual[1].Allowed() {
+		t.Errorf("Unexpected allowed nodes")
+	}
+
+	var args []string
+	attributeCommand = &argsCommand{
+		func(_ string, a []string) (string, string, error) {
+			args = a
+			return "", "", nil
+		},
+	}
+	if err := cib.SetNodeHealth("la2", "cpu", "yellow", LifetimeReboot); err != nil {
+		t.Fatal(err)
+	}
+	expectArgs := []string{"--node", "la2", "--name", "#health-cpu", "--update", "yellow"}
+	if !cmp.Equal(args, expectArgs) {
+		t.Errorf("Unexpected arguments: %v", args)
+	}
+	if err := cib.SetNodeHealth("la2", "cpu", "purple", LifetimeReboot); err == nil {
+		t.Errorf("Expected error for invalid health value")
+	}
+}
+
+func TestGetHealthConfig(t *testing.T) {
+	cases := []struct {
+		desc   string
+		xml    string
+		expect HealthConfig
+		// redAllowed tells whether a node with a red health attribute may
+		// run resources
+		redAllowed bool
+	}{{
+		desc:       "unset",
+		xml:        `<cib><configuration><crm_config/></configuration></cib>`,
+		expect:     HealthConfig{Strategy: HealthStrategyNone, Red: ScoreMinusInfinity},
+		redAllowed: true,
+	}, {
+		desc: "progressive with yellow",
+		xml: `<cib><configuration><crm_config>
+			<cluster_property_set id="cib-bootstrap-options">
+				<nvpair id="cib-bootstrap-options-node-health-strategy" name="node-health-strategy" value="progressive"/>
+				<nvpair id="cib-bootstrap-options-node-health-yellow" name="node-health-yellow" value="-10"/>
+			</cluster_property_set>
+		</crm_config></configuration></cib>`,
+		expect: HealthConfig{Strategy: HealthStrategyProgressive, Red: ScoreMinusInfinity, Yellow: -10},
+	}, {
+		desc: "red set",
+		xml: `<cib><configuration><crm_config>
+			<cluster_property_set id="cib-bootstrap-options">
+				<nvpair id="cib-bootstrap-options-node-health-strategy" name="node-health-strategy" value="progressive"/>
+				<nvpair id="cib-bootstrap-options-node-health-red" name="node-health-red" value="-100"/>
+			</cluster_property_set>
+		</crm_config></configuration></cib>`,
+		expect:     HealthConfig{Strategy: HealthStrategyProgressive, Red: -100},
+		redAllowed: true,
+	}}
+
+	for _, c := range cases {
+		xml := c.xml
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return xml, "", nil
+			},
+		}
+
+		var cib CIB
+		actual, err := cib.GetHealthConfig()
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("Config does not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %+v", c.expect)
+			t.Errorf("Actual: %+v", actual)
+		}
+
+		score, err := healthScore(actual, map[string]string{"#health-cpu": "red"})
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if allowed := (NodeHealth{Score: score}).Allowed(); allowed != c.redAllowed {
+			t.Errorf("Red node allowed is %t for case \"%s\"", allowed, c.desc)
+		}
+	}
+}
+
+func TestSetHealthConfig(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return `<cib><configuration><crm_config>
+				<cluster_property_set id="cib-bootstrap-options">
+					<nvpair id="cib-bootstrap-options-node-health-green" name="node-health-green" value="5"/>
+				</cluster_property_set>
+			</crm_config></configuration></cib>`, "", nil
+		},
+	}
+
+	var actual string
+	updates := 0
+	updateCommand = &testCommand{
+		func(stdin string) (string, string, error) {
+			updates++
+			actual = stdin
+			return "", "", nil
+		},
+	}
+
+	expect := `<cib><configuration><crm_config>
+		<cluster_property_set id="cib-bootstrap-options">
+			<nvpair id="cib-bootstrap-options-node-health-green" name="node-health-green" value="5"/>
+			<nvpair id="cib-bootstrap-options-node-health-strategy" name="node-health-strategy" value="progressive"/>
+			<nvpair id="cib-bootstrap-options-node-health-base" name="node-health-base" value="100"/>
+			<nvpair id="cib-bootstrap-options-node-health-red" name="node-health-red" value="-INFINITY"/>
+			<nvpair id="cib-bootstrap-options-node-health-yellow" name="node-health-yellow" value="-50"/>
+		</cluster_property_set>
+	</crm_config></configuration></cib>`
+
+	base, red, yellow := Score(100), ScoreMinusInfinity, Score(-50)
+	var cib CIB
+	err := cib.SetHealthConfig(HealthConfigUpdate{
+		Strategy: HealthStrategyProgressive,
+		Base:     &base,
+		Red:      &red,
+		Yellow:   &yellow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updates != 1 {
+		t.Errorf("Expected a single update, got %d", updates)
+	}
+	if normExpect, normActual := normalizeXML(t, expect), normalizeXML(t, actual); normActual != normExpect {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", normExpect)
+		t.Errorf("Actual: %s", normActual)
+	}
+
+	// only the strategy is set, the custom green score is kept
+	expect = `<cib><configuration><crm_config>
+		<cluster_property_set id="cib-bootstrap-options">
+			<nvpair id="cib-bootstrap-options-node-health-green" name="node-health-green" value="5"/>
+			<nvpair id="cib-bootstrap-options-node-health-strategy" name="node-health-strategy" value="custom"/>
+		</cluster_property_set>
+	</crm_config></configuration></cib>`
+	cib = CIB{}
+	if err := cib.SetHealthConfig(HealthConfigUpdate{Strategy: HealthStrategyCustom}); err != nil {
+		t.Fatal(err)
+	}
+	if normExpect, normActual := normalizeXML(t, expect), normalizeXML(t, actual); normActual != normExpect {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", normExpect)
+		t.Errorf("Actual: %s", normActual)
+	}
+
+	if err := cib.SetHealthConfig(HealthConfigUpdate{Strategy: "sometimes"}); err == nil {
+		t.Errorf("Expected error for invalid strategy")
+	}
+}
@@ -0,0 +1,128 @@
+package cib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	xmltree "github.com/beevik/etree"
+)
+
+var (
+	ErrInvalidID   = errors.New("invalid ID")
+	ErrIDCollision = errors.New("ID already in use")
+)
+
+// IDAllocator indexes every id attribute in a CIB document and hands out
+// new IDs that do not collide with any of them.
+//
+// Pacemaker requires IDs to be unique across the whole document, not just
+// among siblings, so every element created by this package should get its
+// ID from an allocator created for the document it is inserted into.
+type IDAllocator struct {
+	used map[string]bool
+}
+
+// NewIDAllocator creates an allocator that knows all IDs currently used in
+// the document. A nil document results in an empty index.
+func NewIDAllocator(doc *xmltree.Document) *IDAllocator {
+	a := &IDAllocator{used: make(map[string]bool)}
+	if doc != nil {
+		a.index(&doc.Element)
+	}
+	return a
+}
+
+func (a *IDAllocator) index(elem *xmltree.Element) {
+	if id := elem.SelectAttrValue(cibAttrKeyID, ""); id != "" {
+		a.used[id] = true
+	}
+	for _, child := range elem.ChildElements() {
+		a.index(child)
+	}
+}
+
+// Exists returns true if the ID is used in the document or was handed out
+// by this allocator.
+func (a *IDAllocator) Exists(id string) bool {
+	return a.used[id]
+}
+
+// Reserve marks an ID as used. It fails if the ID is not a valid XML NCName
+// or is already in use.
+func (a *IDAllocator) Reserve(id string) error {
+	if err := ValidateID(id); err != nil {
+		return err
+	}
+	if a.used[id] {
+		return fmt.Errorf("%w: %s", ErrIDCollision, id)
+	}
+	a.used[id] = true
+	return nil
+}
+
+// Allocate builds a conventional ID by joining the parts with "-", e.g.
+// Allocate("p_test", "meta_attributes", "target-role") yields
+// "p_test-meta_attributes-target-role". Characters that are not allowed in
+// IDs are replaced. If the ID is already in use, a numeric suffix is added.
+// The returned ID is reserved.
+func (a *IDAllocator) Allocate(parts ...string) string {
+	base := SanitizeID(strings.Join(parts, "-"))
+
+	id := base
+	for i := 1; a.used[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	a.used[id] = true
+
+	return id
+}
+
+// ValidateID checks that the ID is a valid XML NCName, which is what the
+// Pacemaker schema requires for id attributes.
+func ValidateID(id string) error {
+	if id == "" {
+		return fmt.Errorf("%w: empty ID", ErrInvalidID)
+	}
+	for i, r := range id {
+		if i == 0 && !isNCNameStart(r) {
+			return fmt.Errorf("%w: '%s' must start with a letter or underscore", ErrInvalidID, id)
+		}
+		if !isNCNameChar(r) {
+			return fmt.Errorf("%w: '%s' contains invalid character '%c'", ErrInvalidID, id, r)
+		}
+	}
+	return nil
+}
+
+// SanitizeID turns an arbitrary string into a valid ID. Invalid characters
+// are replaced with '.', like Pacemaker does, and an underscore is prepended
+// if the string does not start with a letter or underscore.
+func SanitizeID(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i == 0 && !isNCNameStart(r) {
+			b.WriteRune('_')
+		}
+		if isNCNameChar(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('.')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func isNCNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNCNameChar(r rune) bool {
+	return isNCNameStart(r) || unicode.IsDigit(r) || r == '-' || r == '.' ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || r == '·'
+}
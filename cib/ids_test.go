@@ -0,0 +1,102 @@
+package cib
+
+import (
+	"errors"
+	"testing"
+
+	xmltree "github.com/beevik/etree"
+)
+
+func TestValidateID(t *testing.T) {
+	cases := []struct {
+		id      string
+		isValid bool
+	}{
+		{"p_test", true},
+		{"_p.test-1", true},
+		{"nodes-1", true},
+		{"", false},
+		{"1node", false},
+		{"-p_test", false},
+		{"ns:p_test", false},
+		{"p test", false},
+	}
+
+	for _, c := range cases {
+		err := ValidateID(c.id)
+		if c.isValid && err != nil {
+			t.Errorf("Unexpected error for '%s': %s", c.id, err)
+		}
+		if !c.isValid && !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Expected ErrInvalidID for '%s', got %v", c.id, err)
+		}
+	}
+}
+
+func TestSanitizeID(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect string
+	}{
+		{"p_test", "p_test"},
+		{"1node", "_1node"},
+		{"ns:p test", "ns.p.test"},
+		{"", "_"},
+	}
+
+	for _, c := range cases {
+		actual := SanitizeID(c.input)
+		if actual != c.expect {
+			t.Errorf("Unexpected ID for '%s'", c.input)
+			t.Errorf("Expected: %s", c.expect)
+			t.Errorf("Actual: %s", actual)
+		}
+		if err := ValidateID(actual); err != nil {
+			t.Errorf("Sanitized ID is invalid: %s", err)
+		}
+	}
+}
+
+func TestIDAllocator(t *testing.T) {
+	doc := xmltree.NewDocument()
+	err := doc.ReadFromString(`<cib><configuration><resources>
+		<primitive id="p_test" class="ocf" provider="heartbeat" type="Dummy">
+			<meta_attributes id="p_test-meta_attributes"/>
+		</primitive>
+		<primitive id="p_test-meta_attributes-1" class="ocf" provider="heartbeat" type="Dummy"/>
+	</resources></configuration></cib>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := NewIDAllocator(doc)
+	if !ids.Exists("p_test") {
+		t.Errorf("Expected p_test to exist")
+	}
+
+	expect := []string{
+		"p_test-meta_attributes-2",
+		"p_test-meta_attributes-3",
+		"p_test-instance_attributes",
+	}
+	actual := []string{
+		ids.Allocate("p_test", "meta_attributes"),
+		ids.Allocate("p_test", "meta_attributes"),
+		ids.Allocate("p_test", "instance_attributes"),
+	}
+	for i := range expect {
+		if actual[i] != expect[i] {
+			t.Errorf("Unexpected ID %d: expected %s, got %s", i, expect[i], actual[i])
+		}
+	}
+
+	if err := ids.Reserve("p_test-instance_attributes"); !errors.Is(err, ErrIDCollision) {
+		t.Errorf("Expected ErrIDCollision, got %v", err)
+	}
+	if err := ids.Reserve("p_new"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if !ids.Exists("p_new") {
+		t.Errorf("Expected p_new to be reserved")
+	}
+}
@@ -0,0 +1,439 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// Severity is the severity of a lint finding.
+type Severity string
+
+const (
+	// SeverityError means that the configuration is broken or cannot be
+	// satisfied
+	SeverityError Severity = "error"
+	// SeverityWarning means that the configuration likely does not do what
+	// was intended
+	SeverityWarning Severity = "warning"
+	// SeverityInfo is a hint that does not need to be acted upon
+	SeverityInfo Severity = "info"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityError:
+		return 2
+	case SeverityWarning:
+		return 1
+	}
+	return 0
+}
+
+// Finding is a single problem reported by Lint.
+type Finding struct {
+	Severity Severity
+	// Check is a short identifier of the check that produced the finding,
+	// e.g. "unknown-resource"
+	Check string
+	// ID is the ID of the offending element
+	ID      string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s [%s]: %s", f.Severity, f.ID, f.Check, f.Message)
+}
+
+// FilterFindings returns the findings with at least the given severity.
+func FilterFindings(findings []Finding, min Severity) []Finding {
+	var result []Finding
+	for _, f := range findings {
+		if f.Severity.rank() >= min.rank() {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Lint checks the CIB for common configuration problems:
+//
+//   - constraints referring to resources or nodes that do not exist
+//   - duplicate constraints and location scores shadowed by INFINITY scores
+//   - contradictory colocation scores and loops of mandatory order constraints
+//   - order constraints without a matching colocation
+//   - leftover cli-ban and cli-prefer constraints from crm_resource
+//   - primitives without a recurring monitor operation
+//   - primitives without any operation timeout
+func (c *CIB) Lint() ([]Finding, error) {
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := c.ListResources()
+	if err != nil {
+		return nil, err
+	}
+
+	cons, err := c.ListConstraints()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	findings = append(findings, lintReferences(root, resources)...)
+	findings = append(findings, lintDuplicates(root)...)
+	findings = append(findings, lintShadowedLocations(cons)...)
+
+	graph := newDependencyGraph(resources, cons)
+	findings = append(findings, lintConflicts(graph)...)
+	findings = append(findings, lintOrderWithoutColocation(graph)...)
+
+	for _, elem := range root.FindElements("configuration/constraints/*") {
+		id := elem.SelectAttrValue(cibAttrKeyID, "")
+		if strings.HasPrefix(id, "cli-ban-") || strings.HasPrefix(id, "cli-prefer-") {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "leftover-cli-constraint",
+				ID:       id,
+				Message:  "constraint was created by crm_resource --move or --ban and should be cleared",
+			})
+		}
+	}
+
+	findings = append(findings, lintOperations(root, resources)...)
+
+	return findings, nil
+}
+
+func lintReferences(root *xmltree.Element, resources []Resource) []Finding {
+	known := make(map[string]bool)
+	for _, rsc := range resources {
+		known[rsc.ID] = true
+	}
+	for _, elem := range root.FindElements("configuration/resources/template") {
+		known[elem.SelectAttrValue(cibAttrKeyID, "")] = true
+	}
+	for _, elem := range root.FindElements("configuration/tags/tag") {
+		known[elem.SelectAttrValue(cibAttrKeyID, "")] = true
+	}
+
+	nodes := make(map[string]bool)
+	for _, elem := range root.FindElements("configuration/nodes/node") {
+		nodes[elem.SelectAttrValue("uname", "")] = true
+	}
+	// guest and remote nodes are not always listed in the nodes section
+	for _, remote := range listRemoteNodes(root) {
+		nodes[remote.Name] = true
+	}
+
+	var findings []Finding
+	for _, elem := range root.FindElements("configuration/constraints/*") {
+		id := elem.SelectAttrValue(cibAttrKeyID, "")
+
+		var refs []string
+		for _, attr := range []string{"rsc", "with-rsc", "first", "then"} {
+			if ref := elem.SelectAttrValue(attr, ""); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+		for _, ref := range elem.FindElements("resource_set/resource_ref") {
+			refs = append(refs, ref.SelectAttrValue(cibAttrKeyID, ""))
+		}
+		for _, ref := range refs {
+			if !known[ref] {
+				findings = append(findings, Finding{
+					Severity: SeverityError,
+					Check:    "unknown-resource",
+					ID:       id,
+					Message:  fmt.Sprintf("constraint refers to resource %s, which does not exist", ref),
+				})
+			}
+		}
+
+		if elem.Tag != cibTagLocation {
+			continue
+		}
+		if node := elem.SelectAttrValue("node", ""); node != "" && !nodes[node] {
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Check:    "unknown-node",
+				ID:       id,
+				Message:  fmt.Sprintf("constraint refers to node %s, which does not exist", node),
+			})
+		}
+		for _, expr := range elem.FindElements(".//expression[@attribute='#uname']") {
+			node := expr.SelectAttrValue(cibAttrKeyValue, "")
+			if expr.SelectAttrValue("value-source", "literal") != "literal" || nodes[node] {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "unknown-node",
+				ID:       expr.SelectAttrValue(cibAttrKeyID, id),
+				Message:  fmt.Sprintf("rule expression refers to node %s, which does not exist", node),
+			})
+		}
+	}
+
+	for _, elem := range root.FindElements("configuration/fencing-topology/fencing-level") {
+		target := elem.SelectAttrValue("target", "")
+		if target == "" || nodes[target] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Severity: SeverityError,
+			Check:    "unknown-node",
+			ID:       elem.SelectAttrValue(cibAttrKeyID, ""),
+			Message:  fmt.Sprintf("fencing level refers to node %s, which does not exist", target),
+		})
+	}
+
+	return findings
+}
+
+// lintDuplicates reports constraints that are identical to an earlier one
+// apart from their IDs.
+func lintDuplicates(root *xmltree.Element) []Finding {
+	var findings []Finding
+	seen := make(map[string]string)
+	for _, elem := range root.FindElements("configuration/constraints/*") {
+		id := elem.SelectAttrValue(cibAttrKeyID, "")
+		sig := elementSignature(elem)
+		if first, ok := seen[sig]; ok {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "duplicate-constraint",
+				ID:       id,
+				Message:  fmt.Sprintf("constraint is a duplicate of %s", first),
+			})
+			continue
+		}
+		seen[sig] = id
+	}
+	return findings
+}
+
+// elementSignature serializes an element with all of its attributes except
+// IDs, so that elements that only differ in their IDs compare equal.
+func elementSignature(elem *xmltree.Element) string {
+	var attrs []string
+	for _, attr := range elem.Attr {
+		if attr.Key == cibAttrKeyID {
+			continue
+		}
+		attrs = append(attrs, attr.Key+"="+attr.Value)
+	}
+	sort.Strings(attrs)
+
+	var b strings.Builder
+	b.WriteString("<" + elem.Tag + " " + strings.Join(attrs, " ") + ">")
+	for _, child := range elem.ChildElements() {
+		b.WriteString(elementSignature(child))
+	}
+	b.WriteString("</" + elem.Tag + ">")
+	return b.String()
+}
+
+// lintShadowedLocations reports location scores that have no effect because
+// an INFINITY or -INFINITY score for the same resource and node exists.
+func lintShadowedLocations(cons Constraints) []Finding {
+	type key struct{ rsc, node, role string }
+	var keys []key
+	byKey := make(map[key][]LocationConstraint)
+	for _, loc := range cons.Locations {
+		if loc.Rsc == "" || loc.Node == "" {
+			continue
+		}
+		k := key{loc.Rsc, loc.Node, loc.Role}
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], loc)
+	}
+
+	var findings []Finding
+	for _, k := range keys {
+		locs := byKey[k]
+		if len(locs) < 2 {
+			continue
+		}
+
+		var positive, negative string
+		for _, loc := range locs {
+			score, _ := ParseScore(loc.Score)
+			if score >= ScoreInfinity && positive == "" {
+				positive = loc.ID
+			}
+			if score <= ScoreMinusInfinity && negative == "" {
+				negative = loc.ID
+			}
+		}
+
+		if positive != "" && negative != "" {
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Check:    "contradictory-location",
+				ID:       positive,
+				Message:  fmt.Sprintf("resource %s must run on node %s, but %s bans it from there", k.rsc, k.node, negative),
+			})
+		}
+
+		shadowing := negative
+		if shadowing == "" {
+			shadowing = positive
+		}
+		if shadowing == "" {
+			continue
+		}
+		for _, loc := range locs {
+			score, _ := ParseScore(loc.Score)
+			if score.IsInfinite() {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "shadowed-constraint",
+				ID:       loc.ID,
+				Message:  fmt.Sprintf("score has no effect because of %s", shadowing),
+			})
+		}
+	}
+
+	return findings
+}
+
+func lintConflicts(graph *DependencyGraph) []Finding {
+	var findings []Finding
+	for _, conflict := range graph.Conflicts() {
+		check := "contradictory-colocation"
+		if conflict.Kind == DependencyOrder {
+			check = "order-loop"
+		}
+		reason := fmt.Sprintf("%s (%s)", conflict.Reason, strings.Join(conflict.Resources, ", "))
+		// one finding per constraint, so that every ID refers to an element
+		for _, id := range conflict.Constraints {
+			var others []string
+			for _, other := range conflict.Constraints {
+				if other != id {
+					others = append(others, other)
+				}
+			}
+			message := reason
+			if len(others) > 0 {
+				message += " together with " + strings.Join(others, ", ")
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityError,
+				Check:    check,
+				ID:       id,
+				Message:  message,
+			})
+		}
+	}
+	return findings
+}
+
+// lintOrderWithoutColocation reports order constraints between resources
+// that are not colocated. This is often intended, but just as often a
+// forgotten colocation.
+func lintOrderWithoutColocation(graph *DependencyGraph) []Finding {
+	colocated := make(map[string]bool)
+	for _, e := range graph.Edges() {
+		if e.Kind == DependencyColocation {
+			colocated[e.From+"\x00"+e.To] = true
+			colocated[e.To+"\x00"+e.From] = true
+		}
+	}
+
+	var findings []Finding
+	reported := make(map[string]bool)
+	for _, e := range graph.Edges() {
+		if e.Kind != DependencyOrder || e.Implicit || reported[e.Constraint] {
+			continue
+		}
+		if colocated[e.From+"\x00"+e.To] {
+			continue
+		}
+		reported[e.Constraint] = true
+		findings = append(findings, Finding{
+			Severity: SeverityInfo,
+			Check:    "order-without-colocation",
+			ID:       e.Constraint,
+			Message:  fmt.Sprintf("%s is ordered after %s, but the two are not colocated", e.To, e.From),
+		})
+	}
+	return findings
+}
+
+func lintOperations(root *xmltree.Element, resources []Resource) []Finding {
+	templates := make(map[string]Resource)
+	for _, elem := range root.FindElements("configuration/resources/template") {
+		tmpl := parseResource(elem, "")
+		templates[tmpl.ID] = tmpl
+	}
+
+	defaultTimeout := false
+	for _, nvpair := range root.FindElements("configuration/op_defaults/meta_attributes/nvpair[@name='timeout']") {
+		if nvpair.SelectAttrValue(cibAttrKeyValue, "") != "" {
+			defaultTimeout = true
+		}
+	}
+
+	var findings []Finding
+	for _, rsc := range resources {
+		if rsc.Kind != KindPrimitive {
+			continue
+		}
+
+		ops := rsc.Operations
+		if tmpl, ok := templates[rsc.Template]; ok {
+			ops = append(ops, tmpl.Operations...)
+		}
+
+		hasMonitor := false
+		var withoutTimeout []string
+		for _, op := range ops {
+			if op.Name == cibAttrValueMonitor && op.Interval != "" && op.Interval != "0" && op.Interval != "0s" {
+				hasMonitor = true
+			}
+			if op.Timeout == "" {
+				withoutTimeout = append(withoutTimeout, op.Name)
+			}
+		}
+
+		if !hasMonitor {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "missing-monitor",
+				ID:       rsc.ID,
+				Message:  "resource has no recurring monitor operation, failures will not be detected",
+			})
+		}
+
+		if defaultTimeout {
+			continue
+		}
+		if len(ops) == 0 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "missing-timeout",
+				ID:       rsc.ID,
+				Message:  "resource has no operations and no default timeout is configured",
+			})
+		} else if len(withoutTimeout) > 0 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    "missing-timeout",
+				ID:       rsc.ID,
+				Message: fmt.Sprintf("operations without timeout and no default timeout configured: %s",
+					strings.Join(withoutTimeout, ", ")),
+			})
+		}
+	}
+
+	return findings
+}
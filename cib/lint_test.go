@@ -0,0 +1,201 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	xml := `<cib><configuration>
+<nodes>
+	<node id="1" uname="node1"/>
+	<node id="2" uname="node2"/>
+</nodes>
+<resources>
+	<primitive id="p_ok" class="ocf" provider="heartbeat" type="Dummy">
+		<operations>
+			<op id="p_ok-start" name="start" interval="0" timeout="20s"/>
+			<op id="p_ok-monitor" name="monitor" interval="10s" timeout="20s"/>
+		</operations>
+	</primitive>
+	<primitive id="p_nomon" class="ocf" provider="heartbeat" type="Dummy">
+		<operations>
+			<op id="p_nomon-start" name="start" interval="0" timeout="20s"/>
+		</operations>
+	</primitive>
+	<primitive id="p_notimeout" class="ocf" provider="heartbeat" type="Dummy">
+		<operations>
+			<op id="p_notimeout-monitor" name="monitor" interval="10s"/>
+		</operations>
+	</primitive>
+	<primitive id="vm1" class="ocf" provider="heartbeat" type="VirtualDomain">
+		<meta_attributes id="vm1-meta_attributes">
+			<nvpair id="vm1-meta_attributes-remote-node" name="remote-node" value="guest1"/>
+		</meta_attributes>
+		<operations>
+			<op id="vm1-monitor" name="monitor" interval="10s" timeout="30s"/>
+		</operations>
+	</primitive>
+</resources>
+<constraints>
+	<rsc_location id="lo_unknown" rsc="p_missing" node="node1" score="100"/>
+	<rsc_location id="lo_node" rsc="p_ok" node="node3" score="100"/>
+	<rsc_location id="lo_guest" rsc="p_notimeout" node="guest1" score="100"/>
+	<rsc_location id="lo_prefer" rsc="p_ok" node="node1" score="100"/>
+	<rsc_location id="lo_ban" rsc="p_ok" node="node1" score="-INFINITY"/>
+	<rsc_colocation id="co_1" score="INFINITY" rsc="p_nomon" with-rsc="p_ok"/>
+	<rsc_colocation id="co_2" score="INFINITY" rsc="p_nomon" with-rsc="p_ok"/>
+	<rsc_colocation id="co_anti" score="-INFINITY" rsc="p_ok" with-rsc="p_nomon"/>
+	<rsc_order id="o_1" first="p_ok" then="p_notimeout"/>
+	<rsc_location id="cli-ban-p_ok-on-node2" rsc="p_ok" node="node2" score="-INFINITY" role="Started"/>
+</constraints>
+</configuration></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	findings, err := cib.Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Finding{{
+		Severity: SeverityError,
+		Check:    "unknown-resource",
+		ID:       "lo_unknown",
+		Message:  "constraint refers to resource p_missing, which does not exist",
+	}, {
+		Severity: SeverityError,
+		Check:    "unknown-node",
+		ID:       "lo_node",
+		Message:  "constraint refers to node node3, which does not exist",
+	}, {
+		Severity: SeverityWarning,
+		Check:    "duplicate-constraint",
+		ID:       "co_2",
+		Message:  "constraint is a duplicate of co_1",
+	}, {
+		Severity: SeverityWarning,
+		Check:    "shadowed-constraint",
+		ID:       "lo_prefer",
+		Message:  "score has no effect because of lo_ban",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_1",
+		Message:  "colocation constraints with opposite scores (p_ok, p_nomon) together with co_2, co_anti",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_2",
+		Message:  "colocation constraints with opposite scores (p_ok, p_nomon) together with co_1, co_anti",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_anti",
+		Message:  "colocation constraints with opposite scores (p_ok, p_nomon) together with co_1, co_2",
+	}, {
+		Severity: SeverityInfo,
+		Check:    "order-without-colocation",
+		ID:       "o_1",
+		Message:  "p_notimeout is ordered after p_ok, but the two are not colocated",
+	}, {
+		Severity: SeverityWarning,
+		Check:    "leftover-cli-constraint",
+		ID:       "cli-ban-p_ok-on-node2",
+		Message:  "constraint was created by crm_resource --move or --ban and should be cleared",
+	}, {
+		Severity: SeverityWarning,
+		Check:    "missing-monitor",
+		ID:       "p_nomon",
+		Message:  "resource has no recurring monitor operation, failures will not be detected",
+	}, {
+		Severity: SeverityWarning,
+		Check:    "missing-timeout",
+		ID:       "p_notimeout",
+		Message:  "operations without timeout and no default timeout configured: monitor",
+	}}
+
+	if !cmp.Equal(findings, expect) {
+		t.Errorf("Unexpected findings")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", findings)
+	}
+
+	errors := FilterFindings(findings, SeverityError)
+	if len(errors) != 5 {
+		t.Errorf("Expected 5 errors, got %d: %+v", len(errors), errors)
+	}
+}
+
+func TestLintConflicts(t *testing.T) {
+	xml := `<cib><configuration>
+<resources>
+	<primitive id="A" class="ocf" provider="heartbeat" type="Dummy"/>
+	<primitive id="B" class="ocf" provider="heartbeat" type="Dummy"/>
+	<primitive id="C" class="ocf" provider="heartbeat" type="Dummy"/>
+	<group id="g">
+		<primitive id="D" class="ocf" provider="heartbeat" type="Dummy"/>
+		<primitive id="E" class="ocf" provider="heartbeat" type="Dummy"/>
+		<primitive id="F" class="ocf" provider="heartbeat" type="Dummy"/>
+	</group>
+</resources>
+<constraints>
+	<rsc_colocation id="co_ab" score="INFINITY" rsc="A" with-rsc="B"/>
+	<rsc_colocation id="co_bc" score="INFINITY" rsc="B" with-rsc="C"/>
+	<rsc_colocation id="co_ac" score="-INFINITY" rsc="A" with-rsc="C"/>
+	<rsc_colocation id="co_df" score="-INFINITY" rsc="F" with-rsc="D"/>
+</constraints>
+</configuration></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	findings, err := cib.Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []Finding
+	for _, finding := range findings {
+		if finding.Check == "contradictory-colocation" {
+			actual = append(actual, finding)
+		}
+	}
+
+	chain := "resources must not run together but are colocated with INFINITY through other constraints (A, C)"
+	expect := []Finding{{
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_ac",
+		Message:  chain + " together with co_ab, co_bc",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_ab",
+		Message:  chain + " together with co_ac, co_bc",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_bc",
+		Message:  chain + " together with co_ac, co_ab",
+	}, {
+		Severity: SeverityError,
+		Check:    "contradictory-colocation",
+		ID:       "co_df",
+		Message:  "resources must not run together but are colocated with INFINITY through other constraints (D, F)",
+	}}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected findings")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual))
+	}
+}
@@ -0,0 +1,588 @@
+package cib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// NodeType distinguishes full cluster nodes from nodes that are integrated
+// into the cluster using Pacemaker Remote.
+type NodeType string
+
+const (
+	// NodeTypeCluster is a node running the full cluster stack.
+	NodeTypeCluster NodeType = "cluster"
+	// NodeTypeRemote is a Pacemaker Remote node, connected through an
+	// ocf:pacemaker:remote resource.
+	NodeTypeRemote NodeType = "remote"
+	// NodeTypeGuest is a guest node, a virtual machine or container run by
+	// a resource with the remote-node meta attribute.
+	NodeTypeGuest NodeType = "guest"
+)
+
+// remoteNode is a remote or guest node as defined by the configuration.
+type remoteNode struct {
+	Name       string
+	Type       NodeType
+	Connection string
+}
+
+// listRemoteNodes collects the remote and guest nodes defined by resources,
+// as well as remote nodes that only have an entry in the node section.
+func listRemoteNodes(root *xmltree.Element) []remoteNode {
+	var remotes []remoteNode
+	seen := make(map[string]bool)
+
+	for _, elem := range root.FindElements("configuration/resources//primitive") {
+		id := elem.SelectAttrValue(cibAttrKeyID, "")
+		if id == "" {
+			continue
+		}
+
+		if elem.SelectAttrValue("class", "") == "ocf" &&
+			elem.SelectAttrValue("provider", "") == "pacemaker" &&
+			elem.SelectAttrValue("type", "") == "remote" {
+			if !seen[id] {
+				remotes = append(remotes, remoteNode{Name: id, Type: NodeTypeRemote, Connection: id})
+				seen[id] = true
+			}
+			continue
+		}
+
+		if name := nvsetValues(elem, cibTagMetaAttr)["remote-node"]; name != "" && !seen[name] {
+			remotes = append(remotes, remoteNode{Name: name, Type: NodeTypeGuest, Connection: id})
+			seen[name] = true
+		}
+	}
+
+	for _, elem := range root.FindElements("configuration/nodes/node[@type='remote']") {
+		name := elem.SelectAttrValue("uname", "")
+		if name != "" && !seen[name] {
+			remotes = append(remotes, remoteNode{Name: name, Type: NodeTypeRemote})
+			seen[name] = true
+		}
+	}
+
+	return remotes
+}
+
+func remoteNodesByName(root *xmltree.Element) map[string]remoteNode {
+	byName := make(map[string]remoteNode)
+	for _, remote := range listRemoteNodes(root) {
+		byName[remote.Name] = remote
+	}
+	return byName
+}
+
+// remoteNodeInfo builds the node information for a remote or guest node.
+// The node's status entry may be nil if it never connected. The host of the
+// connection resource is looked up in the same CIB.
+func remoteNodeInfo(root *xmltree.Element, remote remoteNode, state *xmltree.Element) Node {
+	node := Node{
+		HostName:   remote.Name,
+		ID:         remote.Name,
+		Type:       remote.Type,
+		Connection: remote.Connection,
+	}
+
+	inCCM := false
+	expected := ""
+	if state != nil {
+		if id := state.SelectAttrValue(cibAttrKeyID, ""); id != "" {
+			node.ID = id
+		}
+		inCCM = state.SelectAttrValue("in_ccm", "") == "true"
+		expected = state.SelectAttrValue("expected", "")
+	}
+
+	connected := inCCM
+	if remote.Connection != "" {
+		node.ConnectionHost = nodeOfResource(root, remote.Connection)
+		connected = node.ConnectionHost != ""
+	}
+
+	node.State = NodeState{InCCM: inCCM, Crmd: connected, Join: JoinDown}
+	if connected {
+		node.State.Join = JoinMember
+	}
+	node.State.JoinExpected = node.State.Join
+	if expected != "" {
+		node.State.JoinExpected = joinState(expected)
+	}
+
+	return node
+}
+
+// UnavailableReason describes why a node does not run resources.
+type UnavailableReason string
+
+const (
+	// ReasonUnclean means the node left the cluster unexpectedly and has
+	// not been fenced yet.
+	ReasonUnclean UnavailableReason = "unclean"
+	// ReasonOffline means the node is not an active member of the cluster.
+	ReasonOffline UnavailableReason = "offline"
+	// ReasonClusterMaintenance means the whole cluster is in maintenance
+	// mode, so no resources are managed.
+	ReasonClusterMaintenance UnavailableReason = "cluster-maintenance"
+	// ReasonMaintenance means the node is in maintenance mode, so the
+	// resources on it are not managed.
+	ReasonMaintenance UnavailableReason = "maintenance"
+	// ReasonStandby means the node is in standby and may not run resources.
+	ReasonStandby UnavailableReason = "standby"
+)
+
+// NodeAvailability tells whether a node can run (managed) resources, and
+// if not, why.
+type NodeAvailability struct {
+	Node      string
+	Available bool
+	// Reasons lists all reasons why the node is not available, most severe
+	// first. It is empty if the node is available.
+	Reasons []UnavailableReason
+}
+
+// StandbyNodeWithLifetime puts a node into standby. With LifetimeForever
+// this is the same as StandbyNode, with LifetimeReboot the standby is
+// cleared when the node leaves the cluster, e.g. when it is rebooted.
+func (c *CIB) StandbyNodeWithLifetime(nodeUname string, lifetime AttributeLifetime) error {
+	if lifetime == LifetimeForever {
+		return c.StandbyNode(nodeUname)
+	}
+	return c.SetNodeAttribute(nodeUname, "standby", "on", lifetime)
+}
+
+// MaintenanceNode puts a node into maintenance mode. Pacemaker stops
+// monitoring and managing the resources on the node, but leaves them
+// running.
+func (c *CIB) MaintenanceNode(nodeUname string, lifetime AttributeLifetime) error {
+	return c.SetNodeAttribute(nodeUname, "maintenance", "true", lifetime)
+}
+
+// UnMaintenanceNode takes a node out of maintenance mode, in both lifetimes.
+func (c *CIB) UnMaintenanceNode(nodeUname string) error {
+	transient, err := c.ListNodeAttributes(nodeUname, LifetimeReboot)
+	if err != nil {
+		return err
+	}
+
+	err = c.DeleteNodeAttribute(nodeUname, "maintenance", LifetimeForever)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := transient["maintenance"]; ok {
+		return c.DeleteNodeAttribute(nodeUname, "maintenance", LifetimeReboot)
+	}
+	return nil
+}
+
+// IsMaintenanceNode checks if a node is in maintenance mode, either
+// permanently or until the next reboot. Cluster-wide maintenance mode is not
+// taken into account, see GetMaintenanceMode.
+func (c *CIB) IsMaintenanceNode(nodeUname string) (bool, error) {
+	value, _, err := c.GetEffectiveNodeAttribute(nodeUname, "maintenance")
+	if err != nil {
+		return false, err
+	}
+
+	return isTrue(value), nil
+}
+
+// GetNodeAvailability reports whether a node can run resources.
+func (c *CIB) GetNodeAvailability(nodeUname string) (NodeAvailability, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return NodeAvailability{}, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return NodeAvailability{}, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return nodeAvailability(root, nodeUname)
+}
+
+// ListNodeAvailability reports the availability of all configured nodes.
+func (c *CIB) ListNodeAvailability() ([]NodeAvailability, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	var result []NodeAvailability
+	for _, elem := range root.FindElements("configuration/nodes/node") {
+		uname := elem.SelectAttrValue("uname", "")
+		if uname == "" {
+			continue
+		}
+		availability, err := nodeAvailability(root, uname)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, availability)
+	}
+
+	return result, nil
+}
+
+func nodeAvailability(root *xmltree.Element, nodeUname string) (NodeAvailability, error) {
+	state := findNodeStateElement(root, nodeUname)
+	remote, isRemote := remoteNodesByName(root)[nodeUname]
+	if !isRemote && state != nil && isTrue(state.SelectAttrValue("remote_node", "")) {
+		remote, isRemote = remoteNode{Name: nodeUname, Type: NodeTypeRemote}, true
+	}
+
+	attrs, err := effectiveNodeAttributes(root, nodeUname)
+	if err != nil {
+		if !isRemote {
+			return NodeAvailability{}, err
+		}
+		// Remote and guest nodes need no entry in the node section. As in
+		// ListNodes, fall back to their status entry.
+		attrs = map[string]string{}
+		if state != nil {
+			attrs = transientAttributes(state)
+		}
+	}
+
+	availability := NodeAvailability{Node: nodeUname}
+
+	if isRemote {
+		if !remoteNodeInfo(root, remote, state).State.Crmd {
+			availability.Reasons = append(availability.Reasons, ReasonOffline)
+		}
+	} else if state == nil {
+		availability.Reasons = append(availability.Reasons, ReasonOffline)
+	} else {
+		inCCM := state.SelectAttrValue("in_ccm", "") == "true"
+		online := inCCM && state.SelectAttrValue("crmd", "") == "online" &&
+			joinState(state.SelectAttrValue("join", "")) == JoinMember
+		expected := joinState(state.SelectAttrValue("expected", ""))
+
+		// Like Pacemaker's scheduler, consider a node that dropped out of
+		// the membership while it was expected to be a member as unclean.
+		if !inCCM && expected == JoinMember {
+			availability.Reasons = append(availability.Reasons, ReasonUnclean)
+		} else if !online {
+			availability.Reasons = append(availability.Reasons, ReasonOffline)
+		}
+	}
+
+	if isTrue(clusterOption(root, "maintenance-mode")) {
+		availability.Reasons = append(availability.Reasons, ReasonClusterMaintenance)
+	}
+	if isTrue(attrs["maintenance"]) {
+		availability.Reasons = append(availability.Reasons, ReasonMaintenance)
+	}
+	if isTrue(attrs["standby"]) {
+		availability.Reasons = append(availability.Reasons, ReasonStandby)
+	}
+
+	availability.Available = len(availability.Reasons) == 0
+	return availability, nil
+}
+
+// ErrNodeExists is returned by AddNode if a node with the same name or ID is
+// already configured.
+var ErrNodeExists = errors.New("node already exists")
+
+// NodeSpec describes a node to be added to the configuration.
+type NodeSpec struct {
+	Name string
+	// ID is the node ID. For cluster nodes, this has to be the corosync
+	// node ID. For remote nodes, it defaults to the name.
+	ID string
+	// Type is either NodeTypeCluster (the default) or NodeTypeRemote.
+	Type        NodeType
+	Attributes  map[string]string
+	Utilization map[string]string
+}
+
+// AddNode adds a node entry to the configuration before the node joins the
+// cluster for the first time, so that its attributes and utilization are in
+// place from the start.
+func (c *CIB) AddNode(spec NodeSpec) error {
+	if spec.Type == "" {
+		spec.Type = NodeTypeCluster
+	}
+	if spec.Type == NodeTypeRemote && spec.ID == "" {
+		spec.ID = spec.Name
+	}
+
+	switch {
+	case spec.Name == "":
+		return fmt.Errorf("node name must not be empty")
+	case spec.ID == "":
+		return fmt.Errorf("node %s: node ID must not be empty", spec.Name)
+	case spec.Type != NodeTypeCluster && spec.Type != NodeTypeRemote:
+		return fmt.Errorf("node %s: cannot add node of type %s", spec.Name, spec.Type)
+	}
+
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	if _, err := findNode(root, spec.Name); err == nil {
+		return fmt.Errorf("%w: %s", ErrNodeExists, spec.Name)
+	}
+
+	ids := NewIDAllocator(c.Doc)
+	if ids.Exists(spec.ID) {
+		return fmt.Errorf("%w: ID %s is already in use", ErrNodeExists, spec.ID)
+	}
+
+	configuration := root.FindElement("configuration")
+	if configuration == nil {
+		configuration = root.CreateElement("configuration")
+	}
+	nodes := configuration.FindElement("nodes")
+	if nodes == nil {
+		nodes = configuration.CreateElement("nodes")
+	}
+
+	node := nodes.CreateElement("node")
+	node.CreateAttr(cibAttrKeyID, spec.ID)
+	node.CreateAttr("uname", spec.Name)
+	if spec.Type == NodeTypeRemote {
+		node.CreateAttr("type", string(NodeTypeRemote))
+	}
+	ids.used[spec.ID] = true
+
+	addNvSet(node, cibTagInstAttr, ids.Allocate("nodes", spec.ID), spec.Attributes, ids)
+	addNvSet(node, "utilization", ids.Allocate("nodes", spec.ID, "utilization"), spec.Utilization, ids)
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// addNvSet adds an attribute set with the given values, sorted by name. No
+// set is added if there are no values.
+func addNvSet(parent *xmltree.Element, tag, id string, values map[string]string, ids *IDAllocator) {
+	if len(values) == 0 {
+		return
+	}
+
+	set := parent.CreateElement(tag)
+	set.CreateAttr(cibAttrKeyID, id)
+	addNvPairs(set, values, ids)
+}
+
+// addNvPairs adds nvpairs for the values to an existing set, sorted by
+// name.
+func addNvPairs(set *xmltree.Element, values map[string]string, ids *IDAllocator) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	id := set.SelectAttrValue(cibAttrKeyID, "")
+	for _, name := range names {
+		nvpair := set.CreateElement(cibTagNvPair)
+		nvpair.CreateAttr(cibAttrKeyID, ids.Allocate(id, name))
+		nvpair.CreateAttr(cibAttrKeyName, name)
+		nvpair.CreateAttr(cibAttrKeyValue, values[name])
+	}
+}
+
+// RemoveNode removes a node from the cluster, like crm_node --remove does,
+// and purges everything in the CIB that refers to it: its node entry, its
+// status entry, location constraints and rules naming the node and fencing
+// levels targeting it. The node should be stopped before it is removed.
+//
+// Location constraints that place a resource on the node (node="...") are
+// deleted. In rules, #uname expressions comparing against the node are
+// removed where that does not change their meaning for the remaining nodes;
+// a rule that could only match the removed node is removed as a whole, and
+// a constraint left without rules is deleted.
+func (c *CIB) RemoveNode(name string) ([]ConstraintChange, error) {
+	_, stderr, err := nodeRemoveCommand.execute("", name)
+	if err != nil {
+		return nil, fmt.Errorf("could not remove node %s: %w: %s", name, err, strings.TrimSpace(stderr))
+	}
+
+	err = c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	var changes []ConstraintChange
+	record := func(change ConstraintChange) {
+		change.Reference = name
+		log.WithFields(log.Fields{
+			"action":     change.Action,
+			"tag":        change.Tag,
+			"id":         change.ID,
+			"constraint": change.Constraint,
+		}).Debugf("purging node %s", name)
+		changes = append(changes, change)
+	}
+	remove := func(elem *xmltree.Element, constraint string) {
+		record(ConstraintChange{
+			Action:     ChangeDeleted,
+			Tag:        elem.Tag,
+			ID:         elem.SelectAttrValue(cibAttrKeyID, ""),
+			Constraint: constraint,
+		})
+		elem.Parent().RemoveChild(elem)
+	}
+
+	nodeID := ""
+	if elem, err := findNode(root, name); err == nil {
+		nodeID = elem.SelectAttrValue(cibAttrKeyID, "")
+		remove(elem, "")
+	}
+
+	for _, state := range root.FindElements("status/node_state") {
+		if state.SelectAttrValue("uname", "") == name ||
+			(nodeID != "" && state.SelectAttrValue(cibAttrKeyID, "") == nodeID) {
+			remove(state, "")
+		}
+	}
+
+	for _, loc := range root.FindElements("configuration/constraints/" + cibTagLocation) {
+		locID := loc.SelectAttrValue(cibAttrKeyID, "")
+		if loc.SelectAttrValue("node", "") == name {
+			remove(loc, "")
+			continue
+		}
+
+		rules := loc.SelectElements("rule")
+		if len(rules) == 0 {
+			continue
+		}
+		removedRules := 0
+		for _, rule := range rules {
+			if pruneNodeRule(rule, name, locID, record) {
+				record(ConstraintChange{
+					Action:     ChangeRemovedRule,
+					Tag:        rule.Tag,
+					ID:         rule.SelectAttrValue(cibAttrKeyID, ""),
+					Constraint: locID,
+				})
+				loc.RemoveChild(rule)
+				removedRules++
+			}
+		}
+		if removedRules == len(rules) {
+			remove(loc, "")
+		}
+	}
+
+	for _, level := range root.FindElements("configuration/fencing-topology/fencing-level") {
+		if level.SelectAttrValue("target", "") == name {
+			remove(level, "")
+		}
+	}
+
+	err = c.Update()
+	if err != nil {
+		return changes, fmt.Errorf("could not update CIB: %w", err)
+	}
+	return changes, nil
+}
+
+// pruneNodeRule removes #uname expressions comparing against a removed node
+// from a rule, as far as that does not change the rule's result on the
+// remaining nodes. It returns true if the rule can only have matched the
+// removed node and should be removed as a whole.
+func pruneNodeRule(rule *xmltree.Element, node, constraint string, record func(ConstraintChange)) bool {
+	isOr := rule.SelectAttrValue("boolean-op", "and") == "or"
+
+	children := 0
+	var alwaysTrue []*xmltree.Element
+	for _, child := range rule.ChildElements() {
+		switch child.Tag {
+		case "expression":
+			children++
+			if child.SelectAttrValue("attribute", "") != "#uname" || child.SelectAttrValue("value", "") != node {
+				continue
+			}
+			switch child.SelectAttrValue("operation", "") {
+			case "eq":
+				// never true on the remaining nodes
+				if !isOr {
+					return true
+				}
+				record(ConstraintChange{
+					Action:     ChangeRemovedExpression,
+					Tag:        child.Tag,
+					ID:         child.SelectAttrValue(cibAttrKeyID, ""),
+					Constraint: constraint,
+				})
+				rule.RemoveChild(child)
+				children--
+			case "ne":
+				// always true on the remaining nodes
+				if !isOr {
+					alwaysTrue = append(alwaysTrue, child)
+				}
+			}
+		case "rule":
+			children++
+			if pruneNodeRule(child, node, constraint, record) {
+				if !isOr {
+					return true
+				}
+				record(ConstraintChange{
+					Action:     ChangeRemovedRule,
+					Tag:        child.Tag,
+					ID:         child.SelectAttrValue(cibAttrKeyID, ""),
+					Constraint: constraint,
+				})
+				rule.RemoveChild(child)
+				children--
+			}
+		case "date_expression", "rsc_expression", "op_expression":
+			children++
+		}
+	}
+
+	if isOr && children == 0 {
+		return true
+	}
+
+	// an expression that is always true can be dropped from a conjunction,
+	// unless it is the last one, which would leave an empty rule
+	for _, child := range alwaysTrue {
+		if children <= 1 {
+			break
+		}
+		record(ConstraintChange{
+			Action:     ChangeRemovedExpression,
+			Tag:        child.Tag,
+			ID:         child.SelectAttrValue(cibAttrKeyID, ""),
+			Constraint: constraint,
+		})
+		rule.RemoveChild(child)
+		children--
+	}
+
+	return false
+}
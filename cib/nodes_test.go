@@ -0,0 +1,479 @@
+package cib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListNodeAvailability(t *testing.T) {
+	xml := `<cib><configuration>
+	<crm_config>
+		<cluster_property_set id="cib-bootstrap-options"></cluster_property_set>
+	</crm_config>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2">
+			<instance_attributes id="nodes-2">
+				<nvpair id="nodes-2-standby" name="standby" value="on"/>
+			</instance_attributes>
+		</node>
+		<node id="3" uname="la3"/>
+		<node id="4" uname="la4"/>
+		<node id="5" uname="la5"/>
+		<node id="6" uname="la6"/>
+	</nodes>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"/>
+		<node_state id="2" uname="la2" in_ccm="true" crmd="online" join="member" expected="member"/>
+		<node_state id="3" uname="la3" in_ccm="true" crmd="online" join="member" expected="member">
+			<transient_attributes id="3">
+				<instance_attributes id="status-3">
+					<nvpair id="status-3-maintenance" name="maintenance" value="true"/>
+					<nvpair id="status-3-standby" name="standby" value="on"/>
+				</instance_attributes>
+			</transient_attributes>
+		</node_state>
+		<node_state id="4" uname="la4" in_ccm="false" crmd="offline" join="down" expected="down"/>
+		<node_state id="5" uname="la5" in_ccm="false" crmd="offline" join="down" expected="member"/>
+	</status></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.ListNodeAvailability()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []NodeAvailability{
+		{Node: "la1", Available: true},
+		{Node: "la2", Reasons: []UnavailableReason{ReasonStandby}},
+		{Node: "la3", Reasons: []UnavailableReason{ReasonMaintenance, ReasonStandby}},
+		{Node: "la4", Reasons: []UnavailableReason{ReasonOffline}},
+		{Node: "la5", Reasons: []UnavailableReason{ReasonUnclean}},
+		{Node: "la6", Reasons: []UnavailableReason{ReasonOffline}},
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected availability")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	maintenance := `<cluster_property_set id="cib-bootstrap-options">` +
+		`<nvpair id="cib-bootstrap-options-maintenance-mode" name="maintenance-mode" value="true"/>`
+	xml = strings.Replace(xml, `<cluster_property_set id="cib-bootstrap-options">`, maintenance, 1)
+
+	availability, err := cib.GetNodeAvailability("la1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLa1 := NodeAvailability{Node: "la1", Reasons: []UnavailableReason{ReasonClusterMaintenance}}
+	if !cmp.Equal(availability, expectLa1) {
+		t.Errorf("Unexpected availability in cluster maintenance mode: %+v", availability)
+	}
+
+	enabled, err := cib.GetMaintenanceMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled {
+		t.Errorf("Expected cluster maintenance mode to be enabled")
+	}
+}
+
+func TestGuestNodeAvailability(t *testing.T) {
+	xml := `<cib><configuration>
+	<nodes><node id="1" uname="la1"/></nodes>
+	<resources>
+		<primitive id="vm1" class="ocf" provider="heartbeat" type="VirtualDomain">
+			<meta_attributes id="vm1-meta_attributes">
+				<nvpair id="vm1-meta_attributes-remote-node" name="remote-node" value="guest1"/>
+			</meta_attributes>
+		</primitive>
+		<primitive id="vm2" class="ocf" provider="heartbeat" type="VirtualDomain">
+			<meta_attributes id="vm2-meta_attributes">
+				<nvpair id="vm2-meta_attributes-remote-node" name="remote-node" value="guest2"/>
+			</meta_attributes>
+		</primitive>
+	</resources>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member">
+			<lrm><lrm_resources>
+				<lrm_resource id="vm1"><lrm_rsc_op operation="start" rc-code="0"/></lrm_resource>
+			</lrm_resources></lrm>
+		</node_state>
+		<node_state id="guest1" uname="guest1" remote_node="true" in_ccm="true">
+			<transient_attributes id="guest1">
+				<instance_attributes id="status-guest1">
+					<nvpair id="status-guest1-standby" name="standby" value="on"/>
+				</instance_attributes>
+			</transient_attributes>
+		</node_state>
+	</status></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	cases := []struct {
+		node   string
+		expect NodeAvailability
+	}{
+		{"guest1", NodeAvailability{Node: "guest1", Reasons: []UnavailableReason{ReasonStandby}}},
+		{"guest2", NodeAvailability{Node: "guest2", Reasons: []UnavailableReason{ReasonOffline}}},
+	}
+
+	var cib CIB
+	for _, c := range cases {
+		actual, err := cib.GetNodeAvailability(c.node)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.node, err)
+			continue
+		}
+		if !cmp.Equal(actual, c.expect) {
+			t.Errorf("Unexpected availability of %s: %+v", c.node, actual)
+		}
+	}
+
+	if _, err := cib.GetNodeAvailability("la9"); err == nil {
+		t.Errorf("Expected error for unknown node")
+	}
+}
+
+func TestUnStandbyNodeTransient(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return attributesXML, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	var calls [][]string
+	attributeCommand = &argsCommand{
+		func(_ string, args []string) (string, string, error) {
+			calls = append(calls, args)
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.StandbyNodeWithLifetime("la2", LifetimeReboot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cib.UnStandbyNode("la1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := [][]string{
+		{"--node", "la2", "--name", "standby", "--update", "on"},
+		{"--node", "la1", "--name", "standby", "--delete"},
+	}
+	if !cmp.Equal(calls, expect) {
+		t.Errorf("Unexpected calls of crm_attribute")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", calls)
+	}
+}
+
+func TestGetNodeIDString(t *testing.T) {
+	xml := `<cib><configuration>
+	<nodes><node id="1" uname="la1"/></nodes>
+	<resources>
+		<primitive id="remote1" class="ocf" provider="pacemaker" type="remote"/>
+	</resources>
+	</configuration></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	cases := []struct {
+		node        string
+		expect      string
+		expectError bool
+	}{
+		{node: "la1", expect: "1"},
+		{node: "remote1", expect: "remote1"},
+		{node: "la2", expectError: true},
+	}
+
+	for _, c := range cases {
+		var cib CIB
+		actual, err := cib.GetNodeIDString(c.node)
+		if err != nil {
+			if !c.expectError {
+				t.Errorf("Unexpected error for node %s: %s", c.node, err)
+			}
+			continue
+		}
+		if c.expectError {
+			t.Errorf("Expected error for node %s", c.node)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("Unexpected ID for node %s: expected %s, got %s", c.node, c.expect, actual)
+		}
+	}
+
+	var cib CIB
+	if _, err := cib.GetNodeID("remote1"); err == nil {
+		t.Errorf("Expected error for non-numeric node ID")
+	}
+}
+
+func TestAddNode(t *testing.T) {
+	input := `<cib><configuration><nodes>
+		<node id="1" uname="la1"/>
+	</nodes></configuration></cib>`
+
+	cases := []struct {
+		desc        string
+		spec        NodeSpec
+		expect      string
+		expectError bool
+	}{{
+		desc: "cluster node with attributes and utilization",
+		spec: NodeSpec{
+			Name:        "la2",
+			ID:          "2",
+			Attributes:  map[string]string{"site": "a", "rack": "3"},
+			Utilization: map[string]string{"cpu": "16"},
+		},
+		expect: `<cib><configuration><nodes>
+			<node id="1" uname="la1"/>
+			<node id="2" uname="la2">
+				<instance_attributes id="nodes-2">
+					<nvpair id="nodes-2-rack" name="rack" value="3"/>
+					<nvpair id="nodes-2-site" name="site" value="a"/>
+				</instance_attributes>
+				<utilization id="nodes-2-utilization">
+					<nvpair id="nodes-2-utilization-cpu" name="cpu" value="16"/>
+				</utilization>
+			</node>
+		</nodes></configuration></cib>`,
+	}, {
+		desc: "remote node",
+		spec: NodeSpec{Name: "remote1", Type: NodeTypeRemote},
+		expect: `<cib><configuration><nodes>
+			<node id="1" uname="la1"/>
+			<node id="remote1" uname="remote1" type="remote"/>
+		</nodes></configuration></cib>`,
+	}, {
+		desc:        "existing name",
+		spec:        NodeSpec{Name: "la1", ID: "3"},
+		expectError: true,
+	}, {
+		desc:        "existing ID",
+		spec:        NodeSpec{Name: "la3", ID: "1"},
+		expectError: true,
+	}, {
+		desc:        "missing ID",
+		spec:        NodeSpec{Name: "la3"},
+		expectError: true,
+	}}
+
+	for _, c := range cases {
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return input, "", nil
+			},
+		}
+		updateCommand = &testCommand{
+			func(actual string) (string, string, error) {
+				normExpect := normalizeXML(t, c.expect)
+				normActual := normalizeXML(t, actual)
+				if normActual != normExpect {
+					t.Errorf("XML does not match (input '%s')", c.desc)
+					t.Errorf("Expected: %s", normExpect)
+					t.Errorf("Actual: %s", normActual)
+				}
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		err := cib.AddNode(c.spec)
+		if err != nil {
+			if !c.expectError {
+				t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			}
+			continue
+		}
+		if c.expectError {
+			t.Errorf("Expected error in case '%s'", c.desc)
+		}
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	input := `<cib><configuration>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2"/>
+		<node id="3" uname="la3"/>
+	</nodes>
+	<constraints>
+		<rsc_location id="lo_prefer" rsc="p_test" node="la3" score="100"/>
+		<rsc_location id="lo_other" rsc="p_test" node="la1" score="50"/>
+		<rsc_location id="lo_only" rsc="p_iscsi">
+			<rule id="lo_only-rule" score="-INFINITY">
+				<expression id="lo_only-rule-expr-0" attribute="#uname" operation="ne" value="la1"/>
+				<expression id="lo_only-rule-expr-1" attribute="#uname" operation="ne" value="la3"/>
+			</rule>
+		</rsc_location>
+		<rsc_location id="lo_or" rsc="p_db">
+			<rule id="lo_or-rule" score="100" boolean-op="or">
+				<expression id="lo_or-rule-expr-0" attribute="#uname" operation="eq" value="la2"/>
+				<expression id="lo_or-rule-expr-1" attribute="#uname" operation="eq" value="la3"/>
+			</rule>
+		</rsc_location>
+		<rsc_location id="lo_la3" rsc="p_web">
+			<rule id="lo_la3-rule" score="100">
+				<expression id="lo_la3-rule-expr" attribute="#uname" operation="eq" value="la3"/>
+			</rule>
+		</rsc_location>
+	</constraints>
+	<fencing-topology>
+		<fencing-level id="fl-la1-1" target="la1" index="1" devices="stonith-la1"/>
+		<fencing-level id="fl-la3-1" target="la3" index="1" devices="stonith-la3"/>
+	</fencing-topology>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1"/>
+		<node_state id="3" uname="la3"/>
+	</status></cib>`
+
+	expect := `<cib><configuration>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2"/>
+	</nodes>
+	<constraints>
+		<rsc_location id="lo_other" rsc="p_test" node="la1" score="50"/>
+		<rsc_location id="lo_only" rsc="p_iscsi">
+			<rule id="lo_only-rule" score="-INFINITY">
+				<expression id="lo_only-rule-expr-0" attribute="#uname" operation="ne" value="la1"/>
+			</rule>
+		</rsc_location>
+		<rsc_location id="lo_or" rsc="p_db">
+			<rule id="lo_or-rule" score="100" boolean-op="or">
+				<expression id="lo_or-rule-expr-0" attribute="#uname" operation="eq" value="la2"/>
+			</rule>
+		</rsc_location>
+	</constraints>
+	<fencing-topology>
+		<fencing-level id="fl-la1-1" target="la1" index="1" devices="stonith-la1"/>
+	</fencing-topology>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1"/>
+	</status></cib>`
+
+	var args []string
+	nodeRemoveCommand = &argsCommand{
+		func(_ string, a []string) (string, string, error) {
+			args = a
+			return "", "", nil
+		},
+	}
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return input, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(actual string) (string, string, error) {
+			normExpect := normalizeXML(t, expect)
+			normActual := normalizeXML(t, actual)
+			if normActual != normExpect {
+				t.Errorf("XML does not match")
+				t.Errorf("Expected: %s", normExpect)
+				t.Errorf("Actual: %s", normActual)
+			}
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	changes, err := cib.RemoveNode("la3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(args, []string{"la3"}) {
+		t.Errorf("Unexpected arguments for crm_node: %v", args)
+	}
+
+	expectChanges := []ConstraintChange{
+		{Action: ChangeDeleted, Tag: "node", ID: "3", Reference: "la3"},
+		{Action: ChangeDeleted, Tag: "node_state", ID: "3", Reference: "la3"},
+		{Action: ChangeDeleted, Tag: "rsc_location", ID: "lo_prefer", Reference: "la3"},
+		{Action: ChangeRemovedExpression, Tag: "expression", ID: "lo_only-rule-expr-1", Constraint: "lo_only", Reference: "la3"},
+		{Action: ChangeRemovedExpression, Tag: "expression", ID: "lo_or-rule-expr-1", Constraint: "lo_or", Reference: "la3"},
+		{Action: ChangeRemovedRule, Tag: "rule", ID: "lo_la3-rule", Constraint: "lo_la3", Reference: "la3"},
+		{Action: ChangeDeleted, Tag: "rsc_location", ID: "lo_la3", Reference: "la3"},
+		{Action: ChangeDeleted, Tag: "fencing-level", ID: "fl-la3-1", Reference: "la3"},
+	}
+	if !cmp.Equal(changes, expectChanges) {
+		t.Errorf("Unexpected changes")
+		t.Errorf("Expected: %+v", expectChanges)
+		t.Errorf("Actual: %+v", changes)
+	}
+}
+
+func TestListNodesReadsOnce(t *testing.T) {
+	xml := `<cib><configuration><resources>
+		<primitive id="remote1" class="ocf" provider="pacemaker" type="remote"/>
+		<primitive id="remote2" class="ocf" provider="pacemaker" type="remote"/>
+	</resources></configuration>
+	<status>
+		<node_state id="1" uname="node1" in_ccm="true" crmd="online" join="member" expected="member">
+			<lrm><lrm_resources>
+				<lrm_resource id="remote1"><lrm_rsc_op operation="start" rc-code="0"/></lrm_resource>
+				<lrm_resource id="remote2"><lrm_rsc_op operation="start" rc-code="0"/></lrm_resource>
+			</lrm_resources></lrm>
+		</node_state>
+		<node_state id="remote1" uname="remote1" remote_node="true" in_ccm="true"/>
+	</status></cib>`
+
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	nodes, err := cib.ListNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 {
+		t.Errorf("Expected 1 read of the CIB, got %d", reads)
+	}
+	for _, node := range nodes {
+		if node.Type == NodeTypeRemote && node.ConnectionHost != "node1" {
+			t.Errorf("Unexpected connection host of %s: '%s'", node.HostName, node.ConnectionHost)
+		}
+	}
+}
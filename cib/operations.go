@@ -0,0 +1,303 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// ocfPending is the rc-code Pacemaker records for operations that have not
+// finished yet.
+const ocfPending = 193
+
+// Execution status of an operation (op-status), as opposed to the result of
+// the resource agent (rc-code)
+const (
+	opStatusPending   = -1
+	opStatusDone      = 0
+	opStatusCancelled = 1
+)
+
+// LrmOperation is an operation the executor ran for a resource on a node,
+// as recorded in an <lrm_rsc_op> element of the status section.
+type LrmOperation struct {
+	ID string
+	// Node is the node the operation ran on
+	Node string
+	// LrmID is the ID of the <lrm_resource> element, Resource the
+	// resource it belongs to. They differ for instances of anonymous
+	// clones, which are recorded as "<resource>:<instance>".
+	LrmID    string
+	Resource string
+	// Operation is the action, e.g. "start" or "monitor"
+	Operation string
+	// Interval is the interval of recurring operations, 0 otherwise
+	Interval time.Duration
+	// CallID orders the operations of a resource on a node. It is -1 for
+	// operations that were never executed.
+	CallID int
+	// RcCode is the result of the resource agent, -1 if none is recorded
+	RcCode int
+	// OpStatus is the execution status, e.g. -1 for pending and 2 for
+	// timed out operations
+	OpStatus      int
+	LastRcChange  time.Time
+	ExecTime      time.Duration
+	QueueTime     time.Duration
+	TransitionKey string
+	ExitReason    string
+}
+
+// Pending reports whether the operation has not finished yet.
+func (o LrmOperation) Pending() bool {
+	return o.OpStatus == opStatusPending || o.RcCode == ocfPending
+}
+
+// ExpectedRc returns the result the scheduler expected, which is part of
+// the transition key. It returns false if the operation has no valid
+// transition key, e.g. because it was not initiated by the scheduler.
+func (o LrmOperation) ExpectedRc() (int, bool) {
+	return transitionKeyRc(o.TransitionKey)
+}
+
+// Failed reports whether the operation finished with a result other than
+// the one the scheduler expected, or did not finish successfully.
+func (o LrmOperation) Failed() bool {
+	if o.Pending() || o.RcCode < 0 {
+		return false
+	}
+	if o.OpStatus != opStatusDone && o.OpStatus != opStatusCancelled {
+		return true
+	}
+	expected, ok := o.ExpectedRc()
+	return ok && o.RcCode != expected
+}
+
+// OperationHistory holds the operations recorded in the status section,
+// grouped per node and per resource.
+type OperationHistory struct {
+	// byNode maps node names to lrm_resource IDs to the operations,
+	// ordered by call ID
+	byNode map[string]map[string][]LrmOperation
+	// promotable contains the primitives of promotable clones
+	promotable map[string]bool
+}
+
+// isPromotable reports whether a resource or clone instance is part of a
+// promotable clone.
+func (h OperationHistory) isPromotable(id string) bool {
+	return h.promotable[lrmResourceID(id)]
+}
+
+// Nodes returns the names of the nodes with recorded operations, sorted.
+func (h OperationHistory) Nodes() []string {
+	nodes := make([]string, 0, len(h.byNode))
+	for node := range h.byNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// ByNode returns the operations recorded on a node, keyed by the ID of the
+// lrm_resource element.
+func (h OperationHistory) ByNode(node string) map[string][]LrmOperation {
+	result := make(map[string][]LrmOperation)
+	for id, ops := range h.byNode[node] {
+		result[id] = ops
+	}
+	return result
+}
+
+// ByResource returns the operations of a resource, keyed by node. The ID
+// may be a resource ID, which includes all instances of an anonymous clone,
+// or the ID of a single instance.
+func (h OperationHistory) ByResource(id string) map[string][]LrmOperation {
+	result := make(map[string][]LrmOperation)
+	for node, resources := range h.byNode {
+		for _, lrmID := range sortedKeys(resources) {
+			if lrmID == id || lrmResourceID(lrmID) == id {
+				result[node] = append(result[node], resources[lrmID]...)
+			}
+		}
+	}
+	for node := range result {
+		sortOperations(result[node])
+	}
+	return result
+}
+
+// Get returns the operations of a resource on a node, ordered by call ID.
+// The ID is matched like in ByResource.
+func (h OperationHistory) Get(node, id string) []LrmOperation {
+	return h.ByResource(id)[node]
+}
+
+// OperationHistory parses all operations recorded in the status section.
+func (c *CIB) OperationHistory() (OperationHistory, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return OperationHistory{}, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return OperationHistory{}, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	return operationHistory(root)
+}
+
+func operationHistory(root *xmltree.Element) (OperationHistory, error) {
+	history := OperationHistory{
+		byNode:     make(map[string]map[string][]LrmOperation),
+		promotable: promotablePrimitives(root),
+	}
+	for _, state := range root.FindElements("status/node_state") {
+		node := state.SelectAttrValue("uname", "")
+		if node == "" {
+			continue
+		}
+		for _, lrmRsc := range state.FindElements(cibTagLrm + "/" + cibTagLrmRsclist + "/" + cibTagLrmRsc) {
+			ops, err := parseLrmResource(node, lrmRsc)
+			if err != nil {
+				return OperationHistory{}, err
+			}
+			if len(ops) == 0 {
+				continue
+			}
+			if history.byNode[node] == nil {
+				history.byNode[node] = make(map[string][]LrmOperation)
+			}
+			history.byNode[node][ops[0].LrmID] = ops
+		}
+	}
+	return history, nil
+}
+
+// parseLrmResource parses the operations of an <lrm_resource> element and
+// orders them by call ID.
+func parseLrmResource(node string, lrmRsc *xmltree.Element) ([]LrmOperation, error) {
+	lrmID := lrmRsc.SelectAttrValue(cibAttrKeyID, "")
+
+	var ops []LrmOperation
+	for _, elem := range lrmRsc.SelectElements(cibTagLrmRscOp) {
+		op, err := parseLrmOperation(elem)
+		if err != nil {
+			return nil, fmt.Errorf("resource %s on node %s: %w", lrmID, node, err)
+		}
+		op.Node = node
+		op.LrmID = lrmID
+		op.Resource = lrmResourceID(lrmID)
+		ops = append(ops, op)
+	}
+	sortOperations(ops)
+	return ops, nil
+}
+
+func parseLrmOperation(elem *xmltree.Element) (LrmOperation, error) {
+	op := LrmOperation{
+		ID:            elem.SelectAttrValue(cibAttrKeyID, ""),
+		Operation:     elem.SelectAttrValue(cibAttrKeyOperation, ""),
+		TransitionKey: elem.SelectAttrValue("transition-key", ""),
+		ExitReason:    elem.SelectAttrValue("exit-reason", ""),
+	}
+
+	ints := []struct {
+		name  string
+		value *int
+		def   int
+	}{
+		{"call-id", &op.CallID, -1},
+		{cibAttrKeyRcCode, &op.RcCode, -1},
+		{"op-status", &op.OpStatus, opStatusDone},
+	}
+	for _, i := range ints {
+		n, err := intAttr(elem, i.name, i.def)
+		if err != nil {
+			return LrmOperation{}, fmt.Errorf("operation %s: %w", op.ID, err)
+		}
+		*i.value = n
+	}
+
+	millis := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"interval", &op.Interval},
+		{"exec-time", &op.ExecTime},
+		{"queue-time", &op.QueueTime},
+	}
+	for _, m := range millis {
+		n, err := intAttr(elem, m.name, 0)
+		if err != nil {
+			return LrmOperation{}, fmt.Errorf("operation %s: %w", op.ID, err)
+		}
+		*m.value = time.Duration(n) * time.Millisecond
+	}
+
+	changed, err := intAttr(elem, "last-rc-change", 0)
+	if err != nil {
+		return LrmOperation{}, fmt.Errorf("operation %s: %w", op.ID, err)
+	}
+	if changed != 0 {
+		op.LastRcChange = time.Unix(int64(changed), 0)
+	}
+
+	return op, nil
+}
+
+// sortOperations orders operations by call ID. Operations that were never
+// executed (call ID -1) come last, ordered by the time they were recorded.
+func sortOperations(ops []LrmOperation) {
+	sort.SliceStable(ops, func(i, j int) bool {
+		a, b := ops[i], ops[j]
+		if a.CallID < 0 || b.CallID < 0 {
+			if a.CallID >= 0 || b.CallID >= 0 {
+				return a.CallID >= 0
+			}
+			return a.LastRcChange.Before(b.LastRcChange)
+		}
+		return a.CallID < b.CallID
+	})
+}
+
+// transitionKeyRc extracts the expected result from a transition key,
+// which has the format "<action>:<transition>:<expected rc>:<uuid>".
+func transitionKeyRc(key string) (int, bool) {
+	parts := strings.Split(key, ":")
+	if len(parts) != 4 {
+		return 0, false
+	}
+	rc, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, false
+	}
+	return rc, true
+}
+
+// intAttr reads an integer attribute, returning def if it is not set.
+func intAttr(elem *xmltree.Element, name string, def int) (int, error) {
+	str := elem.SelectAttrValue(name, "")
+	if str == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", name, str, err)
+	}
+	return n, nil
+}
+
+func sortedKeys(m map[string][]LrmOperation) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
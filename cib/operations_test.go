@@ -0,0 +1,106 @@
+package cib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const operationsXML = `<cib><configuration>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2"/>
+	</nodes>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1">
+			<lrm id="1">
+				<lrm_resources>
+					<lrm_resource id="p_db" type="Dummy" class="ocf" provider="heartbeat">
+						<lrm_rsc_op id="p_db_monitor_10000" operation="monitor" call-id="12" rc-code="0" op-status="0" interval="10000" last-rc-change="1760000100" exec-time="15" queue-time="0" transition-key="5:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+						<lrm_rsc_op id="p_db_last_0" operation="start" call-id="11" rc-code="0" op-status="0" interval="0" last-rc-change="1760000000" exec-time="1200" queue-time="3" transition-key="4:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+					</lrm_resource>
+					<lrm_resource id="p_web:0" type="apache" class="ocf" provider="heartbeat">
+						<lrm_rsc_op id="p_web_last_0" operation="start" call-id="-1" rc-code="193" op-status="-1" interval="0" transition-key="7:4:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+					</lrm_resource>
+				</lrm_resources>
+			</lrm>
+		</node_state>
+		<node_state id="2" uname="la2">
+			<lrm id="2">
+				<lrm_resources>
+					<lrm_resource id="p_web:1" type="apache" class="ocf" provider="heartbeat">
+						<lrm_rsc_op id="p_web_last_failure_0" operation="start" call-id="8" rc-code="1" op-status="0" interval="0" last-rc-change="1760000200" exit-reason="Config file missing" transition-key="8:4:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+					</lrm_resource>
+				</lrm_resources>
+			</lrm>
+		</node_state>
+	</status></cib>`
+
+func TestOperationHistory(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return operationsXML, "", nil
+		},
+	}
+
+	var cib CIB
+	history, err := cib.OperationHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(history.Nodes(), []string{"la1", "la2"}) {
+		t.Errorf("Unexpected nodes: %v", history.Nodes())
+	}
+
+	expect := []LrmOperation{{
+		ID:            "p_db_last_0",
+		Node:          "la1",
+		LrmID:         "p_db",
+		Resource:      "p_db",
+		Operation:     "start",
+		CallID:        11,
+		LastRcChange:  time.Unix(1760000000, 0),
+		ExecTime:      1200 * time.Millisecond,
+		QueueTime:     3 * time.Millisecond,
+		TransitionKey: "4:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1",
+	}, {
+		ID:            "p_db_monitor_10000",
+		Node:          "la1",
+		LrmID:         "p_db",
+		Resource:      "p_db",
+		Operation:     "monitor",
+		Interval:      10 * time.Second,
+		CallID:        12,
+		LastRcChange:  time.Unix(1760000100, 0),
+		ExecTime:      15 * time.Millisecond,
+		TransitionKey: "5:3:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1",
+	}}
+	actual := history.Get("la1", "p_db")
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected operations of p_db")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	// the clone instances are found by the resource ID
+	web := history.ByResource("p_web")
+	if len(web) != 2 || len(web["la1"]) != 1 || len(web["la2"]) != 1 {
+		t.Fatalf("Unexpected operations of p_web: %+v", web)
+	}
+	if op := web["la1"][0]; !op.Pending() || op.Failed() || op.LrmID != "p_web:0" {
+		t.Errorf("Expected pending operation on la1: %+v", op)
+	}
+	if op := web["la2"][0]; op.Pending() || !op.Failed() || op.ExitReason != "Config file missing" {
+		t.Errorf("Expected failed operation on la2: %+v", op)
+	}
+
+	if ops := history.Get("la2", "p_web:0"); len(ops) != 0 {
+		t.Errorf("Unexpected operations of p_web:0 on la2: %+v", ops)
+	}
+	if rscs := history.ByNode("la2"); len(rscs) != 1 || len(rscs["p_web:1"]) != 1 {
+		t.Errorf("Unexpected operations on la2: %+v", rscs)
+	}
+}
@@ -0,0 +1,76 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// InProgress reports whether the operation was started but has not
+// finished yet. Besides operations recorded as pending (with the
+// record-pending option), this includes operations the controller has
+// initiated, i.e. that have a transition key, but no result yet.
+func (o LrmOperation) InProgress() bool {
+	return o.Pending() || (o.TransitionKey != "" && o.RcCode < 0)
+}
+
+// PendingActions returns the operations that are in progress, keyed by
+// resource. The operations of a resource are sorted by node and call ID.
+func (c *CIB) PendingActions() (map[string][]LrmOperation, error) {
+	history, err := c.OperationHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingActions(history), nil
+}
+
+func pendingActions(history OperationHistory) map[string][]LrmOperation {
+	pending := make(map[string][]LrmOperation)
+	for _, node := range history.Nodes() {
+		resources := history.byNode[node]
+		for _, lrmID := range sortedKeys(resources) {
+			for _, op := range resources[lrmID] {
+				if op.InProgress() {
+					pending[op.Resource] = append(pending[op.Resource], op)
+				}
+			}
+		}
+	}
+	return pending
+}
+
+// WaitForIdle waits until no operations are in progress in the cluster,
+// polling the CIB with the default backoff. It returns the context's error
+// if the context is done first.
+//
+// Only operations that have already been initiated are visible in the CIB,
+// so the cluster may start new actions right after WaitForIdle returned,
+// e.g. to recover a resource.
+func (c *CIB) WaitForIdle(ctx context.Context) error {
+	var pending map[string][]LrmOperation
+	err := pollBackoff(ctx, Backoff{}, func() (bool, error) {
+		history, err := c.OperationHistory()
+		if err != nil {
+			return false, err
+		}
+
+		pending = pendingActions(history)
+		if len(pending) > 0 {
+			log.Debugf("Waiting for pending actions of %d resource(s)", len(pending))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		resources := make([]string, 0, len(pending))
+		for id := range pending {
+			resources = append(resources, id)
+		}
+		sort.Strings(resources)
+		return fmt.Errorf("cluster did not become idle, actions pending for %v: %w", resources, err)
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package cib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const pendingXML = `<cib><status>
+	<node_state id="1" uname="la1"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_db">
+			<lrm_rsc_op id="p_db_last_0" operation="start" call-id="-1" rc-code="193" op-status="-1" interval="0" transition-key="4:9:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+		</lrm_resource>
+		<lrm_resource id="p_web:0">
+			<lrm_rsc_op id="p_web_last_0" operation="start" call-id="5" rc-code="0" op-status="0" interval="0" transition-key="5:8:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+	<node_state id="2" uname="la2"><lrm id="2"><lrm_resources>
+		<lrm_resource id="p_web:1">
+			<lrm_rsc_op id="p_web_last_0" operation="stop" call-id="6" transition-key="6:9:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+
+func TestPendingActions(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return pendingXML, "", nil
+		},
+	}
+
+	var cib CIB
+	pending, err := cib.PendingActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := make(map[string][]string)
+	for id, ops := range pending {
+		for _, op := range ops {
+			actual[id] = append(actual[id], op.Node+" "+op.Operation)
+		}
+	}
+	expect := map[string][]string{
+		"p_db":  {"la1 start"},
+		"p_web": {"la2 stop"},
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected pending actions")
+		t.Errorf("Expected: %v", expect)
+		t.Errorf("Actual: %v", actual)
+	}
+}
+
+func TestWaitForIdle(t *testing.T) {
+	idle := `<cib><status><node_state id="1" uname="la1"/></status></cib>`
+
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			if reads < 3 {
+				return pendingXML, "", nil
+			}
+			return idle, "", nil
+		},
+	}
+
+	cibPollRetryDelay = 1 * time.Millisecond
+
+	var cib CIB
+	err := cib.WaitForIdle(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 reads of the CIB, got %d", reads)
+	}
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return pendingXML, "", nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = cib.WaitForIdle(ctx)
+	if err == nil {
+		t.Fatal("Expected timeout")
+	}
+	if !strings.Contains(err.Error(), "[p_db p_web]") {
+		t.Errorf("Expected pending resources in error: %s", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 5 * time.Second}.withDefaults()
+
+	var actual []time.Duration
+	interval := backoff.Initial
+	for i := 0; i < 5; i++ {
+		actual = append(actual, interval)
+		interval = backoff.next(interval)
+	}
+
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected intervals: %v", actual)
+	}
+}
@@ -0,0 +1,313 @@
+package cib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// PlacementOptions controls the offline evaluation of location constraints.
+type PlacementOptions struct {
+	// Now is the point in time date expressions are evaluated against.
+	// If it is the zero time, the current time is used.
+	Now time.Time
+	// NodeAttributes adds or overrides attributes of nodes, keyed by node
+	// name. This can be used to evaluate rules against hypothetical node
+	// attributes.
+	NodeAttributes map[string]map[string]string
+}
+
+// PlacementContribution is a single score that a location constraint
+// contributes to the placement of a resource on a node.
+type PlacementContribution struct {
+	Node string
+	// Constraint is the ID of the location constraint
+	Constraint string
+	// Rule is the ID of the rule that passed, if the score comes from a rule
+	Rule string
+	// Resource is the resource the constraint applies to. This differs from
+	// the resource of the placement if the constraint is inherited from a
+	// group or clone.
+	Resource string
+	Score    Score
+}
+
+// ResourcePlacement is the result of evaluating all location constraints for
+// a resource.
+type ResourcePlacement struct {
+	Resource string
+	// Scores contains the location score of the resource on each node
+	Scores map[string]Score
+	// Allowed lists the nodes with a non-negative score, on which the
+	// resource may run, ordered by descending score.
+	Allowed []string
+	// Preferred lists the nodes with a positive score, ordered by
+	// descending score.
+	Preferred     []string
+	Contributions []PlacementContribution
+}
+
+// ruleNode is a node together with the attributes rules are evaluated
+// against.
+type ruleNode struct {
+	Name       string
+	Attributes map[string]string
+}
+
+// EvaluatePlacement evaluates all location constraints, including their
+// rules, against the configured nodes without consulting the cluster. It
+// returns the resulting location scores of every resource, keyed by
+// resource ID.
+//
+// Constraints on groups, clones and bundles also apply to the resources they
+// contain. Only location scores are considered: colocation, stickiness and
+// the current state of the cluster are not taken into account, and
+// constraints restricted to a role only affect promotion and are ignored.
+func (c *CIB) EvaluatePlacement(opts PlacementOptions) (map[string]ResourcePlacement, error) {
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := c.ListResources()
+	if err != nil {
+		return nil, err
+	}
+
+	cons, err := c.ListConstraints()
+	if err != nil {
+		return nil, err
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	nodes := ruleNodes(root, opts.NodeAttributes)
+	symmetric := true
+	if value := clusterOption(root, "symmetric-cluster"); value != "" {
+		symmetric = isTrue(value)
+	}
+
+	byID := make(map[string]Resource)
+	contributions := make(map[string][]PlacementContribution)
+	for _, rsc := range resources {
+		byID[rsc.ID] = rsc
+	}
+
+	for _, loc := range cons.Locations {
+		if loc.Role != "" {
+			continue
+		}
+
+		targets, err := locationTargets(loc, resources)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, target := range targets {
+			rsc := byID[target]
+			if loc.Node != "" {
+				score, err := ParseScore(loc.Score)
+				if err != nil {
+					return nil, fmt.Errorf("location %s: %w", loc.ID, err)
+				}
+				contributions[target] = append(contributions[target], PlacementContribution{
+					Node:       loc.Node,
+					Constraint: loc.ID,
+					Resource:   target,
+					Score:      score,
+				})
+			}
+
+			for _, rule := range loc.Rules {
+				if rule.Role != "" {
+					continue
+				}
+				for _, node := range nodes {
+					ctx := RuleContext{
+						NodeAttributes: node.Attributes,
+						ResourceParams: rsc.Params,
+						ResourceMeta:   rsc.Meta,
+						Now:            now,
+					}
+					ok, err := rule.Evaluate(ctx)
+					if err != nil {
+						return nil, fmt.Errorf("location %s: %w", loc.ID, err)
+					}
+					if !ok {
+						continue
+					}
+					score, err := rule.RuleScore(ctx)
+					if err != nil {
+						return nil, fmt.Errorf("location %s: rule %s: %w", loc.ID, rule.ID, err)
+					}
+					contributions[target] = append(contributions[target], PlacementContribution{
+						Node:       node.Name,
+						Constraint: loc.ID,
+						Rule:       rule.ID,
+						Resource:   target,
+						Score:      score,
+					})
+				}
+			}
+		}
+	}
+
+	nodeIndex := make(map[string]int)
+	for i, node := range nodes {
+		nodeIndex[node.Name] = i
+	}
+
+	placements := make(map[string]ResourcePlacement)
+	for _, rsc := range resources {
+		var inherited []PlacementContribution
+		for id := rsc.ID; id != ""; id = byID[id].Parent {
+			inherited = append(inherited, contributions[id]...)
+		}
+
+		touched := make(map[string]bool)
+		sums := make(map[string]Score)
+		for _, contrib := range inherited {
+			touched[contrib.Node] = true
+			sums[contrib.Node] = sums[contrib.Node].Add(contrib.Score)
+		}
+
+		placement := ResourcePlacement{
+			Resource:      rsc.ID,
+			Scores:        make(map[string]Score),
+			Contributions: inherited,
+		}
+		for _, node := range nodes {
+			score := sums[node.Name]
+			if !symmetric && !touched[node.Name] {
+				score = ScoreMinusInfinity
+			}
+			placement.Scores[node.Name] = score
+			if score >= 0 {
+				placement.Allowed = append(placement.Allowed, node.Name)
+			}
+			if score > 0 {
+				placement.Preferred = append(placement.Preferred, node.Name)
+			}
+		}
+
+		for _, list := range [][]string{placement.Allowed, placement.Preferred} {
+			sort.SliceStable(list, func(i, j int) bool {
+				si, sj := placement.Scores[list[i]], placement.Scores[list[j]]
+				if si != sj {
+					return si > sj
+				}
+				return nodeIndex[list[i]] < nodeIndex[list[j]]
+			})
+		}
+
+		placements[rsc.ID] = placement
+	}
+
+	return placements, nil
+}
+
+// locationTargets resolves the resources a location constraint applies to.
+func locationTargets(loc LocationConstraint, resources []Resource) ([]string, error) {
+	var targets []string
+	if loc.Rsc != "" {
+		targets = append(targets, loc.Rsc)
+	}
+
+	if loc.RscPattern != "" {
+		re, err := regexp.Compile(loc.RscPattern)
+		if err != nil {
+			return nil, fmt.Errorf("location %s: invalid rsc-pattern: %w", loc.ID, err)
+		}
+		for _, rsc := range resources {
+			if re.MatchString(rsc.ID) {
+				targets = append(targets, rsc.ID)
+			}
+		}
+	}
+
+	for _, set := range loc.Sets {
+		if set.Role != "" {
+			continue
+		}
+		targets = append(targets, set.Resources...)
+	}
+
+	return targets, nil
+}
+
+// ruleNodes collects the configured nodes together with the attributes
+// rules are evaluated against. The extra attributes are merged on top.
+func ruleNodes(root *xmltree.Element, extra map[string]map[string]string) []ruleNode {
+	clusterName := clusterOption(root, "cluster-name")
+
+	var nodes []ruleNode
+	for _, elem := range root.FindElements("configuration/nodes/node") {
+		name := elem.SelectAttrValue("uname", "")
+		if name == "" {
+			continue
+		}
+
+		attrs := nvsetValues(elem, cibTagInstAttr)
+		attrs["#uname"] = name
+		attrs["#id"] = elem.SelectAttrValue(cibAttrKeyID, "")
+		attrs["#kind"] = "cluster"
+		if elem.SelectAttrValue("type", "") == "remote" {
+			attrs["#kind"] = "remote"
+		}
+		if clusterName != "" {
+			attrs["#cluster-name"] = clusterName
+		}
+		for k, v := range extra[name] {
+			attrs[k] = v
+		}
+
+		nodes = append(nodes, ruleNode{Name: name, Attributes: attrs})
+	}
+
+	return nodes
+}
+
+// EvaluateResourceAttributes evaluates the instance and meta attribute sets
+// of a resource, including their rules, as they would apply on the given
+// node at the given point in time.
+func (c *CIB) EvaluateResourceAttributes(id, node string, now time.Time) (params, meta map[string]string, err error) {
+	root, err := c.root()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	elem := findResourceElement(root, id)
+	if elem == nil {
+		return nil, nil, fmt.Errorf("resource %s not found", id)
+	}
+
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	ctx := RuleContext{Now: now, NodeAttributes: map[string]string{}}
+	for _, n := range ruleNodes(root, nil) {
+		if n.Name == node {
+			ctx.NodeAttributes = n.Attributes
+		}
+	}
+	ctx.ResourceParams = nvsetValues(elem, cibTagInstAttr)
+	ctx.ResourceMeta = nvsetValues(elem, cibTagMetaAttr)
+
+	params, err = EvaluateNvSets(elem, cibTagInstAttr, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err = EvaluateNvSets(elem, cibTagMetaAttr, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return params, meta, nil
+}
@@ -0,0 +1,219 @@
+package cib
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TransitionAction is an action of a transition predicted by the scheduler.
+type TransitionAction string
+
+// Actions of the transition summary
+const (
+	ActionStart     TransitionAction = "Start"
+	ActionStop      TransitionAction = "Stop"
+	ActionRestart   TransitionAction = "Restart"
+	ActionRecover   TransitionAction = "Recover"
+	ActionMove      TransitionAction = "Move"
+	ActionMigrate   TransitionAction = "Migrate"
+	ActionPromote   TransitionAction = "Promote"
+	ActionDemote    TransitionAction = "Demote"
+	ActionRepromote TransitionAction = "Re-promote"
+	ActionFence     TransitionAction = "Fence"
+	ActionShutdown  TransitionAction = "Shutdown"
+)
+
+// PlannedAction is a single entry of the transition summary.
+type PlannedAction struct {
+	Action TransitionAction
+	// Resource is the resource the action applies to, including the
+	// instance number of clone instances, e.g. "p_drbd:0". It is empty for
+	// node actions like fencing.
+	Resource string
+	// Node is the node the action takes place on, i.e. the destination of
+	// moves and migrations, or the node that is fenced or shut down.
+	Node string
+	// From is the node a resource is moved or migrated away from
+	From string
+	// FromRole and Role are the roles of promotable clone instances before
+	// and after the action, if the summary mentions them.
+	FromRole string
+	Role     string
+	// FenceAction is the fencing action for ActionFence
+	FenceAction FenceAction
+	// Reason explains the action, e.g. "due to node availability"
+	Reason string
+}
+
+// Transition is the set of actions the scheduler would perform to bring the
+// cluster into the state described by a CIB.
+type Transition struct {
+	Actions []PlannedAction
+}
+
+// Empty reports whether the cluster would not do anything.
+func (t Transition) Empty() bool {
+	return len(t.Actions) == 0
+}
+
+// ResourceActions returns the actions planned for a resource. Actions for
+// clone instances are included when asking for the primitive.
+func (t Transition) ResourceActions(id string) []PlannedAction {
+	var actions []PlannedAction
+	for _, action := range t.Actions {
+		if action.Resource != "" && (action.Resource == id || lrmResourceID(action.Resource) == id) {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// Interrupts reports whether the transition would stop a running instance
+// of the resource, i.e. stop, restart, recover, move or demote it. Live
+// migrations are not considered an interruption.
+func (t Transition) Interrupts(id string) bool {
+	for _, action := range t.ResourceActions(id) {
+		switch action.Action {
+		case ActionStop, ActionRestart, ActionRecover, ActionMove, ActionDemote, ActionRepromote:
+			return true
+		}
+	}
+	return false
+}
+
+// FencedNodes returns the nodes that would be fenced.
+func (t Transition) FencedNodes() []string {
+	var nodes []string
+	for _, action := range t.Actions {
+		if action.Action == ActionFence {
+			nodes = append(nodes, action.Node)
+		}
+	}
+	return nodes
+}
+
+var (
+	// summaryLine matches an entry of the transition summary, e.g.
+	// "  * Move       p_ip      ( la1 -> la2 )  due to node availability"
+	summaryLine = regexp.MustCompile(`^\*?\s*(\S+)\s+(\S+)\s+\(\s*(.*?)\s*\)\s*(.*)$`)
+	// fenceLine matches fencing entries, e.g.
+	// "  * Fence (reboot) la3 'peer is no longer part of the cluster'"
+	fenceLine = regexp.MustCompile(`^\*?\s*Fence(?:\s+\((\S+)\))?\s+(\S+)\s*(.*)$`)
+	// shutdownLine matches shutdown entries, e.g. "  * Shutdown la2"
+	shutdownLine = regexp.MustCompile(`^\*?\s*Shutdown\s+(\S+)$`)
+)
+
+// transitionRoles are the role names that appear in the transition summary
+var transitionRoles = map[string]bool{
+	"Started":    true,
+	"Stopped":    true,
+	"Slave":      true,
+	"Master":     true,
+	"Unpromoted": true,
+	"Promoted":   true,
+}
+
+// Plan runs the scheduler on the current document, including changes that
+// have not been committed with Update, and returns the transition the
+// cluster would perform if the document was committed.
+//
+// The prediction is based on the status section of the document, so it
+// becomes less accurate the longer ago the configuration was read.
+func (c *CIB) Plan() (Transition, error) {
+	output, err := c.simulate(false, "--run")
+	if err != nil {
+		return Transition{}, err
+	}
+
+	return parseTransition(output), nil
+}
+
+// parseTransition parses the "Transition Summary" section of crm_simulate's
+// output.
+func parseTransition(output string) Transition {
+	var transition Transition
+
+	inSummary := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "Transition Summary:" {
+			inSummary = true
+			continue
+		}
+		if !inSummary || line == "" {
+			continue
+		}
+		if !strings.HasPrefix(raw, " ") && !strings.HasPrefix(raw, "\t") && strings.HasSuffix(line, ":") {
+			// next section
+			break
+		}
+
+		action, ok := parsePlannedAction(line)
+		if !ok {
+			log.Debugf("Ignoring transition summary entry '%s'", line)
+			continue
+		}
+		transition.Actions = append(transition.Actions, action)
+	}
+
+	return transition
+}
+
+func parsePlannedAction(line string) (PlannedAction, bool) {
+	if match := fenceLine.FindStringSubmatch(line); match != nil {
+		action := PlannedAction{
+			Action:      ActionFence,
+			Node:        match[2],
+			FenceAction: FenceAction(match[1]),
+			Reason:      strings.Trim(match[3], "'"),
+		}
+		if action.FenceAction == "" {
+			action.FenceAction = FenceReboot
+		}
+		return action, true
+	}
+
+	if match := shutdownLine.FindStringSubmatch(line); match != nil {
+		return PlannedAction{Action: ActionShutdown, Node: match[1]}, true
+	}
+
+	match := summaryLine.FindStringSubmatch(line)
+	if match == nil || match[1] == "Leave" {
+		// resources that are left alone are only listed in verbose mode
+		return PlannedAction{}, false
+	}
+
+	action := PlannedAction{
+		Action:   TransitionAction(match[1]),
+		Resource: match[2],
+		Reason:   match[4],
+	}
+
+	// The details are "node", "role node", "node -> node",
+	// "role -> role node" or "role node -> role node".
+	from, to := "", match[3]
+	if i := strings.Index(to, "->"); i >= 0 {
+		from, to = strings.TrimSpace(to[:i]), strings.TrimSpace(to[i+2:])
+	}
+	for _, token := range strings.Fields(from) {
+		if transitionRoles[token] {
+			action.FromRole = token
+		} else {
+			action.From = token
+		}
+	}
+	for _, token := range strings.Fields(to) {
+		if transitionRoles[token] {
+			action.Role = token
+		} else {
+			action.Node = token
+		}
+	}
+
+	return action, true
+}
@@ -0,0 +1,89 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const simulateRun = `Current cluster status:
+  * Node List:
+    * Online: [ la1 la2 ]
+    * OFFLINE: [ la3 ]
+
+  * Full List of Resources:
+    * p_ip	(ocf::heartbeat:IPaddr2):	 Started la1
+
+Transition Summary:
+  * Fence (reboot) la3 'peer is no longer part of the cluster'
+  * Move       p_ip       ( la1 -> la2 )
+  * Restart    p_db       ( la1 )  due to required g_web running
+  * Start      p_web      ( la2 )
+  * Stop       p_drbd:1   ( Slave la2 )  due to node availability
+  * Promote    p_drbd:0   ( Slave -> Master la1 )
+  * Demote     p_nfs:0    ( Promoted -> Unpromoted la2 )
+  * Shutdown la2
+
+Executing Cluster Transition:
+  * Resource action: p_ip            stop on la1
+`
+
+func TestPlan(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return simulateXML, "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.ReadConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulateCommand = &argsCommand{
+		func(stdin string, args []string) (string, string, error) {
+			if !cmp.Equal(args, []string{"--xml-pipe", "--run"}) {
+				t.Errorf("Unexpected arguments: %v", args)
+			}
+			if normalizeXML(t, stdin) != normalizeXML(t, simulateXML) {
+				t.Errorf("Unexpected CIB passed to crm_simulate: %s", stdin)
+			}
+			return simulateRun, "", nil
+		},
+	}
+
+	transition, err := cib.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []PlannedAction{
+		{Action: ActionFence, Node: "la3", FenceAction: FenceReboot, Reason: "peer is no longer part of the cluster"},
+		{Action: ActionMove, Resource: "p_ip", Node: "la2", From: "la1"},
+		{Action: ActionRestart, Resource: "p_db", Node: "la1", Reason: "due to required g_web running"},
+		{Action: ActionStart, Resource: "p_web", Node: "la2"},
+		{Action: ActionStop, Resource: "p_drbd:1", Node: "la2", Role: "Slave", Reason: "due to node availability"},
+		{Action: ActionPromote, Resource: "p_drbd:0", Node: "la1", FromRole: "Slave", Role: "Master"},
+		{Action: ActionDemote, Resource: "p_nfs:0", Node: "la2", FromRole: "Promoted", Role: "Unpromoted"},
+		{Action: ActionShutdown, Node: "la2"},
+	}
+	if !cmp.Equal(transition.Actions, expect) {
+		t.Errorf("Unexpected transition")
+		t.Errorf("Diff: %s", cmp.Diff(expect, transition.Actions))
+	}
+
+	if !transition.Interrupts("p_db") || !transition.Interrupts("p_drbd") {
+		t.Errorf("Expected p_db and p_drbd to be interrupted")
+	}
+	if transition.Interrupts("p_web") {
+		t.Errorf("Did not expect p_web to be interrupted")
+	}
+	if nodes := transition.FencedNodes(); !cmp.Equal(nodes, []string{"la3"}) {
+		t.Errorf("Unexpected fenced nodes: %v", nodes)
+	}
+
+	if !parseTransition("Transition Summary:\n\n").Empty() {
+		t.Errorf("Expected empty transition")
+	}
+}
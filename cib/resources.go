@@ -0,0 +1,186 @@
+package cib
+
+import (
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// ResourceKind is the type of a resource element in the CIB.
+type ResourceKind string
+
+const (
+	// KindPrimitive is a single resource managed by a resource agent
+	KindPrimitive ResourceKind = "primitive"
+	// KindGroup is an ordered and colocated collection of resources
+	KindGroup ResourceKind = "group"
+	// KindClone is a resource that runs on multiple nodes
+	KindClone ResourceKind = "clone"
+	// KindMaster is the legacy representation of a promotable clone
+	KindMaster ResourceKind = "master"
+	// KindBundle is a container based resource
+	KindBundle ResourceKind = "bundle"
+)
+
+// resourceKinds lists all resource element tags, in the order they are
+// searched for when resolving a resource ID.
+var resourceKinds = []ResourceKind{KindPrimitive, KindGroup, KindClone, KindMaster, KindBundle}
+
+// Resource is the configuration of a single resource from the
+// configuration/resources section of the CIB.
+type Resource struct {
+	ID   string
+	Kind ResourceKind
+	// Class, Provider and Type describe the resource agent of a primitive,
+	// e.g. "ocf", "heartbeat" and "IPaddr2".
+	Class    string
+	Provider string
+	Type     string
+	// Template is the ID of the rsc_template a primitive is derived from
+	Template string
+	// Parent is the ID of the group, clone or bundle containing this
+	// resource, or empty if this is a top level resource.
+	Parent string
+	// Children are the IDs of the resources directly contained in this one
+	Children []string
+	// Meta and Params contain the nvpairs of all meta_attributes and
+	// instance_attributes sets that are not restricted by a rule.
+	Meta       map[string]string
+	Params     map[string]string
+	Operations []ResourceOperation
+}
+
+// ResourceOperation is an <op> element of a primitive.
+type ResourceOperation struct {
+	ID       string
+	Name     string
+	Interval string
+	Timeout  string
+	Role     string
+}
+
+// IsPromotable returns true if the resource is a promotable clone.
+func (r Resource) IsPromotable() bool {
+	if r.Kind == KindMaster {
+		return true
+	}
+	return r.Kind == KindClone && isTrue(r.Meta["promotable"])
+}
+
+// ListResources returns all configured resources, including the members of
+// groups, clones and bundles, in document order. Containers are listed
+// before the resources they contain.
+func (c *CIB) ListResources() ([]Resource, error) {
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+
+	resourcesElem := root.FindElement("configuration/resources")
+	if resourcesElem == nil {
+		return nil, nil
+	}
+
+	var resources []Resource
+	collectResources(resourcesElem, "", &resources)
+
+	return resources, nil
+}
+
+func collectResources(elem *xmltree.Element, parent string, resources *[]Resource) {
+	for _, child := range elem.ChildElements() {
+		kind := ResourceKind(child.Tag)
+		if !isResourceKind(kind) {
+			continue
+		}
+
+		rsc := parseResource(child, parent)
+		idx := len(*resources)
+		*resources = append(*resources, rsc)
+
+		collectResources(child, rsc.ID, resources)
+		for _, sub := range (*resources)[idx+1:] {
+			if sub.Parent == rsc.ID {
+				(*resources)[idx].Children = append((*resources)[idx].Children, sub.ID)
+			}
+		}
+	}
+}
+
+func parseResource(elem *xmltree.Element, parent string) Resource {
+	rsc := Resource{
+		ID:       elem.SelectAttrValue(cibAttrKeyID, ""),
+		Kind:     ResourceKind(elem.Tag),
+		Class:    elem.SelectAttrValue("class", ""),
+		Provider: elem.SelectAttrValue("provider", ""),
+		Type:     elem.SelectAttrValue("type", ""),
+		Template: elem.SelectAttrValue("template", ""),
+		Parent:   parent,
+		Meta:     nvsetValues(elem, cibTagMetaAttr),
+		Params:   nvsetValues(elem, cibTagInstAttr),
+	}
+
+	for _, op := range elem.FindElements("operations/op") {
+		rsc.Operations = append(rsc.Operations, ResourceOperation{
+			ID:       op.SelectAttrValue(cibAttrKeyID, ""),
+			Name:     op.SelectAttrValue(cibAttrKeyName, ""),
+			Interval: op.SelectAttrValue("interval", ""),
+			Timeout:  op.SelectAttrValue("timeout", ""),
+			Role:     op.SelectAttrValue("role", ""),
+		})
+	}
+
+	return rsc
+}
+
+func isResourceKind(kind ResourceKind) bool {
+	for _, k := range resourceKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// findResourceElement finds a resource element of any kind by its ID.
+func findResourceElement(root *xmltree.Element, id string) *xmltree.Element {
+	for _, kind := range resourceKinds {
+		elem := root.FindElement("configuration/resources//" + string(kind) + "[@id='" + id + "']")
+		if elem != nil {
+			return elem
+		}
+	}
+	return nil
+}
+
+// nvsetValues merges the nvpairs of all unconditional sets with the given
+// tag (e.g. meta_attributes) directly below elem. If a name is defined more
+// than once, the first definition wins, as it does in Pacemaker.
+func nvsetValues(elem *xmltree.Element, tag string) map[string]string {
+	values := make(map[string]string)
+	for _, set := range elem.SelectElements(tag) {
+		if set.SelectElement("rule") != nil {
+			continue
+		}
+		for _, nvpair := range set.SelectElements(cibTagNvPair) {
+			name := nvpair.SelectAttrValue(cibAttrKeyName, "")
+			if name == "" {
+				continue
+			}
+			if _, ok := values[name]; ok {
+				continue
+			}
+			values[name] = nvpair.SelectAttrValue(cibAttrKeyValue, "")
+		}
+	}
+	return values
+}
+
+// isTrue interprets a boolean CIB value the way Pacemaker's crm_is_true does.
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "on", "yes", "y", "1":
+		return true
+	}
+	return false
+}
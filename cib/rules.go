@@ -0,0 +1,513 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// RuleContext contains the data a rule is evaluated against.
+type RuleContext struct {
+	// NodeAttributes contains the attributes of the node the rule is
+	// evaluated for, including built-in attributes such as #uname, #id
+	// and #kind.
+	NodeAttributes map[string]string
+	// ResourceParams and ResourceMeta are consulted by expressions with
+	// value-source="param" or value-source="meta".
+	ResourceParams map[string]string
+	ResourceMeta   map[string]string
+	// Now is the point in time date expressions are evaluated against
+	Now time.Time
+}
+
+// Rule is a <rule> element as used in location constraints and in
+// conditional attribute sets.
+type Rule struct {
+	ID             string
+	Score          string
+	ScoreAttribute string
+	// BooleanOp is either "and" (the default) or "or"
+	BooleanOp       string
+	Role            string
+	Expressions     []Expression
+	DateExpressions []DateExpression
+	Rules           []Rule
+}
+
+// Expression is an <expression> element comparing a node attribute.
+type Expression struct {
+	ID        string
+	Attribute string
+	Operation string
+	Value     string
+	// Type is one of "string", "integer", "number" or "version"
+	Type        string
+	ValueSource string
+}
+
+// DateExpression is a <date_expression> element.
+type DateExpression struct {
+	ID string
+	// Operation is one of "in_range", "gt", "lt" or "date_spec"
+	Operation string
+	Start     string
+	End       string
+	Duration  *DateSpec
+	DateSpec  *DateSpec
+}
+
+// DateSpec holds the attributes of a <date_spec> or <duration> element.
+// For date_spec, each field is a single value or a range like "1-5". For
+// duration, each field is a plain number.
+type DateSpec struct {
+	Years     string
+	Months    string
+	Weeks     string
+	Days      string
+	Hours     string
+	Minutes   string
+	Seconds   string
+	Monthdays string
+	Weekdays  string
+	Yeardays  string
+	Weekyears string
+}
+
+func parseRule(elem *xmltree.Element) Rule {
+	rule := Rule{
+		ID:             elem.SelectAttrValue(cibAttrKeyID, ""),
+		Score:          elem.SelectAttrValue("score", ""),
+		ScoreAttribute: elem.SelectAttrValue("score-attribute", ""),
+		BooleanOp:      elem.SelectAttrValue("boolean-op", "and"),
+		Role:           elem.SelectAttrValue("role", ""),
+	}
+
+	for _, child := range elem.ChildElements() {
+		switch child.Tag {
+		case "expression":
+			rule.Expressions = append(rule.Expressions, Expression{
+				ID:          child.SelectAttrValue(cibAttrKeyID, ""),
+				Attribute:   child.SelectAttrValue("attribute", ""),
+				Operation:   child.SelectAttrValue(cibAttrKeyOperation, ""),
+				Value:       child.SelectAttrValue(cibAttrKeyValue, ""),
+				Type:        child.SelectAttrValue("type", ""),
+				ValueSource: child.SelectAttrValue("value-source", "literal"),
+			})
+		case "date_expression":
+			expr := DateExpression{
+				ID:        child.SelectAttrValue(cibAttrKeyID, ""),
+				Operation: child.SelectAttrValue(cibAttrKeyOperation, "in_range"),
+				Start:     child.SelectAttrValue("start", ""),
+				End:       child.SelectAttrValue("end", ""),
+			}
+			if d := child.SelectElement("duration"); d != nil {
+				expr.Duration = parseDateSpec(d)
+			}
+			if d := child.SelectElement("date_spec"); d != nil {
+				expr.DateSpec = parseDateSpec(d)
+			}
+			rule.DateExpressions = append(rule.DateExpressions, expr)
+		case "rule":
+			rule.Rules = append(rule.Rules, parseRule(child))
+		}
+	}
+
+	return rule
+}
+
+func parseDateSpec(elem *xmltree.Element) *DateSpec {
+	return &DateSpec{
+		Years:     elem.SelectAttrValue("years", ""),
+		Months:    elem.SelectAttrValue("months", ""),
+		Weeks:     elem.SelectAttrValue("weeks", ""),
+		Days:      elem.SelectAttrValue("days", ""),
+		Hours:     elem.SelectAttrValue("hours", ""),
+		Minutes:   elem.SelectAttrValue("minutes", ""),
+		Seconds:   elem.SelectAttrValue("seconds", ""),
+		Monthdays: elem.SelectAttrValue("monthdays", ""),
+		Weekdays:  elem.SelectAttrValue("weekdays", ""),
+		Yeardays:  elem.SelectAttrValue("yeardays", ""),
+		Weekyears: elem.SelectAttrValue("weekyears", ""),
+	}
+}
+
+// Evaluate checks whether the rule passes in the given context.
+//
+// Rules with boolean-op "and" pass if all of their expressions pass, rules
+// with boolean-op "or" pass if any of them does.
+func (r Rule) Evaluate(ctx RuleContext) (bool, error) {
+	var results []bool
+	for _, expr := range r.Expressions {
+		ok, err := expr.Evaluate(ctx)
+		if err != nil {
+			return false, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		results = append(results, ok)
+	}
+	for _, expr := range r.DateExpressions {
+		ok, err := expr.Evaluate(ctx.Now)
+		if err != nil {
+			return false, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		results = append(results, ok)
+	}
+	for _, sub := range r.Rules {
+		ok, err := sub.Evaluate(ctx)
+		if err != nil {
+			return false, err
+		}
+		results = append(results, ok)
+	}
+
+	if r.BooleanOp == "or" {
+		for _, ok := range results {
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	for _, ok := range results {
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RuleScore returns the score a passing rule contributes for a node, taken
+// either from the score attribute or from the node attribute named by
+// score-attribute.
+func (r Rule) RuleScore(ctx RuleContext) (Score, error) {
+	if r.ScoreAttribute != "" {
+		return ParseScore(ctx.NodeAttributes[r.ScoreAttribute])
+	}
+	return ParseScore(r.Score)
+}
+
+// Evaluate checks whether the expression passes in the given context.
+func (e Expression) Evaluate(ctx RuleContext) (bool, error) {
+	actual, defined := ctx.NodeAttributes[e.Attribute]
+
+	switch e.Operation {
+	case "defined":
+		return defined, nil
+	case "not_defined":
+		return !defined, nil
+	}
+
+	expected := e.Value
+	switch e.ValueSource {
+	case "param":
+		expected = ctx.ResourceParams[e.Value]
+	case "meta":
+		expected = ctx.ResourceMeta[e.Value]
+	}
+
+	if !defined {
+		// nothing to compare, but an undefined attribute certainly is
+		// not equal to the value
+		return e.Operation == "ne", nil
+	}
+
+	typ := e.Type
+	if typ == "" {
+		switch e.Operation {
+		case "eq", "ne":
+			typ = "string"
+		default:
+			typ = "number"
+		}
+	}
+
+	cmp, err := compareValues(actual, expected, typ)
+	if err != nil {
+		return false, fmt.Errorf("expression %s: %w", e.ID, err)
+	}
+
+	switch e.Operation {
+	case "eq":
+		return cmp == 0, nil
+	case "ne":
+		return cmp != 0, nil
+	case "lt":
+		return cmp < 0, nil
+	case "lte":
+		return cmp <= 0, nil
+	case "gt":
+		return cmp > 0, nil
+	case "gte":
+		return cmp >= 0, nil
+	}
+
+	return false, fmt.Errorf("expression %s: unknown operation '%s'", e.ID, e.Operation)
+}
+
+// compareValues compares two attribute values as the given type. Values
+// that cannot be interpreted as numbers are compared as strings, as
+// Pacemaker does.
+func compareValues(a, b, typ string) (int, error) {
+	switch typ {
+	case "integer", "number":
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			switch {
+			case fa < fb:
+				return -1, nil
+			case fa > fb:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case "version":
+		return compareVersions(a, b), nil
+	case "string":
+	default:
+		return 0, fmt.Errorf("unknown type '%s'", typ)
+	}
+
+	return strings.Compare(a, b), nil
+}
+
+func compareVersions(a, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na < nb {
+			return -1
+		}
+		if na > nb {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Evaluate checks whether the date expression passes at the given time.
+func (e DateExpression) Evaluate(now time.Time) (bool, error) {
+	var start, end time.Time
+	var err error
+	if e.Start != "" {
+		start, err = parseCibTime(e.Start)
+		if err != nil {
+			return false, fmt.Errorf("date expression %s: %w", e.ID, err)
+		}
+	}
+	if e.End != "" {
+		end, err = parseCibTime(e.End)
+		if err != nil {
+			return false, fmt.Errorf("date expression %s: %w", e.ID, err)
+		}
+	} else if e.Duration != nil && !start.IsZero() {
+		end, err = e.Duration.addTo(start)
+		if err != nil {
+			return false, fmt.Errorf("date expression %s: %w", e.ID, err)
+		}
+	}
+
+	switch e.Operation {
+	case "in_range":
+		if start.IsZero() && end.IsZero() {
+			return false, fmt.Errorf("date expression %s: in_range needs start or end", e.ID)
+		}
+		if !start.IsZero() && now.Before(start) {
+			return false, nil
+		}
+		if !end.IsZero() && now.After(end) {
+			return false, nil
+		}
+		return true, nil
+	case "gt":
+		if start.IsZero() {
+			return false, fmt.Errorf("date expression %s: gt needs start", e.ID)
+		}
+		return now.After(start), nil
+	case "lt":
+		if end.IsZero() {
+			return false, fmt.Errorf("date expression %s: lt needs end", e.ID)
+		}
+		return now.Before(end), nil
+	case "date_spec":
+		if e.DateSpec == nil {
+			return false, fmt.Errorf("date expression %s: date_spec element missing", e.ID)
+		}
+		return e.DateSpec.matches(now)
+	}
+
+	return false, fmt.Errorf("date expression %s: unknown operation '%s'", e.ID, e.Operation)
+}
+
+// matches checks whether all fields of the date_spec match the given time.
+func (d DateSpec) matches(t time.Time) (bool, error) {
+	weekyear, week := t.ISOWeek()
+	weekday := int(t.Weekday())
+	if weekday == 0 {
+		// date_spec uses ISO weekdays, where Sunday is 7
+		weekday = 7
+	}
+
+	fields := []struct {
+		spec  string
+		value int
+	}{
+		{d.Years, t.Year()},
+		{d.Months, int(t.Month())},
+		{d.Monthdays, t.Day()},
+		{d.Hours, t.Hour()},
+		{d.Minutes, t.Minute()},
+		{d.Seconds, t.Second()},
+		{d.Weekdays, weekday},
+		{d.Yeardays, t.YearDay()},
+		{d.Weekyears, weekyear},
+		{d.Weeks, week},
+	}
+
+	for _, f := range fields {
+		if f.spec == "" {
+			continue
+		}
+		ok, err := inRange(f.spec, f.value)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// inRange checks a value against a date_spec range such as "9", "9-17" or
+// "9-".
+func inRange(spec string, value int) (bool, error) {
+	parts := strings.SplitN(spec, "-", 2)
+	low, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false, fmt.Errorf("invalid date_spec range '%s'", spec)
+	}
+	if len(parts) == 1 {
+		return value == low, nil
+	}
+	if parts[1] == "" {
+		return value >= low, nil
+	}
+	high, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false, fmt.Errorf("invalid date_spec range '%s'", spec)
+	}
+	return value >= low && value <= high, nil
+}
+
+// addTo adds the duration described by the spec to t.
+func (d DateSpec) addTo(t time.Time) (time.Time, error) {
+	values := make(map[string]int)
+	for name, s := range map[string]string{
+		"years": d.Years, "months": d.Months, "weeks": d.Weeks, "days": d.Days,
+		"hours": d.Hours, "minutes": d.Minutes, "seconds": d.Seconds,
+	} {
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid duration %s '%s'", name, s)
+		}
+		values[name] = n
+	}
+
+	t = t.AddDate(values["years"], values["months"], 7*values["weeks"]+values["days"])
+	return t.Add(time.Duration(values["hours"])*time.Hour +
+		time.Duration(values["minutes"])*time.Minute +
+		time.Duration(values["seconds"])*time.Second), nil
+}
+
+// cibTimeLayouts are the ISO 8601 variants accepted for date expressions.
+var cibTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 Z07:00",
+	"2006-01-02 15:04:05Z0700",
+	"2006-01-02 15:04:05 Z0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006-002",
+}
+
+// parseCibTime parses a date as used by date expressions. Dates without a
+// time zone are interpreted as UTC.
+func parseCibTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range cibTimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse date '%s'", s)
+}
+
+// EvaluateNvSets merges all attribute sets with the given tag (e.g.
+// instance_attributes) directly below elem, honouring their rules and
+// scores. Sets with a higher score take precedence, sets whose rule does not
+// pass are ignored, and among equal scores the first definition wins.
+func EvaluateNvSets(elem *xmltree.Element, tag string, ctx RuleContext) (map[string]string, error) {
+	type scoredSet struct {
+		elem  *xmltree.Element
+		score Score
+	}
+
+	var sets []scoredSet
+	for _, set := range elem.SelectElements(tag) {
+		score, err := ParseScore(set.SelectAttrValue("score", ""))
+		if err != nil {
+			return nil, fmt.Errorf("set %s: %w", set.SelectAttrValue(cibAttrKeyID, ""), err)
+		}
+		sets = append(sets, scoredSet{set, score})
+	}
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].score > sets[j].score
+	})
+
+	values := make(map[string]string)
+	for _, set := range sets {
+		pass := true
+		for _, ruleElem := range set.elem.SelectElements("rule") {
+			ok, err := parseRule(ruleElem).Evaluate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				pass = false
+			}
+		}
+		if !pass {
+			continue
+		}
+
+		for _, nvpair := range set.elem.SelectElements(cibTagNvPair) {
+			name := nvpair.SelectAttrValue(cibAttrKeyName, "")
+			if _, ok := values[name]; ok || name == "" {
+				continue
+			}
+			values[name] = nvpair.SelectAttrValue(cibAttrKeyValue, "")
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,260 @@
+package cib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpressionEvaluate(t *testing.T) {
+	ctx := RuleContext{
+		NodeAttributes: map[string]string{
+			"#uname":  "li0",
+			"cpus":    "16",
+			"version": "2.0.10",
+		},
+		ResourceParams: map[string]string{"min_cpus": "8"},
+	}
+
+	cases := []struct {
+		desc   string
+		expr   Expression
+		expect bool
+	}{{
+		desc:   "eq string",
+		expr:   Expression{Attribute: "#uname", Operation: "eq", Value: "li0"},
+		expect: true,
+	}, {
+		desc:   "ne string",
+		expr:   Expression{Attribute: "#uname", Operation: "ne", Value: "li0"},
+		expect: false,
+	}, {
+		desc:   "ne undefined attribute",
+		expr:   Expression{Attribute: "missing", Operation: "ne", Value: "x"},
+		expect: true,
+	}, {
+		desc:   "eq undefined attribute",
+		expr:   Expression{Attribute: "missing", Operation: "eq", Value: "x"},
+		expect: false,
+	}, {
+		desc:   "gt is numeric by default",
+		expr:   Expression{Attribute: "cpus", Operation: "gt", Value: "9"},
+		expect: true,
+	}, {
+		desc:   "gt as string",
+		expr:   Expression{Attribute: "cpus", Operation: "gt", Value: "9", Type: "string"},
+		expect: false,
+	}, {
+		desc:   "version comparison",
+		expr:   Expression{Attribute: "version", Operation: "gte", Value: "2.0.9", Type: "version"},
+		expect: true,
+	}, {
+		desc:   "defined",
+		expr:   Expression{Attribute: "cpus", Operation: "defined"},
+		expect: true,
+	}, {
+		desc:   "not_defined",
+		expr:   Expression{Attribute: "cpus", Operation: "not_defined"},
+		expect: false,
+	}, {
+		desc:   "value from resource parameter",
+		expr:   Expression{Attribute: "cpus", Operation: "gte", Value: "min_cpus", ValueSource: "param"},
+		expect: true,
+	}}
+
+	for _, c := range cases {
+		actual, err := c.expr.Evaluate(ctx)
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("Result does not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %t", c.expect)
+			t.Errorf("Actual: %t", actual)
+		}
+	}
+}
+
+func TestDateExpressionEvaluate(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2020, 3, 11, 14, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		desc        string
+		expr        DateExpression
+		expect      bool
+		expectError bool
+	}{{
+		desc:   "in range",
+		expr:   DateExpression{Operation: "in_range", Start: "2020-01-01", End: "2020-12-31"},
+		expect: true,
+	}, {
+		desc:   "in range with duration",
+		expr:   DateExpression{Operation: "in_range", Start: "2020-03-01", Duration: &DateSpec{Days: "5"}},
+		expect: false,
+	}, {
+		desc:   "gt",
+		expr:   DateExpression{Operation: "gt", Start: "2020-03-11 14:00:00"},
+		expect: true,
+	}, {
+		desc:   "lt with time zone",
+		expr:   DateExpression{Operation: "lt", End: "2020-03-11T15:00:00+02:00"},
+		expect: false,
+	}, {
+		desc:   "date_spec working hours",
+		expr:   DateExpression{Operation: "date_spec", DateSpec: &DateSpec{Hours: "9-17", Weekdays: "1-5"}},
+		expect: true,
+	}, {
+		desc:   "date_spec weekend",
+		expr:   DateExpression{Operation: "date_spec", DateSpec: &DateSpec{Weekdays: "6-7"}},
+		expect: false,
+	}, {
+		desc:        "invalid date",
+		expr:        DateExpression{Operation: "gt", Start: "yesterday"},
+		expectError: true,
+	}}
+
+	for _, c := range cases {
+		actual, err := c.expr.Evaluate(now)
+		if err != nil {
+			if !c.expectError {
+				t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			}
+			continue
+		}
+		if c.expectError {
+			t.Errorf("Expected error in case '%s'", c.desc)
+			continue
+		}
+		if actual != c.expect {
+			t.Errorf("Result does not match for case \"%s\"", c.desc)
+			t.Errorf("Expected: %t", c.expect)
+			t.Errorf("Actual: %t", actual)
+		}
+	}
+}
+
+func TestEvaluatePlacement(t *testing.T) {
+	xml := `<cib><configuration>
+<nodes>
+	<node id="1" uname="li0"/>
+	<node id="2" uname="li1"><instance_attributes id="nodes-2"><nvpair id="nodes-2-ssd" name="ssd" value="yes"/></instance_attributes></node>
+	<node id="3" uname="li2"/>
+</nodes>
+<resources>
+	<primitive id="p_iscsi_example" class="ocf" provider="heartbeat" type="iSCSITarget"/>
+	<group id="g_db">
+		<primitive id="p_db" class="ocf" provider="heartbeat" type="pgsql"/>
+	</group>
+</resources>
+<constraints>
+<rsc_location id="lo_iscsi_example" resource-discovery="never">
+	<resource_set id="lo_iscsi_example-0">
+		<resource_ref id="p_iscsi_example"/>
+	</resource_set>
+	<rule score="-INFINITY" id="lo_iscsi_example-rule">
+		<expression attribute="#uname" operation="ne" value="li0" id="lo_iscsi_example-rule-expression-0"/>
+		<expression attribute="#uname" operation="ne" value="li1" id="lo_iscsi_example-rule-expression-1"/>
+	</rule>
+</rsc_location>
+<rsc_location id="lo_db_ssd" rsc="g_db">
+	<rule score="100" id="lo_db_ssd-rule">
+		<expression attribute="ssd" operation="eq" value="yes" id="lo_db_ssd-rule-expression"/>
+	</rule>
+</rsc_location>
+<rsc_location id="lo_db_li0" rsc="p_db" node="li0" score="50"/>
+</constraints>
+</configuration></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	placements, err := cib.EvaluatePlacement(PlacementOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iscsi := placements["p_iscsi_example"]
+	expectScores := map[string]Score{"li0": 0, "li1": 0, "li2": ScoreMinusInfinity}
+	if !cmp.Equal(iscsi.Scores, expectScores) {
+		t.Errorf("Unexpected scores for p_iscsi_example")
+		t.Errorf("Expected: %v", expectScores)
+		t.Errorf("Actual: %v", iscsi.Scores)
+	}
+	if !cmp.Equal(iscsi.Allowed, []string{"li0", "li1"}) {
+		t.Errorf("Unexpected allowed nodes for p_iscsi_example: %v", iscsi.Allowed)
+	}
+	if len(iscsi.Preferred) != 0 {
+		t.Errorf("Unexpected preferred nodes for p_iscsi_example: %v", iscsi.Preferred)
+	}
+
+	db := placements["p_db"]
+	if !cmp.Equal(db.Preferred, []string{"li1", "li0"}) {
+		t.Errorf("Unexpected preferred nodes for p_db: %v", db.Preferred)
+	}
+	expectContrib := []PlacementContribution{
+		{Node: "li0", Constraint: "lo_db_li0", Resource: "p_db", Score: 50},
+		{Node: "li1", Constraint: "lo_db_ssd", Rule: "lo_db_ssd-rule", Resource: "g_db", Score: 100},
+	}
+	if !cmp.Equal(db.Contributions, expectContrib) {
+		t.Errorf("Unexpected contributions for p_db")
+		t.Errorf("Expected: %+v", expectContrib)
+		t.Errorf("Actual: %+v", db.Contributions)
+	}
+}
+
+func TestEvaluateResourceAttributes(t *testing.T) {
+	xml := `<cib><configuration>
+<nodes><node id="1" uname="node1"/><node id="2" uname="node2"/></nodes>
+<resources>
+	<primitive id="p_test" class="ocf" provider="heartbeat" type="Dummy">
+		<instance_attributes id="p_test-node1" score="10">
+			<rule id="p_test-node1-rule" score="0">
+				<expression id="p_test-node1-rule-expr" attribute="#uname" operation="eq" value="node1"/>
+			</rule>
+			<nvpair id="p_test-node1-ip" name="ip" value="10.0.0.1"/>
+		</instance_attributes>
+		<instance_attributes id="p_test-default">
+			<nvpair id="p_test-default-ip" name="ip" value="10.0.0.100"/>
+			<nvpair id="p_test-default-mask" name="mask" value="24"/>
+		</instance_attributes>
+	</primitive>
+</resources>
+</configuration></cib>`
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	cases := []struct {
+		node   string
+		expect map[string]string
+	}{{
+		node:   "node1",
+		expect: map[string]string{"ip": "10.0.0.1", "mask": "24"},
+	}, {
+		node:   "node2",
+		expect: map[string]string{"ip": "10.0.0.100", "mask": "24"},
+	}}
+
+	for _, c := range cases {
+		var cib CIB
+		params, _, err := cib.EvaluateResourceAttributes("p_test", c.node, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(params, c.expect) {
+			t.Errorf("Unexpected parameters on %s", c.node)
+			t.Errorf("Expected: %v", c.expect)
+			t.Errorf("Actual: %v", params)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// Operations of resource agents besides start, stop and monitor
+const (
+	opPromote     = "promote"
+	opDemote      = "demote"
+	opMigrateTo   = "migrate_to"
+	opMigrateFrom = "migrate_from"
+)
+
+// RunState is the state of a resource on a node, as determined from its
+// operation history.
+type RunState struct {
+	State LrmRunState
+	// Reason explains the state, e.g. which operation failed
+	Reason string
+	// Active reports whether the resource may be running on the node, i.e.
+	// whether Pacemaker has to stop it there before it is stopped. Besides
+	// the running states, this includes pending and failed operations that
+	// may have left the resource running, such as failed stops.
+	Active bool
+	// Operation is the operation that determined the state. It is empty if
+	// no operation was recorded.
+	Operation string
+}
+
+// ResourceRunState determines the state of a resource on a node by
+// replaying its operations in the order of their call IDs, the way
+// Pacemaker's scheduler does. For anonymous clones, the ID of the clone's
+// primitive can be used.
+func (c *CIB) ResourceRunState(id, node string) (RunState, error) {
+	history, err := c.OperationHistory()
+	if err != nil {
+		return RunState{}, err
+	}
+
+	return replayRunState(id, history.Get(node, id), history.isPromotable(id)), nil
+}
+
+// replayRunState determines the state of a resource from its operations on
+// a node, which must be ordered by call ID. Started instances of promotable
+// resources are Unpromoted instead of Running.
+func replayRunState(rscName string, ops []LrmOperation, promotable bool) RunState {
+	contextLog := log.WithFields(log.Fields{"resource": rscName})
+
+	state := RunState{State: Unknown, Reason: "no operations recorded"}
+	for _, op := range ops {
+		if op.OpStatus == opStatusCancelled {
+			// cancelled recurring operations say nothing about the state
+			continue
+		}
+		if op.RcCode < 0 && !op.InProgress() {
+			contextLog.Warningf("operation %s has no result, ignoring it", op.ID)
+			continue
+		}
+
+		if op.InProgress() {
+			if pending, ok := pendingRunState(op); ok {
+				state = pending
+			}
+			continue
+		}
+
+		if op.OpStatus != opStatusDone {
+			state = failedRunState(op, true, fmt.Sprintf("%s did not complete (status %d)", op.Operation, op.OpStatus))
+			continue
+		}
+
+		state = completedRunState(op, state, promotable)
+	}
+
+	return state
+}
+
+// pendingRunState returns the state of a resource during a pending
+// operation. Pending operations that do not change the state, e.g.
+// monitors, return false.
+func pendingRunState(op LrmOperation) (RunState, bool) {
+	switch op.Operation {
+	case cibAttrValueStart:
+		return RunState{State: Starting, Reason: "start pending", Active: true, Operation: op.Operation}, true
+	case cibAttrValueStop:
+		return RunState{State: Stopping, Reason: "stop pending", Active: true, Operation: op.Operation}, true
+	case opMigrateTo, opMigrateFrom:
+		return RunState{State: Migrating, Reason: op.Operation + " pending", Active: true, Operation: op.Operation}, true
+	case opPromote:
+		return RunState{State: Unpromoted, Reason: "promote pending", Active: true, Operation: op.Operation}, true
+	case opDemote:
+		return RunState{State: Promoted, Reason: "demote pending", Active: true, Operation: op.Operation}, true
+	}
+	return RunState{}, false
+}
+
+// completedRunState returns the state of a resource after an operation
+// that was executed.
+func completedRunState(op LrmOperation, previous RunState, promotable bool) RunState {
+	ok := func(state LrmRunState, active bool, reason string) RunState {
+		return RunState{State: state, Reason: reason, Active: active, Operation: op.Operation}
+	}
+	failed := func() RunState {
+		return failedRunState(op, true, fmt.Sprintf("%s returned %d", op.Operation, op.RcCode))
+	}
+
+	switch op.Operation {
+	case cibAttrValueStart, opMigrateFrom:
+		switch op.RcCode {
+		case ocfSuccess:
+			if promotable {
+				return ok(Unpromoted, true, op.Operation+" succeeded")
+			}
+			return ok(Running, true, op.Operation+" succeeded")
+		case ocfRunningMaster:
+			return ok(Promoted, true, op.Operation+" found the resource promoted")
+		}
+		return failed()
+
+	case cibAttrValueStop:
+		if op.RcCode == ocfSuccess {
+			return ok(Stopped, false, "stop succeeded")
+		}
+		return failed()
+
+	case opMigrateTo:
+		if op.RcCode == ocfSuccess {
+			return ok(Migrating, true, "migrated to another node, waiting for stop")
+		}
+		return failed()
+
+	case opPromote:
+		if op.RcCode == ocfSuccess || op.RcCode == ocfRunningMaster {
+			return ok(Promoted, true, "promote succeeded")
+		}
+		return failed()
+
+	case opDemote:
+		if op.RcCode == ocfSuccess {
+			return ok(Unpromoted, true, "demote succeeded")
+		}
+		return failed()
+
+	case cibAttrValueMonitor:
+		switch op.RcCode {
+		case ocfSuccess:
+			// promotable resources report their unpromoted role as running
+			if promotable || previous.State == Promoted || previous.State == Unpromoted {
+				return ok(Unpromoted, true, "monitor found the resource unpromoted")
+			}
+			return ok(Running, true, "monitor found the resource running")
+		case ocfRunningMaster:
+			return ok(Promoted, true, "monitor found the resource promoted")
+		case ocfNotRunning:
+			if expected, known := op.ExpectedRc(); known && expected != ocfNotRunning {
+				return failedRunState(op, false, "monitor found the resource not running")
+			}
+			return ok(Stopped, false, "monitor found the resource not running")
+		case ocfErrInstalled:
+			if op.Interval == 0 {
+				return ok(Stopped, false, "probe found the resource not installed")
+			}
+		}
+		return failed()
+	}
+
+	// other operations like notify or reload only matter if they fail
+	if op.RcCode != ocfSuccess {
+		return failed()
+	}
+	return previous
+}
+
+func failedRunState(op LrmOperation, active bool, reason string) RunState {
+	if op.ExitReason != "" {
+		reason += ": " + op.ExitReason
+	}
+	return RunState{State: Failed, Reason: reason, Active: active, Operation: op.Operation}
+}
+
+// legacyRunState reduces a run state to Running, Stopped and Unknown.
+// A failed start counts as stopped, as it always has in this package.
+func legacyRunState(state RunState) LrmRunState {
+	switch {
+	case state.State == Unknown:
+		return Unknown
+	case state.State == Failed && state.Operation == cibAttrValueStart:
+		return Stopped
+	case state.Active:
+		return Running
+	}
+	return Stopped
+}
+
+// ResourceStates returns the state of a resource on every node that has
+// recorded operations of it. For anonymous clones, the ID of the clone's
+// primitive returns the states of all its instances.
+func (c *CIB) ResourceStates(id string) (map[string]RunState, error) {
+	history, err := c.OperationHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	return resourceStates(history, id), nil
+}
+
+func resourceStates(history OperationHistory, id string) map[string]RunState {
+	states := make(map[string]RunState)
+	for node, ops := range history.ByResource(id) {
+		states[node] = replayRunState(id, ops, history.isPromotable(id))
+	}
+	return states
+}
+
+// MultiActiveResource is a primitive that is active or promoted on more
+// nodes than its configuration allows. For a resource outside of clones
+// this is a sign of a split brain.
+type MultiActiveResource struct {
+	ID string
+	// Active lists the nodes the resource is active on, Promoted those it
+	// is promoted on, both sorted
+	Active   []string
+	Promoted []string
+	// MaxActive and MaxPromoted are the configured limits, 0 if there is
+	// no limit
+	MaxActive   int
+	MaxPromoted int
+}
+
+// MultiActive checks if a primitive is active or promoted on more nodes
+// than allowed. Primitives outside of clones may be active on one node,
+// clone instances on clone-max nodes and promoted on promoted-max nodes.
+// Resources in bundles are not checked.
+func (c *CIB) MultiActive(id string) (MultiActiveResource, bool, error) {
+	resources, err := c.ListResources()
+	if err != nil {
+		return MultiActiveResource{}, false, err
+	}
+
+	history, err := c.OperationHistory()
+	if err != nil {
+		return MultiActiveResource{}, false, err
+	}
+
+	result, ok := multiActive(resources, history, id)
+	return result, ok, nil
+}
+
+// MultiActiveResources returns all primitives that are active or promoted
+// on more nodes than allowed (see MultiActive), sorted by ID.
+func (c *CIB) MultiActiveResources() ([]MultiActiveResource, error) {
+	resources, err := c.ListResources()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := c.OperationHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []MultiActiveResource
+	for _, rsc := range resources {
+		if rsc.Kind != KindPrimitive {
+			continue
+		}
+		if multi, ok := multiActive(resources, history, rsc.ID); ok {
+			result = append(result, multi)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func multiActive(resources []Resource, history OperationHistory, id string) (MultiActiveResource, bool) {
+	maxActive, maxPromoted, checked := activeLimits(resources, id)
+	if !checked {
+		return MultiActiveResource{}, false
+	}
+
+	result := MultiActiveResource{ID: id, MaxActive: maxActive, MaxPromoted: maxPromoted}
+	for node, state := range resourceStates(history, id) {
+		if state.Active {
+			result.Active = append(result.Active, node)
+		}
+		if state.State == Promoted {
+			result.Promoted = append(result.Promoted, node)
+		}
+	}
+	sort.Strings(result.Active)
+	sort.Strings(result.Promoted)
+
+	tooManyActive := maxActive > 0 && len(result.Active) > maxActive
+	tooManyPromoted := maxPromoted > 0 && len(result.Promoted) > maxPromoted
+	return result, tooManyActive || tooManyPromoted
+}
+
+// activeLimits determines on how many nodes a primitive may be active and
+// promoted. It returns false for resources that are not checked.
+func activeLimits(resources []Resource, id string) (int, int, bool) {
+	byID := make(map[string]Resource)
+	for _, rsc := range resources {
+		byID[rsc.ID] = rsc
+	}
+
+	rsc, ok := byID[id]
+	if !ok {
+		// not configured (anymore), it may run on one node at most
+		return 1, 0, true
+	}
+
+	for parent, ok := byID[rsc.Parent]; ok; parent, ok = byID[parent.Parent] {
+		switch parent.Kind {
+		case KindBundle:
+			return 0, 0, false
+		case KindClone, KindMaster:
+			maxActive, _ := strconv.Atoi(parent.Meta["clone-max"])
+			maxPromoted := 0
+			if parent.IsPromotable() {
+				maxPromoted = 1
+				for _, name := range []string{"promoted-max", "master-max"} {
+					if value, err := strconv.Atoi(parent.Meta[name]); err == nil {
+						maxPromoted = value
+						break
+					}
+				}
+			}
+			return maxActive, maxPromoted, true
+		}
+	}
+
+	return 1, 0, true
+}
+
+// promotablePrimitives returns the IDs of the primitives in promotable
+// clones.
+func promotablePrimitives(root *xmltree.Element) map[string]bool {
+	promotable := make(map[string]bool)
+	for _, kind := range []ResourceKind{KindClone, KindMaster} {
+		for _, elem := range root.FindElements("configuration/resources/" + string(kind)) {
+			if !parseResource(elem, "").IsPromotable() {
+				continue
+			}
+			for _, id := range primitiveIDs(elem) {
+				promotable[id] = true
+			}
+		}
+	}
+	return promotable
+}
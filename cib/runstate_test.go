@@ -0,0 +1,196 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResourceRunState(t *testing.T) {
+	cases := []struct {
+		desc      string
+		resources string
+		ops       string
+		expect    RunState
+	}{{
+		desc: "restarted resource",
+		ops: `<lrm_rsc_op id="p_last_0" operation="start" call-id="14" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="15" rc-code="0" op-status="0" interval="10000"/>
+			<lrm_rsc_op id="p_stop_0" operation="stop" call-id="12" rc-code="0" op-status="0" interval="0"/>`,
+		expect: RunState{State: Running, Reason: "monitor found the resource running", Active: true, Operation: "monitor"},
+	}, {
+		desc: "pending start",
+		ops: `<lrm_rsc_op id="p_stop_0" operation="stop" call-id="12" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_last_0" operation="start" call-id="-1" rc-code="193" op-status="-1" interval="0"/>`,
+		expect: RunState{State: Starting, Reason: "start pending", Active: true, Operation: "start"},
+	}, {
+		desc: "promoted",
+		ops: `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_promote_0" operation="promote" call-id="5" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_9000" operation="monitor" call-id="6" rc-code="8" op-status="0" interval="9000"/>`,
+		expect: RunState{State: Promoted, Reason: "monitor found the resource promoted", Active: true, Operation: "monitor"},
+	}, {
+		desc: "demoted",
+		ops: `<lrm_rsc_op id="p_promote_0" operation="promote" call-id="5" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_demote_0" operation="demote" call-id="7" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="8" rc-code="0" op-status="0" interval="10000"/>`,
+		expect: RunState{State: Unpromoted, Reason: "monitor found the resource unpromoted", Active: true, Operation: "monitor"},
+	}, {
+		desc: "failed monitor",
+		ops: `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="4" rc-code="1" op-status="0" interval="10000" exit-reason="Mount point gone"/>`,
+		expect: RunState{State: Failed, Reason: "monitor returned 1: Mount point gone", Active: true, Operation: "monitor"},
+	}, {
+		desc: "monitor found resource dead",
+		ops: `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="4" rc-code="7" op-status="0" interval="10000" transition-key="3:7:0:4d3d8f8a-6a28-4a0e-8f1c-d2d5c0a0c0a1"/>`,
+		expect: RunState{State: Failed, Reason: "monitor found the resource not running", Operation: "monitor"},
+	}, {
+		desc: "migrated away",
+		ops: `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_migrate_to_0" operation="migrate_to" call-id="9" rc-code="0" op-status="0" interval="0"/>`,
+		expect: RunState{State: Migrating, Reason: "migrated to another node, waiting for stop", Active: true, Operation: "migrate_to"},
+	}, {
+		desc: "migrated in",
+		ops: `<lrm_rsc_op id="p_migrate_from_0" operation="migrate_from" call-id="4" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_0" operation="monitor" call-id="2" rc-code="7" op-status="0" interval="0"/>`,
+		expect: RunState{State: Running, Reason: "migrate_from succeeded", Active: true, Operation: "migrate_from"},
+	}, {
+		desc:   "failed stop",
+		ops:    `<lrm_rsc_op id="p_stop_0" operation="stop" call-id="12" rc-code="1" op-status="0" interval="0"/>`,
+		expect: RunState{State: Failed, Reason: "stop returned 1", Active: true, Operation: "stop"},
+	}, {
+		desc:   "timed out start",
+		ops:    `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="1" op-status="2" interval="0"/>`,
+		expect: RunState{State: Failed, Reason: "start did not complete (status 2)", Active: true, Operation: "start"},
+	}, {
+		desc:   "probe of resource that is not installed",
+		ops:    `<lrm_rsc_op id="p_monitor_0" operation="monitor" call-id="1" rc-code="5" op-status="0" interval="0"/>`,
+		expect: RunState{State: Stopped, Reason: "probe found the resource not installed", Operation: "monitor"},
+	}, {
+		desc: "cancelled monitor",
+		ops: `<lrm_rsc_op id="p_stop_0" operation="stop" call-id="12" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="13" rc-code="0" op-status="1" interval="10000"/>`,
+		expect: RunState{State: Stopped, Reason: "stop succeeded", Operation: "stop"},
+	}, {
+		desc: "started promotable instance",
+		resources: `<clone id="ms_p">
+				<meta_attributes id="ms_p-meta_attributes">
+					<nvpair id="ms_p-meta_attributes-promotable" name="promotable" value="true"/>
+				</meta_attributes>
+				<primitive id="p" class="ocf" provider="linbit" type="drbd"/>
+			</clone>`,
+		ops: `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+			<lrm_rsc_op id="p_monitor_10000" operation="monitor" call-id="4" rc-code="0" op-status="0" interval="10000"/>`,
+		expect: RunState{State: Unpromoted, Reason: "monitor found the resource unpromoted", Active: true, Operation: "monitor"},
+	}, {
+		desc:      "started instance of legacy master",
+		resources: `<master id="ms_p"><primitive id="p" class="ocf" provider="linbit" type="drbd"/></master>`,
+		ops:       `<lrm_rsc_op id="p_start_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>`,
+		expect:    RunState{State: Unpromoted, Reason: "start succeeded", Active: true, Operation: "start"},
+	}, {
+		desc:   "no operations",
+		expect: RunState{State: Unknown, Reason: "no operations recorded"},
+	}}
+
+	for _, c := range cases {
+		xml := `<cib><configuration><resources>` + c.resources + `</resources></configuration>
+			<status><node_state id="1" uname="la1"><lrm id="1"><lrm_resources>
+			<lrm_resource id="p" class="ocf" provider="heartbeat" type="Dummy">` + c.ops + `</lrm_resource>
+			</lrm_resources></lrm></node_state></status></cib>`
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return xml, "", nil
+			},
+		}
+
+		var cib CIB
+		actual, err := cib.ResourceRunState("p", "la1")
+		if err != nil {
+			t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			continue
+		}
+		if !cmp.Equal(actual, c.expect) {
+			t.Errorf("Unexpected run state in case '%s'", c.desc)
+			t.Errorf("Expected: %+v", c.expect)
+			t.Errorf("Actual: %+v", actual)
+		}
+	}
+}
+
+func TestMultiActiveResources(t *testing.T) {
+	xml := `<cib><configuration>
+	<resources>
+		<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2"/>
+		<clone id="cl_web">
+			<primitive id="p_web" class="ocf" provider="heartbeat" type="apache"/>
+		</clone>
+		<clone id="ms_drbd">
+			<meta_attributes id="ms_drbd-meta_attributes">
+				<nvpair id="ms_drbd-meta_attributes-promotable" name="promotable" value="true"/>
+			</meta_attributes>
+			<primitive id="p_drbd" class="ocf" provider="linbit" type="drbd"/>
+		</clone>
+	</resources>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1"><lrm id="1"><lrm_resources>
+			<lrm_resource id="p_ip"><lrm_rsc_op id="p_ip_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+			<lrm_resource id="p_web:0"><lrm_rsc_op id="p_web_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+			<lrm_resource id="p_drbd:0"><lrm_rsc_op id="p_drbd_last_0" operation="promote" call-id="6" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+		</lrm_resources></lrm></node_state>
+		<node_state id="2" uname="la2"><lrm id="2"><lrm_resources>
+			<lrm_resource id="p_ip"><lrm_rsc_op id="p_ip_last_0" operation="monitor" call-id="2" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+			<lrm_resource id="p_web:1"><lrm_rsc_op id="p_web_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+			<lrm_resource id="p_drbd:1"><lrm_rsc_op id="p_drbd_last_0" operation="monitor" call-id="7" rc-code="8" op-status="0" interval="0"/></lrm_resource>
+		</lrm_resources></lrm></node_state>
+		<node_state id="3" uname="la3"><lrm id="3"><lrm_resources>
+			<lrm_resource id="p_ip"><lrm_rsc_op id="p_ip_last_0" operation="stop" call-id="5" rc-code="0" op-status="0" interval="0"/></lrm_resource>
+		</lrm_resources></lrm></node_state>
+	</status></cib>`
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	states, err := cib.ResourceStates("p_ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStates := map[string]RunState{
+		"la1": {State: Running, Reason: "start succeeded", Active: true, Operation: "start"},
+		"la2": {State: Running, Reason: "monitor found the resource running", Active: true, Operation: "monitor"},
+		"la3": {State: Stopped, Reason: "stop succeeded", Operation: "stop"},
+	}
+	if !cmp.Equal(states, expectStates) {
+		t.Errorf("Unexpected states of p_ip")
+		t.Errorf("Expected: %+v", expectStates)
+		t.Errorf("Actual: %+v", states)
+	}
+
+	actual, err := cib.MultiActiveResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []MultiActiveResource{{
+		ID:          "p_drbd",
+		Active:      []string{"la1", "la2"},
+		Promoted:    []string{"la1", "la2"},
+		MaxPromoted: 1,
+	}, {
+		ID:        "p_ip",
+		Active:    []string{"la1", "la2"},
+		MaxActive: 1,
+	}}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected multi-active resources")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	if _, multi, err := cib.MultiActive("p_web"); err != nil || multi {
+		t.Errorf("Expected clone p_web not to be multi-active (error: %v)", err)
+	}
+}
@@ -0,0 +1,80 @@
+package cib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Score is a Pacemaker score as used by constraints, rules and stickiness.
+//
+// Scores saturate at +/-INFINITY, which Pacemaker defines as 1000000.
+type Score int
+
+const (
+	// ScoreInfinity is the Pacemaker value of INFINITY
+	ScoreInfinity Score = 1000000
+	// ScoreMinusInfinity is the Pacemaker value of -INFINITY
+	ScoreMinusInfinity Score = -ScoreInfinity
+)
+
+// ParseScore converts a score string from the CIB into a Score.
+//
+// "INFINITY", "+INFINITY" and "-INFINITY" are recognized, as are plain
+// integers, which are clamped to the +/-INFINITY range. An empty string is
+// interpreted as a score of 0.
+func ParseScore(s string) (Score, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToUpper(s) {
+	case "":
+		return 0, nil
+	case "INFINITY", "+INFINITY":
+		return ScoreInfinity, nil
+	case "-INFINITY":
+		return ScoreMinusInfinity, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid score '%s': %w", s, err)
+	}
+
+	return clampScore(n), nil
+}
+
+// Add adds two scores the way Pacemaker does: -INFINITY always wins,
+// otherwise the sum saturates at +/-INFINITY.
+func (s Score) Add(o Score) Score {
+	if s <= ScoreMinusInfinity || o <= ScoreMinusInfinity {
+		return ScoreMinusInfinity
+	}
+	if s >= ScoreInfinity || o >= ScoreInfinity {
+		return ScoreInfinity
+	}
+	return clampScore(int(s) + int(o))
+}
+
+// IsInfinite returns true if the score is either INFINITY or -INFINITY.
+func (s Score) IsInfinite() bool {
+	return s >= ScoreInfinity || s <= ScoreMinusInfinity
+}
+
+func (s Score) String() string {
+	switch {
+	case s >= ScoreInfinity:
+		return "INFINITY"
+	case s <= ScoreMinusInfinity:
+		return "-INFINITY"
+	}
+	return strconv.Itoa(int(s))
+}
+
+func clampScore(n int) Score {
+	if n >= int(ScoreInfinity) {
+		return ScoreInfinity
+	}
+	if n <= int(ScoreMinusInfinity) {
+		return ScoreMinusInfinity
+	}
+	return Score(n)
+}
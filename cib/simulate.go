@@ -0,0 +1,239 @@
+package cib
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// Sources of score contributions
+const (
+	ScoreSourceLocation   = "location"
+	ScoreSourceStickiness = "stickiness"
+)
+
+// ScoreContribution is a score that is known to contribute to the
+// allocation score of a resource on a node.
+type ScoreContribution struct {
+	Node string
+	// Source is either ScoreSourceLocation or ScoreSourceStickiness
+	Source string
+	// Constraint and Rule identify the location constraint and the rule of
+	// a location contribution
+	Constraint string
+	Rule       string
+	Score      Score
+}
+
+// ResourceScores are the scores the scheduler computed for a resource.
+// Clone instances have their own entries, e.g. "p_drbd:0".
+type ResourceScores struct {
+	Resource string
+	// Allocation maps nodes to the resource's final allocation score
+	Allocation map[string]Score
+	// Promotion maps nodes to the promotion score of a promotable clone
+	// instance. It is empty for other resources.
+	Promotion map[string]Score
+	// Contributions lists the location constraints and the stickiness that
+	// contributed to the allocation scores. Colocations, utilization and
+	// other influences of the scheduler are not broken down. The status
+	// does not tell which instance of an anonymous clone runs where, so
+	// each instance has the stickiness on all nodes the clone is active on.
+	Contributions []ScoreContribution
+}
+
+// scoreLine matches the score lines of crm_simulate --show-scores, e.g.
+// "pcmk__native_allocate: p_ip allocation score on la1: 100" or
+// "p_drbd:0 promotion score on la1: 10000".
+var scoreLine = regexp.MustCompile(`^(?:\S+: )?(\S+) (allocation|assignment|promotion) score on (\S+): (\S+)$`)
+
+// AllocationScores runs the scheduler on the live CIB, like
+// crm_simulate -sL, and returns the allocation and promotion scores of all
+// resources, keyed by resource.
+func (c *CIB) AllocationScores() (map[string]ResourceScores, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	output, err := c.simulate(true, "--show-scores")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.allocationScores(output)
+}
+
+// DocumentAllocationScores is like AllocationScores, but runs the scheduler
+// on the current document, including changes that have not been committed
+// with Update.
+func (c *CIB) DocumentAllocationScores() (map[string]ResourceScores, error) {
+	output, err := c.simulate(false, "--show-scores")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.allocationScores(output)
+}
+
+// simulate runs crm_simulate, either on the live CIB or on the current
+// document, and returns its output.
+func (c *CIB) simulate(live bool, args ...string) (string, error) {
+	stdin := ""
+	if live {
+		args = append([]string{"--live-check"}, args...)
+	} else {
+		if _, err := c.root(); err != nil {
+			return "", err
+		}
+		data, err := c.Doc.WriteToString()
+		if err != nil {
+			return "", err
+		}
+		stdin = data
+		args = append([]string{"--xml-pipe"}, args...)
+	}
+
+	stdout, stderr, err := simulateCommand.execute(stdin, args...)
+	if err != nil {
+		return "", fmt.Errorf("could not run crm_simulate: %w: %s", err, strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
+
+// allocationScores parses the output of crm_simulate and adds the
+// contributions found in the current document.
+func (c *CIB) allocationScores(output string) (map[string]ResourceScores, error) {
+	scores, err := parseAllocationScores(output)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+
+	placements, err := c.EvaluatePlacement(PlacementOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := operationHistory(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, rsc := range scores {
+		base := lrmResourceID(id)
+		for _, contrib := range placements[base].Contributions {
+			if _, ok := rsc.Allocation[contrib.Node]; !ok {
+				continue
+			}
+			rsc.Contributions = append(rsc.Contributions, ScoreContribution{
+				Node:       contrib.Node,
+				Source:     ScoreSourceLocation,
+				Constraint: contrib.Constraint,
+				Rule:       contrib.Rule,
+				Score:      contrib.Score,
+			})
+		}
+
+		stickiness, err := resourceStickiness(root, base)
+		if err != nil {
+			return nil, err
+		}
+		if stickiness != 0 {
+			states := resourceStates(history, id)
+			if id != base {
+				// anonymous clone instances are recorded under the
+				// primitive's ID
+				for _, node := range history.Nodes() {
+					if ops, ok := history.byNode[node][base]; ok {
+						states[node] = replayRunState(base, ops, history.isPromotable(base))
+					}
+				}
+			}
+			nodes := make([]string, 0, len(states))
+			for node, state := range states {
+				if _, ok := rsc.Allocation[node]; ok && state.Active {
+					nodes = append(nodes, node)
+				}
+			}
+			sort.Strings(nodes)
+			for _, node := range nodes {
+				rsc.Contributions = append(rsc.Contributions, ScoreContribution{
+					Node:   node,
+					Source: ScoreSourceStickiness,
+					Score:  stickiness,
+				})
+			}
+		}
+
+		scores[id] = rsc
+	}
+
+	return scores, nil
+}
+
+// parseAllocationScores parses the score lines of crm_simulate's output.
+// If a score is printed more than once, e.g. by different stages of the
+// scheduler, the last one wins.
+func parseAllocationScores(output string) (map[string]ResourceScores, error) {
+	scores := make(map[string]ResourceScores)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		match := scoreLine.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if match == nil {
+			continue
+		}
+		id, kind, node := match[1], match[2], match[3]
+
+		score, err := ParseScore(match[4])
+		if err != nil {
+			return nil, fmt.Errorf("resource %s on node %s: %w", id, node, err)
+		}
+
+		rsc, ok := scores[id]
+		if !ok {
+			rsc = ResourceScores{
+				Resource:   id,
+				Allocation: make(map[string]Score),
+				Promotion:  make(map[string]Score),
+			}
+		}
+		if kind == "promotion" {
+			rsc.Promotion[node] = score
+		} else {
+			rsc.Allocation[node] = score
+		}
+		scores[id] = rsc
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+// resourceStickiness returns the resource-stickiness that applies to a
+// resource, taken from the resource, its containers or the resource
+// defaults.
+func resourceStickiness(root *xmltree.Element, id string) (Score, error) {
+	for elem := findResourceElement(root, id); elem != nil && isResourceKind(ResourceKind(elem.Tag)); elem = elem.Parent() {
+		if value, ok := nvsetValues(elem, cibTagMetaAttr)["resource-stickiness"]; ok {
+			return ParseScore(value)
+		}
+	}
+	if rscDefaults := root.FindElement("configuration/rsc_defaults"); rscDefaults != nil {
+		if value, ok := nvsetValues(rscDefaults, cibTagMetaAttr)["resource-stickiness"]; ok {
+			return ParseScore(value)
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,192 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const simulateXML = `<cib><configuration>
+<crm_config/>
+<nodes><node id="1" uname="la1"/><node id="2" uname="la2"/></nodes>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2">
+		<meta_attributes id="p_ip-meta_attributes">
+			<nvpair id="p_ip-meta_attributes-resource-stickiness" name="resource-stickiness" value="200"/>
+		</meta_attributes>
+	</primitive>
+	<primitive id="p_web" class="ocf" provider="heartbeat" type="apache"/>
+</resources>
+<constraints>
+	<rsc_location id="lo_ip_la2" rsc="p_ip" node="la2" score="50"/>
+</constraints>
+<rsc_defaults><meta_attributes id="rsc-options"/></rsc_defaults>
+</configuration>
+<status>
+	<node_state id="1" uname="la1"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_ip">
+			<lrm_rsc_op id="p_ip_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+
+const simulateScores = `Current cluster status:
+Online: [ la1 la2 ]
+
+ p_ip	(ocf::heartbeat:IPaddr2):	 Started la1
+ p_web	(ocf::heartbeat:apache):	 Stopped
+
+Allocation scores:
+pcmk__native_allocate: p_ip allocation score on la1: 0
+pcmk__native_allocate: p_ip allocation score on la1: 200
+pcmk__native_allocate: p_ip allocation score on la2: 50
+pcmk__native_allocate: p_web allocation score on la1: 0
+pcmk__native_allocate: p_web allocation score on la2: -INFINITY
+p_drbd:0 promotion score on la1: 10000
+
+Transition Summary:
+  * Start      p_web     ( la1 )
+`
+
+func TestAllocationScores(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return simulateXML, "", nil
+		},
+	}
+
+	var args []string
+	simulateCommand = &argsCommand{
+		func(stdin string, a []string) (string, string, error) {
+			args = a
+			if stdin != "" {
+				t.Errorf("Unexpected input for live simulation")
+			}
+			return simulateScores, "", nil
+		},
+	}
+
+	var cib CIB
+	scores, err := cib.AllocationScores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(args, []string{"--live-check", "--show-scores"}) {
+		t.Errorf("Unexpected arguments: %v", args)
+	}
+
+	expect := map[string]ResourceScores{
+		"p_ip": {
+			Resource:   "p_ip",
+			Allocation: map[string]Score{"la1": 200, "la2": 50},
+			Promotion:  map[string]Score{},
+			Contributions: []ScoreContribution{
+				{Node: "la2", Source: ScoreSourceLocation, Constraint: "lo_ip_la2", Score: 50},
+				{Node: "la1", Source: ScoreSourceStickiness, Score: 200},
+			},
+		},
+		"p_web": {
+			Resource:   "p_web",
+			Allocation: map[string]Score{"la1": 0, "la2": ScoreMinusInfinity},
+			Promotion:  map[string]Score{},
+		},
+		"p_drbd:0": {
+			Resource:   "p_drbd:0",
+			Allocation: map[string]Score{},
+			Promotion:  map[string]Score{"la1": 10000},
+		},
+	}
+	if !cmp.Equal(scores, expect) {
+		t.Errorf("Unexpected allocation scores")
+		t.Errorf("Diff: %s", cmp.Diff(expect, scores))
+	}
+}
+
+func TestDocumentAllocationScores(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return simulateXML, "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.ReadConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulateCommand = &argsCommand{
+		func(stdin string, a []string) (string, string, error) {
+			if !cmp.Equal(a, []string{"--xml-pipe", "--show-scores"}) {
+				t.Errorf("Unexpected arguments: %v", a)
+			}
+			if normalizeXML(t, stdin) != normalizeXML(t, simulateXML) {
+				t.Errorf("Unexpected CIB passed to crm_simulate: %s", stdin)
+			}
+			return simulateScores, "", nil
+		},
+	}
+
+	scores, err := cib.DocumentAllocationScores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores["p_web"].Allocation["la2"] != ScoreMinusInfinity {
+		t.Errorf("Unexpected score of p_web on la2: %v", scores["p_web"].Allocation["la2"])
+	}
+}
+
+func TestAllocationScoresClone(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return `<cib><configuration>
+<crm_config/>
+<nodes><node id="1" uname="la1"/><node id="2" uname="la2"/></nodes>
+<resources>
+	<clone id="cl_dummy">
+		<meta_attributes id="cl_dummy-meta_attributes">
+			<nvpair id="cl_dummy-meta_attributes-resource-stickiness" name="resource-stickiness" value="1"/>
+		</meta_attributes>
+		<primitive id="p_dummy" class="ocf" provider="heartbeat" type="Dummy"/>
+	</clone>
+</resources>
+<constraints/>
+</configuration>
+<status>
+	<node_state id="1" uname="la1"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_dummy">
+			<lrm_rsc_op id="p_dummy_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+	<node_state id="2" uname="la2"><lrm id="2"><lrm_resources>
+		<lrm_resource id="p_dummy">
+			<lrm_rsc_op id="p_dummy_last_0" operation="stop" call-id="4" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`, "", nil
+		},
+	}
+
+	simulateCommand = &argsCommand{
+		func(_ string, _ []string) (string, string, error) {
+			return `Allocation scores:
+pcmk__clone_allocate: cl_dummy allocation score on la1: 0
+pcmk__clone_allocate: cl_dummy allocation score on la2: 0
+pcmk__native_allocate: p_dummy:0 allocation score on la1: 1
+pcmk__native_allocate: p_dummy:0 allocation score on la2: 0
+`, "", nil
+		},
+	}
+
+	var cib CIB
+	scores, err := cib.AllocationScores()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []ScoreContribution{{Node: "la1", Source: ScoreSourceStickiness, Score: 1}}
+	if actual := scores["p_dummy:0"].Contributions; !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected contributions")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual))
+	}
+}
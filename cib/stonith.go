@@ -0,0 +1,412 @@
+package cib
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// StonithDevice is the configuration of a fencing device, a primitive of
+// class stonith.
+type StonithDevice struct {
+	ID string
+	// Agent is the fence agent, e.g. "fence_ipmilan"
+	Agent string
+	// HostList lists the nodes the device can fence (pcmk_host_list)
+	HostList []string
+	// HostMap maps node names to the names or ports the device uses for
+	// them (pcmk_host_map)
+	HostMap map[string]string
+	// HostCheck determines how the fencer finds out which nodes the device
+	// can fence (pcmk_host_check), e.g. "static-list" or "dynamic-list"
+	HostCheck string
+	// Params are the other instance attributes, e.g. the credentials
+	Params map[string]string
+	Meta   map[string]string
+	// MonitorInterval is the interval of the recurring monitor operation.
+	// When creating a device it defaults to 60s.
+	MonitorInterval string
+}
+
+// FenceAction is an action a fence device performs on a node.
+type FenceAction string
+
+const (
+	FenceReboot FenceAction = "reboot"
+	FenceOff    FenceAction = "off"
+	FenceOn     FenceAction = "on"
+)
+
+// FenceStatus is the state of a fence operation.
+type FenceStatus string
+
+const (
+	FenceStatusPending FenceStatus = "pending"
+	FenceStatusSuccess FenceStatus = "success"
+	FenceStatusFailed  FenceStatus = "failed"
+)
+
+// FenceEvent is an entry of the fence history.
+type FenceEvent struct {
+	Target string
+	Action FenceAction
+	Status FenceStatus
+	// Delegate is the node that executed the fence operation
+	Delegate string
+	// Origin is the node that requested the fence operation, Client the
+	// daemon or tool that requested it
+	Origin     string
+	Client     string
+	ExitReason string
+	// Completed is the time the operation finished. It is zero for pending
+	// operations.
+	Completed time.Time
+}
+
+const (
+	paramHostList  = "pcmk_host_list"
+	paramHostMap   = "pcmk_host_map"
+	paramHostCheck = "pcmk_host_check"
+)
+
+// ListStonithDevices returns all configured fence devices.
+func (c *CIB) ListStonithDevices() ([]StonithDevice, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	var devices []StonithDevice
+	for _, elem := range stonithDevices(root) {
+		devices = append(devices, parseStonithDevice(elem))
+	}
+	return devices, nil
+}
+
+// CreateStonithDevice adds a fence device to the configuration.
+func (c *CIB) CreateStonithDevice(device StonithDevice) error {
+	if device.Agent == "" {
+		return fmt.Errorf("stonith device %s: agent must not be empty", device.ID)
+	}
+	if device.MonitorInterval == "" {
+		device.MonitorInterval = "60s"
+	}
+
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	ids := NewIDAllocator(c.Doc)
+	if err := ids.Reserve(device.ID); err != nil {
+		return fmt.Errorf("stonith device %s: %w", device.ID, err)
+	}
+
+	configuration := root.FindElement("configuration")
+	if configuration == nil {
+		configuration = root.CreateElement("configuration")
+	}
+	resources := configuration.FindElement("resources")
+	if resources == nil {
+		resources = configuration.CreateElement("resources")
+	}
+
+	elem := resources.CreateElement(string(KindPrimitive))
+	elem.CreateAttr(cibAttrKeyID, device.ID)
+	elem.CreateAttr("class", "stonith")
+	elem.CreateAttr("type", device.Agent)
+
+	addNvSet(elem, cibTagInstAttr, ids.Allocate(device.ID, cibTagInstAttr), stonithParams(device), ids)
+	addNvSet(elem, cibTagMetaAttr, ids.Allocate(device.ID, cibTagMetaAttr), device.Meta, ids)
+
+	ops := elem.CreateElement("operations")
+	op := ops.CreateElement("op")
+	op.CreateAttr(cibAttrKeyID, ids.Allocate(device.ID, "monitor", "interval", device.MonitorInterval))
+	op.CreateAttr(cibAttrKeyName, cibAttrValueMonitor)
+	op.CreateAttr("interval", device.MonitorInterval)
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// UpdateStonithDevice replaces the instance attributes of a fence device,
+// including its host list, map and check, with those of the given device.
+// The agent, meta attributes and operations are not changed.
+func (c *CIB) UpdateStonithDevice(device StonithDevice) error {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	if !isStonithDevice(root, device.ID) {
+		return fmt.Errorf("%s is not a configured stonith device", device.ID)
+	}
+	elem := findResourceElement(root, device.ID)
+
+	// Fill the first set with the new parameters, so it keeps its ID and
+	// position. Pacemaker takes the first definition of a parameter, so
+	// further sets would only hold stale values and are removed.
+	params := stonithParams(device)
+	sets := unconditionalSets(elem, cibTagInstAttr)
+	for i, set := range sets {
+		if i > 0 || len(params) == 0 {
+			elem.RemoveChild(set)
+			continue
+		}
+		for _, nvpair := range set.SelectElements(cibTagNvPair) {
+			set.RemoveChild(nvpair)
+		}
+	}
+
+	ids := NewIDAllocator(c.Doc)
+	if len(sets) == 0 {
+		addNvSet(elem, cibTagInstAttr, ids.Allocate(device.ID, cibTagInstAttr), params, ids)
+	} else if len(params) > 0 {
+		addNvPairs(sets[0], params, ids)
+	}
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// DeleteStonithDevice removes a fence device together with the constraints
+// and status entries referring to it. A device that is still used by the
+// fencing topology cannot be deleted.
+func (c *CIB) DeleteStonithDevice(id string) error {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	if !isStonithDevice(root, id) {
+		return fmt.Errorf("%s is not a configured stonith device", id)
+	}
+
+	levels, err := fencingLevels(root)
+	if err != nil {
+		return err
+	}
+	for _, level := range levels {
+		if contains(level.Devices, id) {
+			return fmt.Errorf("stonith device %s is used by fencing level %s", id, level.ID)
+		}
+	}
+
+	elem := findResourceElement(root, id)
+	elem.Parent().RemoveChild(elem)
+	c.DissolveConstraints([]string{id})
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// FenceNode asks the fencer to fence a node and waits for the result. A
+// timeout of 0 uses the fencer's default timeout.
+func (c *CIB) FenceNode(node string, action FenceAction, timeout time.Duration) error {
+	var args []string
+	switch action {
+	case FenceReboot:
+		args = []string{"--reboot", node}
+	case FenceOff:
+		args = []string{"--fence", node}
+	case FenceOn:
+		args = []string{"--unfence", node}
+	default:
+		return fmt.Errorf("invalid fence action '%s'", action)
+	}
+	if timeout > 0 {
+		args = append(args, "--timeout", strconv.Itoa(int(timeout.Seconds())))
+	}
+
+	_, stderr, err := stonithCommand.execute("", args...)
+	if err != nil {
+		return fmt.Errorf("could not %s node %s: %w: %s", action, node, err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// FenceHistory returns the fence history of a node, or of all nodes if node
+// is empty.
+func (c *CIB) FenceHistory(node string) ([]FenceEvent, error) {
+	if node == "" {
+		node = "*"
+	}
+
+	stdout, stderr, err := stonithCommand.execute("", "--history", node, "--output-as=xml")
+	if err != nil {
+		return nil, fmt.Errorf("could not read fence history: %w: %s", err, strings.TrimSpace(stderr))
+	}
+
+	doc := xmltree.NewDocument()
+	err = doc.ReadFromString(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse fence history: %w", err)
+	}
+
+	var events []FenceEvent
+	for _, elem := range doc.FindElements("//fence_event") {
+		events = append(events, parseFenceEvent(elem))
+	}
+	return events, nil
+}
+
+// PendingFenceOperations returns the fence operations that have not
+// finished yet.
+func (c *CIB) PendingFenceOperations() ([]FenceEvent, error) {
+	events, err := c.FenceHistory("")
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []FenceEvent
+	for _, event := range events {
+		if event.Status == FenceStatusPending {
+			pending = append(pending, event)
+		}
+	}
+	return pending, nil
+}
+
+// fenceTimeLayouts are the formats the fencer has used for completion
+// times.
+var fenceTimeLayouts = []string{
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05.999999 -07:00",
+	time.RFC3339,
+	time.ANSIC,
+}
+
+// parseFenceEvent parses a fence_event element of stonith_admin's or
+// crm_mon's XML output.
+func parseFenceEvent(elem *xmltree.Element) FenceEvent {
+	event := FenceEvent{
+		Target:     elem.SelectAttrValue("target", ""),
+		Action:     FenceAction(elem.SelectAttrValue("action", "")),
+		Status:     FenceStatus(elem.SelectAttrValue("status", "")),
+		Delegate:   elem.SelectAttrValue("delegate", ""),
+		Origin:     elem.SelectAttrValue("origin", ""),
+		Client:     elem.SelectAttrValue("client", ""),
+		ExitReason: elem.SelectAttrValue("exit-reason", ""),
+	}
+
+	if completed := elem.SelectAttrValue("completed", ""); completed != "" {
+		for _, layout := range fenceTimeLayouts {
+			t, err := time.Parse(layout, completed)
+			if err == nil {
+				event.Completed = t
+				break
+			}
+		}
+		if event.Completed.IsZero() {
+			log.Debugf("could not parse completion time '%s' of fence event", completed)
+		}
+	}
+
+	return event
+}
+
+// parseStonithDevice reads the configuration of a fence device.
+func parseStonithDevice(elem *xmltree.Element) StonithDevice {
+	params := nvsetValues(elem, cibTagInstAttr)
+	device := StonithDevice{
+		ID:        elem.SelectAttrValue(cibAttrKeyID, ""),
+		Agent:     elem.SelectAttrValue("type", ""),
+		HostCheck: params[paramHostCheck],
+		Params:    make(map[string]string),
+		Meta:      nvsetValues(elem, cibTagMetaAttr),
+	}
+
+	if hosts := strings.FieldsFunc(params[paramHostList], isHostListSeparator); len(hosts) > 0 {
+		device.HostList = hosts
+	}
+	for _, entry := range strings.FieldsFunc(params[paramHostMap], isHostListSeparator) {
+		if i := strings.IndexAny(entry, ":="); i > 0 {
+			if device.HostMap == nil {
+				device.HostMap = make(map[string]string)
+			}
+			device.HostMap[entry[:i]] = entry[i+1:]
+		}
+	}
+
+	for name, value := range params {
+		if name != paramHostList && name != paramHostMap && name != paramHostCheck {
+			device.Params[name] = value
+		}
+	}
+
+	for _, op := range elem.FindElements("operations/op") {
+		if op.SelectAttrValue(cibAttrKeyName, "") == cibAttrValueMonitor {
+			device.MonitorInterval = op.SelectAttrValue("interval", "")
+			break
+		}
+	}
+
+	return device
+}
+
+// stonithParams builds the instance attributes of a fence device.
+func stonithParams(device StonithDevice) map[string]string {
+	params := make(map[string]string)
+	for name, value := range device.Params {
+		params[name] = value
+	}
+	if len(device.HostList) > 0 {
+		params[paramHostList] = strings.Join(device.HostList, " ")
+	}
+	if len(device.HostMap) > 0 {
+		nodes := make([]string, 0, len(device.HostMap))
+		for node := range device.HostMap {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		entries := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			entries = append(entries, node+":"+device.HostMap[node])
+		}
+		params[paramHostMap] = strings.Join(entries, ";")
+	}
+	if device.HostCheck != "" {
+		params[paramHostCheck] = device.HostCheck
+	}
+	return params
+}
+
+func isHostListSeparator(r rune) bool {
+	return r == ' ' || r == ',' || r == ';' || r == '\t'
+}
@@ -0,0 +1,342 @@
+package cib
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListStonithDevices(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return fencingXML, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.ListStonithDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []StonithDevice{{
+		ID:       "st_ipmi_la1",
+		Agent:    "fence_ipmilan",
+		HostList: []string{"la1"},
+		Params:   map[string]string{},
+		Meta:     map[string]string{},
+	}, {
+		ID:        "st_pdu",
+		Agent:     "fence_apc",
+		HostMap:   map[string]string{"la1": "1", "la2": "2"},
+		HostCheck: "static-list",
+		Params:    map[string]string{},
+		Meta:      map[string]string{},
+	}}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected stonith devices")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+}
+
+func TestCreateStonithDevice(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return fencingXML, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.CreateStonithDevice(StonithDevice{
+		ID:       "st_ipmi_la3",
+		Agent:    "fence_ipmilan",
+		HostList: []string{"la3"},
+		HostMap:  map[string]string{"la3": "ipmi-la3"},
+		Params:   map[string]string{"ip": "10.0.0.3", "username": "admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `<primitive id="st_ipmi_la3" class="stonith" type="fence_ipmilan">
+		<instance_attributes id="st_ipmi_la3-instance_attributes">
+			<nvpair id="st_ipmi_la3-instance_attributes-ip" name="ip" value="10.0.0.3"/>
+			<nvpair id="st_ipmi_la3-instance_attributes-pcmk_host_list" name="pcmk_host_list" value="la3"/>
+			<nvpair id="st_ipmi_la3-instance_attributes-pcmk_host_map" name="pcmk_host_map" value="la3:ipmi-la3"/>
+			<nvpair id="st_ipmi_la3-instance_attributes-username" name="username" value="admin"/>
+		</instance_attributes>
+		<operations>
+			<op id="st_ipmi_la3-monitor-interval-60s" name="monitor" interval="60s"/>
+		</operations>
+	</primitive>`
+
+	elem := cib.Doc.FindElement("//primitive[@id='st_ipmi_la3']")
+	if elem == nil {
+		t.Fatal("Device not found in update")
+	}
+	doc := xmltree.NewDocument()
+	doc.SetRoot(elem.Copy())
+	actual, _ := doc.WriteToString()
+	if normalizeXML(t, actual) != normalizeXML(t, expect) {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", expect)
+		t.Errorf("Actual: %s", actual)
+	}
+
+	// the ID of an existing resource cannot be reused
+	err = cib.CreateStonithDevice(StonithDevice{ID: "p_dummy", Agent: "fence_apc"})
+	if err == nil {
+		t.Errorf("Expected error for duplicate ID")
+	}
+}
+
+func TestDeleteStonithDevice(t *testing.T) {
+	input := strings.Replace(fencingXML, `<fencing-level id="fl-la1-1" target="la1" index="1" devices="st_ipmi_la1"/>`, "", 1)
+
+	cases := []struct {
+		desc        string
+		id          string
+		expectError bool
+	}{{
+		desc: "unused device",
+		id:   "st_ipmi_la1",
+	}, {
+		desc:        "device used by fencing levels",
+		id:          "st_pdu",
+		expectError: true,
+	}, {
+		desc:        "not a stonith device",
+		id:          "p_dummy",
+		expectError: true,
+	}}
+
+	for _, c := range cases {
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				return input, "", nil
+			},
+		}
+		updated := false
+		updateCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				updated = true
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		err := cib.DeleteStonithDevice(c.id)
+		if err != nil {
+			if !c.expectError {
+				t.Errorf("Unexpected error in case '%s': %s", c.desc, err)
+			}
+			if updated {
+				t.Errorf("Unexpected update in case '%s'", c.desc)
+			}
+			continue
+		}
+		if c.expectError {
+			t.Errorf("Expected error in case '%s'", c.desc)
+			continue
+		}
+		if cib.Doc.FindElement("//primitive[@id='"+c.id+"']") != nil {
+			t.Errorf("Device not removed in case '%s'", c.desc)
+		}
+	}
+}
+
+func TestFenceNode(t *testing.T) {
+	cases := []struct {
+		action  FenceAction
+		timeout time.Duration
+		expect  []string
+	}{{
+		action: FenceReboot,
+		expect: []string{"--reboot", "la1"},
+	}, {
+		action:  FenceOff,
+		timeout: 2 * time.Minute,
+		expect:  []string{"--fence", "la1", "--timeout", "120"},
+	}, {
+		action: FenceOn,
+		expect: []string{"--unfence", "la1"},
+	}}
+
+	for _, c := range cases {
+		var args []string
+		stonithCommand = &argsCommand{
+			func(_ string, a []string) (string, string, error) {
+				args = a
+				return "", "", nil
+			},
+		}
+
+		var cib CIB
+		err := cib.FenceNode("la1", c.action, c.timeout)
+		if err != nil {
+			t.Errorf("Unexpected error for action %s: %s", c.action, err)
+			continue
+		}
+		if !cmp.Equal(args, c.expect) {
+			t.Errorf("Unexpected arguments for action %s: %v", c.action, args)
+		}
+	}
+
+	var cib CIB
+	if err := cib.FenceNode("la1", "cycle", 0); err == nil {
+		t.Errorf("Expected error for invalid action")
+	}
+}
+
+func TestFenceHistory(t *testing.T) {
+	output := `<pacemaker-result api-version="2.3" request="stonith_admin --history * --output-as=xml">
+		<fence_history>
+			<fence_event action="reboot" target="la2" client="pacemaker-controld.1234" origin="la1" status="pending" extended-status="pending"/>
+			<fence_event action="off" target="la3" client="stonith_admin.5678" origin="la1" status="failed" exit-reason="No such device" delegate="la2" completed="2026-10-17 08:15:42 +02:00"/>
+			<fence_event action="reboot" target="la3" client="pacemaker-controld.1234" origin="la2" status="success" delegate="la1" completed="2026-10-16 21:03:10Z"/>
+		</fence_history>
+		<status code="0" message="OK"/>
+	</pacemaker-result>`
+
+	var args []string
+	stonithCommand = &argsCommand{
+		func(_ string, a []string) (string, string, error) {
+			args = a
+			return output, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.FenceHistory("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(args, []string{"--history", "*", "--output-as=xml"}) {
+		t.Errorf("Unexpected arguments for stonith_admin: %v", args)
+	}
+
+	expect := []FenceEvent{{
+		Target: "la2",
+		Action: FenceReboot,
+		Status: FenceStatusPending,
+		Origin: "la1",
+		Client: "pacemaker-controld.1234",
+	}, {
+		Target:     "la3",
+		Action:     FenceOff,
+		Status:     FenceStatusFailed,
+		Delegate:   "la2",
+		Origin:     "la1",
+		Client:     "stonith_admin.5678",
+		ExitReason: "No such device",
+		Completed:  time.Date(2026, 10, 17, 6, 15, 42, 0, time.UTC),
+	}, {
+		Target:    "la3",
+		Action:    FenceReboot,
+		Status:    FenceStatusSuccess,
+		Delegate:  "la1",
+		Origin:    "la2",
+		Client:    "pacemaker-controld.1234",
+		Completed: time.Date(2026, 10, 16, 21, 3, 10, 0, time.UTC),
+	}}
+	equalTime := cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })
+	if !cmp.Equal(actual, expect, equalTime) {
+		t.Errorf("Unexpected fence history")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+
+	pending, err := cib.PendingFenceOperations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Target != "la2" {
+		t.Errorf("Unexpected pending fence operations: %+v", pending)
+	}
+}
+
+func TestUpdateStonithDevice(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return fencingXML, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.UpdateStonithDevice(StonithDevice{
+		ID:       "st_pdu",
+		HostMap:  map[string]string{"la1": "1", "la2": "2", "la3": "3"},
+		HostList: []string{"la1", "la2", "la3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `<primitive id="st_pdu" class="stonith" type="fence_apc">
+		<instance_attributes id="st_pdu-instance_attributes">
+			<nvpair id="st_pdu-instance_attributes-pcmk_host_list" name="pcmk_host_list" value="la1 la2 la3"/>
+			<nvpair id="st_pdu-instance_attributes-pcmk_host_map" name="pcmk_host_map" value="la1:1;la2:2;la3:3"/>
+		</instance_attributes>
+	</primitive>`
+
+	doc := xmltree.NewDocument()
+	doc.SetRoot(cib.Doc.FindElement("//primitive[@id='st_pdu']").Copy())
+	actual, _ := doc.WriteToString()
+	if normalizeXML(t, actual) != normalizeXML(t, expect) {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", expect)
+		t.Errorf("Actual: %s", actual)
+	}
+
+	if err := cib.UpdateStonithDevice(StonithDevice{ID: "p_dummy"}); err == nil {
+		t.Errorf("Expected error for a resource that is not a stonith device")
+	}
+}
+
+func TestUpdateStonithDeviceCompact(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return `<cib><configuration><resources><primitive id="st_ipmi" class="stonith" type="fence_ipmilan"><instance_attributes id="st_ipmi-ia"><nvpair id="st_ipmi-ia-ip" name="ip" value="10.0.0.1"/></instance_attributes><operations/></primitive></resources></configuration></cib>`, "", nil
+		},
+	}
+	updateCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return "", "", nil
+		},
+	}
+
+	var cib CIB
+	err := cib.UpdateStonithDevice(StonithDevice{
+		ID:       "st_ipmi",
+		HostList: []string{"la1"},
+		Params:   map[string]string{"ip": "10.0.0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `<primitive id="st_ipmi" class="stonith" type="fence_ipmilan"><instance_attributes id="st_ipmi-ia"><nvpair id="st_ipmi-ia-ip" name="ip" value="10.0.0.2"/><nvpair id="st_ipmi-ia-pcmk_host_list" name="pcmk_host_list" value="la1"/></instance_attributes><operations/></primitive>`
+
+	doc := xmltree.NewDocument()
+	doc.SetRoot(cib.Doc.FindElement("//primitive[@id='st_ipmi']").Copy())
+	actual, _ := doc.WriteToString()
+	if actual != expect {
+		t.Errorf("XML does not match")
+		t.Errorf("Expected: %s", expect)
+		t.Errorf("Actual: %s", actual)
+	}
+}
@@ -0,0 +1,197 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// StopOptions configures StopResources.
+type StopOptions struct {
+	// Backoff controls how often the CIB is checked while waiting
+	Backoff Backoff
+	// Rollback restores the previous target-roles of all resources if they
+	// did not stop before the context is done.
+	Rollback bool
+}
+
+// StopResult is the outcome of stopping a single resource.
+type StopResult struct {
+	ID string
+	// PreviousRole is the target-role before the stop, empty if none was
+	// set
+	PreviousRole string
+	// Stopped reports whether the resource was stopped on the last check
+	Stopped bool
+	// State describes the state of a resource that did not stop
+	State string
+	// RolledBack reports whether the previous target-role was restored
+	RolledBack bool
+}
+
+// StopResources sets the target-role of the given resources to Stopped,
+// commits the change and waits until they are stopped. Groups, clones and
+// bundles are stopped once all primitives in them are stopped. The
+// target-roles are only modified if all resources exist.
+//
+// If the resources do not stop before the context is done, the error wraps
+// the context's error and the results tell which resources are still
+// running. With Rollback set, the previous target-roles of all resources
+// are restored in that case, so the cluster starts them again. Other
+// errors, e.g. if the CIB cannot be read while waiting, are returned
+// without a rollback.
+func (c *CIB) StopResources(ctx context.Context, ids []string, opts StopOptions) ([]StopResult, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return nil, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	results := make([]StopResult, len(ids))
+	primitives := make(map[string][]string)
+	var waitIDs []string
+	for i, id := range ids {
+		rscElem := findResourceElement(root, id)
+		if rscElem == nil {
+			return nil, fmt.Errorf("resource %s not found", id)
+		}
+		results[i] = StopResult{ID: id, PreviousRole: targetRole(rscElem)}
+		primitives[id] = primitiveIDs(rscElem)
+		waitIDs = append(waitIDs, primitives[id]...)
+	}
+
+	for _, id := range ids {
+		c.setTargetRole(findResourceElement(root, id), cibAttrValueStopped)
+	}
+
+	err = c.Update()
+	if err != nil {
+		return nil, fmt.Errorf("could not update CIB: %w", err)
+	}
+
+	report, err := c.WaitForResourcesStopped(ctx, waitIDs, opts.Backoff)
+	pending := make(map[string]WaitItem)
+	for _, item := range report.Pending {
+		pending[item.ID] = item
+	}
+	for i := range results {
+		var states []string
+		for _, primitive := range primitives[results[i].ID] {
+			item, ok := pending[primitive]
+			if !ok {
+				continue
+			}
+			state := item.Actual
+			if primitive != results[i].ID {
+				state = primitive + ": " + state
+			}
+			states = append(states, state)
+		}
+		results[i].Stopped = len(states) == 0 && report.Checks > 0
+		results[i].State = strings.Join(states, "; ")
+	}
+	if err == nil {
+		return results, nil
+	}
+	if !opts.Rollback || ctx.Err() == nil {
+		return results, err
+	}
+
+	log.Warnf("Resources did not stop, restoring their target-roles: %v", err)
+	rollbackErr := c.restoreTargetRoles(results)
+	if rollbackErr != nil {
+		return results, fmt.Errorf("%v; could not restore target-roles: %w", err, rollbackErr)
+	}
+	for i := range results {
+		results[i].RolledBack = true
+	}
+	return results, err
+}
+
+// restoreTargetRoles sets the target-roles of the resources back to the
+// ones recorded in the results.
+func (c *CIB) restoreTargetRoles(results []StopResult) error {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	for _, result := range results {
+		rscElem := findResourceElement(root, result.ID)
+		if rscElem == nil {
+			return fmt.Errorf("resource %s not found", result.ID)
+		}
+		c.setTargetRole(rscElem, result.PreviousRole)
+	}
+
+	err = c.Update()
+	if err != nil {
+		return fmt.Errorf("could not update CIB: %w", err)
+	}
+	return nil
+}
+
+// primitiveIDs returns the IDs of the primitives in a resource element,
+// or the resource's own ID if it is a primitive.
+func primitiveIDs(rscElem *xmltree.Element) []string {
+	if rscElem.Tag == string(KindPrimitive) {
+		return []string{rscElem.SelectAttrValue(cibAttrKeyID, "")}
+	}
+	var ids []string
+	for _, elem := range rscElem.FindElements(".//" + string(KindPrimitive)) {
+		ids = append(ids, elem.SelectAttrValue(cibAttrKeyID, ""))
+	}
+	return ids
+}
+
+// targetRoleEntry finds the nvpair that modifyTargetRole sets.
+func targetRoleEntry(rscElem *xmltree.Element) *xmltree.Element {
+	metaAttr := rscElem.FindElement(cibTagMetaAttr)
+	if metaAttr == nil {
+		return nil
+	}
+	return metaAttr.FindElement(cibTagNvPair + "[@" + cibAttrKeyName + "='" + cibAttrValueTargetRole + "']")
+}
+
+func targetRole(rscElem *xmltree.Element) string {
+	if entry := targetRoleEntry(rscElem); entry != nil {
+		return entry.SelectAttrValue(cibAttrKeyValue, "")
+	}
+	return ""
+}
+
+// setTargetRole sets the target-role of a resource, or removes it if role
+// is empty.
+func (c *CIB) setTargetRole(rscElem *xmltree.Element, role string) {
+	entry := targetRoleEntry(rscElem)
+	if role == "" {
+		if entry != nil {
+			entry.Parent().RemoveChild(entry)
+		}
+		return
+	}
+	if entry == nil {
+		ids := NewIDAllocator(c.Doc)
+		metaAttr := rscElem.FindElement(cibTagMetaAttr)
+		if metaAttr == nil {
+			metaAttr = rscElem.CreateElement(cibTagMetaAttr)
+			metaAttr.CreateAttr(cibAttrKeyID, ids.Allocate(rscElem.SelectAttrValue(cibAttrKeyID, ""), "meta_attributes"))
+		}
+		entry = metaAttr.CreateElement(cibTagNvPair)
+		entry.CreateAttr(cibAttrKeyID, ids.Allocate(metaAttr.SelectAttrValue(cibAttrKeyID, ""), cibAttrValueTargetRole))
+		entry.CreateAttr(cibAttrKeyName, cibAttrValueTargetRole)
+	}
+	entry.CreateAttr(cibAttrKeyValue, role)
+}
@@ -0,0 +1,229 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+// stopXML is a CIB with p_ip and p_web running on la1.
+const stopXML = `<cib><configuration>
+<nodes><node id="1" uname="la1"/></nodes>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2">
+		<meta_attributes id="p_ip-meta_attributes">
+			<nvpair id="p_ip-meta_attributes-target-role" name="target-role" value="Started"/>
+		</meta_attributes>
+	</primitive>
+	<primitive id="p_web" class="ocf" provider="heartbeat" type="apache"/>
+</resources>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_ip">
+			<lrm_rsc_op id="p_ip_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+		<lrm_resource id="p_web">
+			<lrm_rsc_op id="p_web_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+
+// targetRoles returns the target-roles set in a CIB passed to cibadmin.
+func targetRoles(t *testing.T, xml string) map[string]string {
+	doc := xmltree.NewDocument()
+	if err := doc.ReadFromString(xml); err != nil {
+		t.Fatal(err)
+	}
+	roles := make(map[string]string)
+	for _, rsc := range doc.FindElements("//primitive") {
+		if role := targetRole(rsc); role != "" {
+			roles[rsc.SelectAttrValue("id", "")] = role
+		}
+	}
+	return roles
+}
+
+func TestStopResources(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	ipStopped := strings.Replace(stopXML, `id="p_ip_last_0" operation="start"`, `id="p_ip_last_0" operation="stop"`, 1)
+	allStopped := strings.Replace(ipStopped, `id="p_web_last_0" operation="start"`, `id="p_web_last_0" operation="stop"`, 1)
+
+	var updates []string
+	updateCommand = &testCommand{
+		func(stdin string) (string, string, error) {
+			updates = append(updates, stdin)
+			return "", "", nil
+		},
+	}
+
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			if reads < 3 {
+				return stopXML, "", nil
+			}
+			return allStopped, "", nil
+		},
+	}
+
+	var cib CIB
+	results, err := cib.StopResources(context.Background(), []string{"p_ip", "p_web"}, StopOptions{Backoff: backoff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []StopResult{
+		{ID: "p_ip", PreviousRole: "Started", Stopped: true},
+		{ID: "p_web", Stopped: true},
+	}
+	if !cmp.Equal(results, expect) {
+		t.Errorf("Unexpected results")
+		t.Errorf("Diff: %s", cmp.Diff(expect, results))
+	}
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 update, got %d", len(updates))
+	}
+	if roles := targetRoles(t, updates[0]); !cmp.Equal(roles, map[string]string{"p_ip": "Stopped", "p_web": "Stopped"}) {
+		t.Errorf("Unexpected target-roles: %v", roles)
+	}
+
+	// p_web does not stop, restore the previous target-roles
+	updates = nil
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return ipStopped, "", nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results, err = cib.StopResources(ctx, []string{"p_ip", "p_web"}, StopOptions{Backoff: backoff, Rollback: true})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	expect = []StopResult{
+		{ID: "p_ip", PreviousRole: "Started", Stopped: true, RolledBack: true},
+		{ID: "p_web", State: "Running on la1", RolledBack: true},
+	}
+	if !cmp.Equal(results, expect) {
+		t.Errorf("Unexpected results")
+		t.Errorf("Diff: %s", cmp.Diff(expect, results))
+	}
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %d", len(updates))
+	}
+	if roles := targetRoles(t, updates[1]); !cmp.Equal(roles, map[string]string{"p_ip": "Started"}) {
+		t.Errorf("Unexpected target-roles after rollback: %v", roles)
+	}
+
+	// a read error while waiting does not restart the resources
+	updates = nil
+	reads = 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			if reads == 2 {
+				return "", "", errors.New("cibadmin failed")
+			}
+			return stopXML, "", nil
+		},
+	}
+	_, err = cib.StopResources(context.Background(), []string{"p_ip", "p_web"}, StopOptions{Backoff: backoff, Rollback: true})
+	if err == nil {
+		t.Errorf("Expected read error")
+	}
+	if len(updates) != 1 {
+		t.Errorf("Expected no rollback after a read error, got %d updates", len(updates))
+	}
+
+	updates = nil
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return ipStopped, "", nil
+		},
+	}
+	if _, err := cib.StopResources(context.Background(), []string{"p_ip", "p_missing"}, StopOptions{}); err == nil {
+		t.Errorf("Expected error for missing resource")
+	}
+	if len(updates) != 0 {
+		t.Errorf("Expected no update for missing resource")
+	}
+}
+
+func TestStopResourcesGroup(t *testing.T) {
+	groupXML := `<cib><configuration>
+<nodes><node id="1" uname="la1"/></nodes>
+<resources>
+	<group id="g_app">
+		<primitive id="p_a" class="ocf" provider="heartbeat" type="Dummy"/>
+		<primitive id="p_b" class="ocf" provider="heartbeat" type="Dummy"/>
+	</group>
+</resources>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_a">
+			<lrm_rsc_op id="p_a_last_0" operation="stop" call-id="5" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+		<lrm_resource id="p_b">
+			<lrm_rsc_op id="p_b_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+	groupStopped := strings.Replace(groupXML, `id="p_b_last_0" operation="start"`, `id="p_b_last_0" operation="stop"`, 1)
+
+	var updates []string
+	updateCommand = &testCommand{
+		func(stdin string) (string, string, error) {
+			updates = append(updates, stdin)
+			return "", "", nil
+		},
+	}
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return groupXML, "", nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var cib CIB
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+	results, err := cib.StopResources(ctx, []string{"g_app"}, StopOptions{Backoff: backoff})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	expect := []StopResult{{ID: "g_app", State: "p_b: Running on la1"}}
+	if !cmp.Equal(results, expect) {
+		t.Errorf("Unexpected results")
+		t.Errorf("Diff: %s", cmp.Diff(expect, results))
+	}
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 update, got %d", len(updates))
+	}
+	doc := xmltree.NewDocument()
+	if err := doc.ReadFromString(updates[0]); err != nil {
+		t.Fatal(err)
+	}
+	if role := targetRole(doc.FindElement("//group[@id='g_app']")); role != "Stopped" {
+		t.Errorf("Unexpected target-role of g_app: '%s'", role)
+	}
+
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return groupStopped, "", nil
+		},
+	}
+	results, err = cib.StopResources(context.Background(), []string{"g_app"}, StopOptions{Backoff: backoff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(results, []StopResult{{ID: "g_app", Stopped: true}}) {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+}
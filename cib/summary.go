@@ -0,0 +1,286 @@
+package cib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	xmltree "github.com/beevik/etree"
+)
+
+// CIBVersion identifies a revision of the CIB. Pacemaker increases
+// admin_epoch on administrative changes, epoch on every configuration
+// change and num_updates on every status change.
+type CIBVersion struct {
+	AdminEpoch int
+	Epoch      int
+	NumUpdates int
+}
+
+func (v CIBVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.AdminEpoch, v.Epoch, v.NumUpdates)
+}
+
+// Compare returns -1, 0 or 1 if v is older than, the same as or newer than
+// other.
+func (v CIBVersion) Compare(other CIBVersion) int {
+	pairs := [][2]int{
+		{v.AdminEpoch, other.AdminEpoch},
+		{v.Epoch, other.Epoch},
+		{v.NumUpdates, other.NumUpdates},
+	}
+	for _, p := range pairs {
+		if p[0] < p[1] {
+			return -1
+		}
+		if p[0] > p[1] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// NodeCounts counts the nodes of a cluster, including remote and guest
+// nodes.
+type NodeCounts struct {
+	Total int
+	// Online counts the nodes that are members of the cluster, including
+	// those in standby.
+	Online int
+	// Standby counts the nodes in standby, whether online or not.
+	Standby int
+	Offline int
+}
+
+// ResourceCounts counts the primitive resources of a cluster.
+type ResourceCounts struct {
+	Total int
+	// Running counts the resources that are active on at least one node
+	Running int
+	// Stopped counts the resources that are not active anywhere
+	Stopped int
+	// Failed counts the resources with a failed operation recorded on any
+	// node. A failed resource is also counted as either running or stopped.
+	Failed int
+}
+
+// ClusterSummary is an overview of the state of a cluster, taken from the
+// attributes of the <cib> element and the status section.
+type ClusterSummary struct {
+	HaveQuorum bool
+	// DC is the name of the designated controller node, DCID its ID. Both
+	// are empty if no DC is elected.
+	DC   string
+	DCID string
+
+	Version CIBVersion
+	// ValidateWith is the schema the CIB is validated against
+	ValidateWith string
+	FeatureSet   string
+
+	// LastWritten is the time of the last configuration change, as
+	// recorded by Pacemaker
+	LastWritten string
+	// UpdateOrigin is the node the last change was made on, UpdateClient
+	// and UpdateUser the client and user that made it
+	UpdateOrigin string
+	UpdateClient string
+	UpdateUser   string
+
+	Nodes     NodeCounts
+	Resources ResourceCounts
+}
+
+// Summary returns an overview of the state of the cluster.
+func (c *CIB) Summary() (ClusterSummary, error) {
+	err := c.ReadConfiguration()
+	if err != nil {
+		return ClusterSummary{}, fmt.Errorf("could not read configuration: %w", err)
+	}
+
+	root := c.Doc.FindElement("/cib")
+	if root == nil {
+		return ClusterSummary{}, fmt.Errorf("invalid cib state: root element not found")
+	}
+
+	summary := ClusterSummary{
+		HaveQuorum:   isTrue(root.SelectAttrValue("have-quorum", "")),
+		DCID:         root.SelectAttrValue("dc-uuid", ""),
+		ValidateWith: root.SelectAttrValue("validate-with", ""),
+		FeatureSet:   root.SelectAttrValue("crm_feature_set", ""),
+		LastWritten:  root.SelectAttrValue("cib-last-written", ""),
+		UpdateOrigin: root.SelectAttrValue("update-origin", ""),
+		UpdateClient: root.SelectAttrValue("update-client", ""),
+		UpdateUser:   root.SelectAttrValue("update-user", ""),
+	}
+
+	summary.Version, err = cibVersion(root)
+	if err != nil {
+		return ClusterSummary{}, err
+	}
+
+	if summary.DCID != "" {
+		summary.DC = nodeNameByID(root, summary.DCID)
+	}
+
+	summary.Nodes = countNodes(root)
+
+	summary.Resources, err = c.countResources(root)
+	if err != nil {
+		return ClusterSummary{}, err
+	}
+
+	return summary, nil
+}
+
+// cibVersion reads the version counters from the <cib> element.
+func cibVersion(root *xmltree.Element) (CIBVersion, error) {
+	var version CIBVersion
+	counters := []struct {
+		name  string
+		value *int
+	}{
+		{"admin_epoch", &version.AdminEpoch},
+		{"epoch", &version.Epoch},
+		{"num_updates", &version.NumUpdates},
+	}
+	for _, counter := range counters {
+		str := root.SelectAttrValue(counter.name, "")
+		if str == "" {
+			continue
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return CIBVersion{}, fmt.Errorf("invalid %s '%s': %w", counter.name, str, err)
+		}
+		*counter.value = n
+	}
+	return version, nil
+}
+
+// nodeNameByID resolves a node ID to the node's name, using the node
+// section and, for nodes not configured there, the status section.
+func nodeNameByID(root *xmltree.Element, id string) string {
+	for _, path := range []string{"configuration/nodes/node", "status/node_state"} {
+		for _, elem := range root.FindElements(path) {
+			if elem.SelectAttrValue(cibAttrKeyID, "") == id {
+				if uname := elem.SelectAttrValue("uname", ""); uname != "" {
+					return uname
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func countNodes(root *xmltree.Element) NodeCounts {
+	var counts NodeCounts
+	for name, online := range nodeOnlineStates(root) {
+		counts.Total++
+		if online {
+			counts.Online++
+		} else {
+			counts.Offline++
+		}
+		if attrs, err := effectiveNodeAttributes(root, name); err == nil && isTrue(attrs["standby"]) {
+			counts.Standby++
+		}
+	}
+	return counts
+}
+
+// nodeOnlineStates maps all known nodes, including remote and guest nodes,
+// to whether they are online. Remote and guest nodes are online if their
+// connection is up, or for remote nodes without a connection resource, if
+// they are in the membership.
+func nodeOnlineStates(root *xmltree.Element) map[string]bool {
+	online := make(map[string]bool)
+
+	for _, remote := range listRemoteNodes(root) {
+		node := remoteNodeInfo(root, remote, findNodeStateElement(root, remote.Name))
+		online[remote.Name] = node.State.Crmd
+	}
+
+	for _, path := range []string{"configuration/nodes/node", "status/node_state"} {
+		for _, elem := range root.FindElements(path) {
+			name := elem.SelectAttrValue("uname", "")
+			if _, ok := online[name]; ok || name == "" {
+				continue
+			}
+			if isTrue(elem.SelectAttrValue("remote_node", "")) || elem.SelectAttrValue("type", "") == "remote" {
+				state := findNodeStateElement(root, name)
+				online[name] = state != nil && state.SelectAttrValue("in_ccm", "") == "true"
+				continue
+			}
+			online[name] = clusterNodeOnline(findNodeStateElement(root, name))
+		}
+	}
+
+	return online
+}
+
+// clusterNodeOnline reports whether the status entry of a cluster node
+// shows it as an active member. A missing entry means the node is offline.
+func clusterNodeOnline(state *xmltree.Element) bool {
+	return state != nil &&
+		state.SelectAttrValue("in_ccm", "") == "true" &&
+		state.SelectAttrValue("crmd", "") == "online" &&
+		joinState(state.SelectAttrValue("join", "")) == JoinMember
+}
+
+func (c *CIB) countResources(root *xmltree.Element) (ResourceCounts, error) {
+	resources, err := c.ListResources()
+	if err != nil {
+		return ResourceCounts{}, err
+	}
+
+	running := make(map[string]bool)
+	for _, lrmRsc := range root.FindElements("status/node_state/lrm/lrm_resources/lrm_resource") {
+		id := lrmResourceID(lrmRsc.SelectAttrValue(cibAttrKeyID, ""))
+		if updateRunState(id, lrmRsc, Unknown) == Running {
+			running[id] = true
+		}
+	}
+
+	history, err := operationHistory(root)
+	if err != nil {
+		return ResourceCounts{}, err
+	}
+	failed := make(map[string]bool)
+	for _, node := range history.Nodes() {
+		for lrmID, ops := range history.byNode[node] {
+			for _, op := range ops {
+				if op.Failed() {
+					failed[lrmResourceID(lrmID)] = true
+				}
+			}
+		}
+	}
+
+	var counts ResourceCounts
+	for _, rsc := range resources {
+		if rsc.Kind != KindPrimitive {
+			continue
+		}
+		counts.Total++
+		if running[rsc.ID] {
+			counts.Running++
+		} else {
+			counts.Stopped++
+		}
+		if failed[rsc.ID] {
+			counts.Failed++
+		}
+	}
+
+	return counts, nil
+}
+
+// lrmResourceID strips the instance number from the status entry ID of an
+// anonymous clone instance.
+func lrmResourceID(id string) string {
+	if i := strings.LastIndex(id, ":"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
@@ -0,0 +1,116 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSummary(t *testing.T) {
+	xml := `<cib crm_feature_set="3.2.0" validate-with="pacemaker-3.2" epoch="42" num_updates="7" admin_epoch="1"
+		cib-last-written="Tue Mar 10 12:00:00 2020" update-origin="la1" update-client="cibadmin" update-user="root"
+		have-quorum="1" dc-uuid="2">
+	<configuration>
+	<nodes>
+		<node id="1" uname="la1"/>
+		<node id="2" uname="la2">
+			<instance_attributes id="nodes-2">
+				<nvpair id="nodes-2-standby" name="standby" value="on"/>
+			</instance_attributes>
+		</node>
+		<node id="3" uname="la3"/>
+	</nodes>
+	<resources>
+		<primitive id="p_a" class="ocf" provider="heartbeat" type="Dummy"/>
+		<primitive id="p_b" class="ocf" provider="heartbeat" type="Dummy"/>
+		<clone id="cl_c">
+			<primitive id="p_c" class="ocf" provider="heartbeat" type="Dummy"/>
+		</clone>
+		<primitive id="remote1" class="ocf" provider="pacemaker" type="remote"/>
+	</resources>
+	</configuration>
+	<status>
+		<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member">
+			<lrm><lrm_resources>
+				<lrm_resource id="p_a">
+					<lrm_rsc_op id="p_a_last_0" operation="start" transition-key="3:1:0:uuid" rc-code="0" op-status="0"/>
+					<lrm_rsc_op id="p_a_monitor_10000" operation="monitor" transition-key="4:1:0:uuid" rc-code="0" op-status="0"/>
+				</lrm_resource>
+				<lrm_resource id="p_b">
+					<lrm_rsc_op id="p_b_last_0" operation="monitor" transition-key="5:1:7:uuid" rc-code="7" op-status="0"/>
+				</lrm_resource>
+				<lrm_resource id="p_c:0">
+					<lrm_rsc_op id="p_c_last_0" operation="start" transition-key="6:1:0:uuid" rc-code="0" op-status="0"/>
+					<lrm_rsc_op id="p_c_monitor_10000" operation="monitor" transition-key="9:1:0:uuid" rc-code="0" op-status="2"/>
+				</lrm_resource>
+				<lrm_resource id="remote1">
+					<lrm_rsc_op id="remote1_last_0" operation="start" transition-key="7:1:0:uuid" rc-code="0" op-status="0"/>
+				</lrm_resource>
+			</lrm_resources></lrm>
+		</node_state>
+		<node_state id="2" uname="la2" in_ccm="true" crmd="online" join="member" expected="member">
+			<lrm><lrm_resources>
+				<lrm_resource id="p_b">
+					<lrm_rsc_op id="p_b_last_failure_0" operation="start" transition-key="8:1:0:uuid" rc-code="1" op-status="4"/>
+				</lrm_resource>
+			</lrm_resources></lrm>
+		</node_state>
+		<node_state id="3" uname="la3" in_ccm="false" crmd="offline" join="down" expected="down"/>
+		<node_state id="remote1" uname="remote1" remote_node="true" in_ccm="true"/>
+	</status></cib>`
+
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			reads++
+			return xml, "", nil
+		},
+	}
+
+	var cib CIB
+	actual, err := cib.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reads != 1 {
+		t.Errorf("Expected 1 read of the CIB, got %d", reads)
+	}
+
+	expect := ClusterSummary{
+		HaveQuorum:   true,
+		DC:           "la2",
+		DCID:         "2",
+		Version:      CIBVersion{AdminEpoch: 1, Epoch: 42, NumUpdates: 7},
+		ValidateWith: "pacemaker-3.2",
+		FeatureSet:   "3.2.0",
+		LastWritten:  "Tue Mar 10 12:00:00 2020",
+		UpdateOrigin: "la1",
+		UpdateClient: "cibadmin",
+		UpdateUser:   "root",
+		Nodes:        NodeCounts{Total: 4, Online: 3, Standby: 1, Offline: 1},
+		Resources:    ResourceCounts{Total: 4, Running: 3, Stopped: 1, Failed: 2},
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected summary")
+		t.Errorf("Expected: %+v", expect)
+		t.Errorf("Actual: %+v", actual)
+	}
+}
+
+func TestCIBVersionCompare(t *testing.T) {
+	cases := []struct {
+		a, b   CIBVersion
+		expect int
+	}{
+		{CIBVersion{0, 5, 1}, CIBVersion{0, 5, 1}, 0},
+		{CIBVersion{0, 5, 1}, CIBVersion{0, 5, 2}, -1},
+		{CIBVersion{0, 6, 0}, CIBVersion{0, 5, 9}, 1},
+		{CIBVersion{1, 0, 0}, CIBVersion{0, 9, 9}, 1},
+	}
+
+	for _, c := range cases {
+		if actual := c.a.Compare(c.b); actual != c.expect {
+			t.Errorf("Compare(%s, %s): expected %d, got %d", c.a, c.b, c.expect, actual)
+		}
+	}
+}
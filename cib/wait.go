@@ -0,0 +1,294 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backoff controls the intervals between two checks of the cluster state.
+// Zero values are replaced by defaults.
+type Backoff struct {
+	// Initial is the interval after the first check. The default is 250ms,
+	// but at most Max.
+	Initial time.Duration
+	// Max is the longest interval. The default is the package's CIB poll
+	// delay.
+	Max time.Duration
+	// Factor is multiplied with the interval after every check. The
+	// default is 2; use 1 for a constant interval.
+	Factor float64
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Max <= 0 {
+		b.Max = cibPollRetryDelay
+	}
+	if b.Initial <= 0 {
+		b.Initial = 250 * time.Millisecond
+	}
+	if b.Initial > b.Max {
+		b.Initial = b.Max
+	}
+	if b.Factor < 1 {
+		b.Factor = 2
+	}
+	return b
+}
+
+// next returns the interval following the given one.
+func (b Backoff) next(interval time.Duration) time.Duration {
+	interval = time.Duration(float64(interval) * b.Factor)
+	if interval > b.Max {
+		return b.Max
+	}
+	return interval
+}
+
+// poll calls check until it reports that it is done, returns an error or
+// the context is done. Between two calls it waits for the given interval.
+func poll(ctx context.Context, interval time.Duration, check func() (bool, error)) error {
+	return pollBackoff(ctx, Backoff{Initial: interval, Max: interval, Factor: 1}, check)
+}
+
+// pollBackoff is like poll, but increases the interval between two calls
+// according to the backoff.
+func pollBackoff(ctx context.Context, backoff Backoff, check func() (bool, error)) error {
+	backoff = backoff.withDefaults()
+	interval := backoff.Initial
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		interval = backoff.next(interval)
+	}
+}
+
+// WaitItem is a resource or node that has not reached the state a wait
+// expects.
+type WaitItem struct {
+	// ID is the resource or node
+	ID string
+	// Expected describes the state that was waited for, Actual the state
+	// found on the last check
+	Expected string
+	Actual   string
+}
+
+func (i WaitItem) String() string {
+	return fmt.Sprintf("%s is %s, expected %s", i.ID, i.Actual, i.Expected)
+}
+
+// WaitReport is the result of a wait.
+type WaitReport struct {
+	// Converged reports whether the expected state was reached
+	Converged bool
+	// Pending lists what did not converge on the last check
+	Pending []WaitItem
+	// Checks is the number of times the CIB was checked
+	Checks int
+}
+
+// WaitPredicate checks a freshly read CIB and returns the items that have
+// not reached the expected state yet. The wait is over once it returns no
+// items. An error aborts the wait.
+type WaitPredicate func(c *CIB) ([]WaitItem, error)
+
+// WaitFor reads the CIB and checks the predicate until it is satisfied, it
+// returns an error or the context is done, waiting between two checks as
+// configured by the backoff. If the context is done first, the report
+// lists the items that did not converge and the error wraps the context's
+// error.
+func (c *CIB) WaitFor(ctx context.Context, predicate WaitPredicate, backoff Backoff) (WaitReport, error) {
+	var report WaitReport
+	err := pollBackoff(ctx, backoff, func() (bool, error) {
+		err := c.ReadConfiguration()
+		if err != nil {
+			return false, fmt.Errorf("could not read configuration: %w", err)
+		}
+
+		report.Checks++
+		report.Pending, err = predicate(c)
+		if err != nil {
+			return false, err
+		}
+		return len(report.Pending) == 0, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return report, fmt.Errorf("%d item(s) did not converge: %w", len(report.Pending), err)
+		}
+		return report, err
+	}
+
+	report.Converged = true
+	return report, nil
+}
+
+// WaitForResourcesStarted waits until all given primitives are started,
+// promoted or unpromoted on at least one node.
+func (c *CIB) WaitForResourcesStarted(ctx context.Context, ids []string, backoff Backoff) (WaitReport, error) {
+	return c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		return resourcesInState(c, ids, "started", func(state RunState) bool {
+			return state.State == Running || state.State == Promoted || state.State == Unpromoted
+		})
+	}, backoff)
+}
+
+// WaitForResourcesStopped waits until all given primitives are stopped on
+// every node.
+func (c *CIB) WaitForResourcesStopped(ctx context.Context, ids []string, backoff Backoff) (WaitReport, error) {
+	return c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		root, err := c.root()
+		if err != nil {
+			return nil, err
+		}
+		history, err := operationHistory(root)
+		if err != nil {
+			return nil, err
+		}
+
+		var pending []WaitItem
+		for _, id := range ids {
+			if findResourceElement(root, id) == nil {
+				return nil, fmt.Errorf("resource %s not found", id)
+			}
+			states := resourceStates(history, id)
+			for _, node := range sortedStates(states) {
+				if states[node].Active {
+					pending = append(pending, WaitItem{ID: id, Expected: "stopped", Actual: describeRunStates(states)})
+					break
+				}
+			}
+		}
+		return pending, nil
+	}, backoff)
+}
+
+// WaitForPromoted waits until the primitive of a promotable clone is
+// promoted on at least one node.
+func (c *CIB) WaitForPromoted(ctx context.Context, id string, backoff Backoff) (WaitReport, error) {
+	return c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		return resourcesInState(c, []string{id}, "promoted", func(state RunState) bool {
+			return state.State == Promoted
+		})
+	}, backoff)
+}
+
+// WaitForResourceOnNode waits until a primitive is started, promoted or
+// unpromoted on the given node.
+func (c *CIB) WaitForResourceOnNode(ctx context.Context, id, node string, backoff Backoff) (WaitReport, error) {
+	return c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		root, err := c.root()
+		if err != nil {
+			return nil, err
+		}
+		if findResourceElement(root, id) == nil {
+			return nil, fmt.Errorf("resource %s not found", id)
+		}
+		history, err := operationHistory(root)
+		if err != nil {
+			return nil, err
+		}
+
+		states := resourceStates(history, id)
+		switch states[node].State {
+		case Running, Promoted, Unpromoted:
+			return nil, nil
+		}
+		return []WaitItem{{ID: id, Expected: "started on " + node, Actual: describeRunStates(states)}}, nil
+	}, backoff)
+}
+
+// WaitForNodeOnline waits until a cluster node is a member of the cluster.
+func (c *CIB) WaitForNodeOnline(ctx context.Context, node string, backoff Backoff) (WaitReport, error) {
+	return c.WaitFor(ctx, func(c *CIB) ([]WaitItem, error) {
+		root, err := c.root()
+		if err != nil {
+			return nil, err
+		}
+
+		state := findNodeStateElement(root, node)
+		if clusterNodeOnline(state) {
+			return nil, nil
+		}
+		actual := "offline"
+		if state == nil {
+			actual = "unknown"
+		}
+		return []WaitItem{{ID: node, Expected: "online", Actual: actual}}, nil
+	}, backoff)
+}
+
+// resourcesInState returns the primitives that are not in the expected
+// state on any node.
+func resourcesInState(c *CIB, ids []string, expected string, match func(RunState) bool) ([]WaitItem, error) {
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+	history, err := operationHistory(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []WaitItem
+	for _, id := range ids {
+		if findResourceElement(root, id) == nil {
+			return nil, fmt.Errorf("resource %s not found", id)
+		}
+		states := resourceStates(history, id)
+		converged := false
+		for _, state := range states {
+			if match(state) {
+				converged = true
+				break
+			}
+		}
+		if !converged {
+			pending = append(pending, WaitItem{ID: id, Expected: expected, Actual: describeRunStates(states)})
+		}
+	}
+	return pending, nil
+}
+
+// describeRunStates summarizes the states of a resource on its nodes for
+// wait reports, e.g. "Failed on la1 (start returned 1), Stopped on la2".
+func describeRunStates(states map[string]RunState) string {
+	if len(states) == 0 {
+		return "not started anywhere"
+	}
+	var parts []string
+	for _, node := range sortedStates(states) {
+		state := states[node]
+		part := fmt.Sprintf("%s on %s", state.State, node)
+		if state.State == Failed || state.State == Unknown {
+			part += " (" + state.Reason + ")"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedStates(states map[string]RunState) []string {
+	nodes := make([]string, 0, len(states))
+	for node := range states {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -0,0 +1,139 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const waitStoppedXML = `<cib><configuration>
+<nodes><node id="1" uname="la1"/><node id="2" uname="la2"/></nodes>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2"/>
+	<clone id="ms_drbd"><primitive id="p_drbd" class="ocf" provider="linbit" type="drbd"/></clone>
+</resources>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_ip">
+			<lrm_rsc_op id="p_ip_last_0" operation="start" call-id="3" rc-code="1" op-status="0" interval="0" exit-reason="No such device"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+	<node_state id="2" uname="la2" in_ccm="false" crmd="offline" join="down" expected="down"/>
+</status></cib>`
+
+const waitStartedXML = `<cib><configuration>
+<nodes><node id="1" uname="la1"/><node id="2" uname="la2"/></nodes>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2"/>
+	<clone id="ms_drbd"><primitive id="p_drbd" class="ocf" provider="linbit" type="drbd"/></clone>
+</resources>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="1"><lrm_resources>
+		<lrm_resource id="p_ip">
+			<lrm_rsc_op id="p_ip_last_0" operation="start" call-id="5" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+		<lrm_resource id="p_drbd:0">
+			<lrm_rsc_op id="p_drbd_last_0" operation="promote" call-id="6" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+	<node_state id="2" uname="la2" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="2"><lrm_resources>
+		<lrm_resource id="p_drbd:1">
+			<lrm_rsc_op id="p_drbd_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+
+func TestWaitFor(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	cases := []struct {
+		desc string
+		wait func(ctx context.Context, cib *CIB) (WaitReport, error)
+	}{{
+		desc: "resources started",
+		wait: func(ctx context.Context, cib *CIB) (WaitReport, error) {
+			return cib.WaitForResourcesStarted(ctx, []string{"p_ip", "p_drbd"}, backoff)
+		},
+	}, {
+		desc: "promoted",
+		wait: func(ctx context.Context, cib *CIB) (WaitReport, error) {
+			return cib.WaitForPromoted(ctx, "p_drbd", backoff)
+		},
+	}, {
+		desc: "node online",
+		wait: func(ctx context.Context, cib *CIB) (WaitReport, error) {
+			return cib.WaitForNodeOnline(ctx, "la2", backoff)
+		},
+	}, {
+		desc: "resource on node",
+		wait: func(ctx context.Context, cib *CIB) (WaitReport, error) {
+			return cib.WaitForResourceOnNode(ctx, "p_drbd", "la2", backoff)
+		},
+	}}
+
+	for _, c := range cases {
+		reads := 0
+		listCommand = &testCommand{
+			func(_ string) (string, string, error) {
+				reads++
+				if reads < 3 {
+					return waitStoppedXML, "", nil
+				}
+				return waitStartedXML, "", nil
+			},
+		}
+
+		var cib CIB
+		report, err := c.wait(context.Background(), &cib)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if !report.Converged || report.Checks != 3 || len(report.Pending) != 0 {
+			t.Errorf("%s: unexpected report: %+v", c.desc, report)
+		}
+	}
+}
+
+func TestWaitForReport(t *testing.T) {
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			return waitStoppedXML, "", nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var cib CIB
+	report, err := cib.WaitForResourcesStarted(ctx, []string{"p_ip", "p_drbd"}, Backoff{Initial: time.Millisecond, Max: time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if report.Converged {
+		t.Errorf("Expected wait not to converge")
+	}
+	expect := []WaitItem{
+		{ID: "p_ip", Expected: "started", Actual: "Failed on la1 (start returned 1: No such device)"},
+		{ID: "p_drbd", Expected: "started", Actual: "not started anywhere"},
+	}
+	if !cmp.Equal(report.Pending, expect) {
+		t.Errorf("Unexpected pending items")
+		t.Errorf("Diff: %s", cmp.Diff(expect, report.Pending))
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	report, err = cib.WaitForResourcesStopped(ctx, []string{"p_ip"}, Backoff{Initial: time.Millisecond, Max: time.Millisecond})
+	if err == nil || report.Converged {
+		t.Errorf("Expected p_ip with a failed start to count as active")
+	}
+
+	_, err = cib.WaitForResourcesStarted(context.Background(), []string{"p_missing"}, Backoff{})
+	if err == nil {
+		t.Errorf("Expected error for missing resource")
+	}
+}
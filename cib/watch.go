@@ -0,0 +1,333 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventType is the kind of change reported by Watch.
+type EventType string
+
+// Event types
+const (
+	EventResourceStarted   EventType = "resource-started"
+	EventResourceStopped   EventType = "resource-stopped"
+	EventResourceMoved     EventType = "resource-moved"
+	EventResourceFailed    EventType = "resource-failed"
+	EventNodeJoined        EventType = "node-joined"
+	EventNodeLeft          EventType = "node-left"
+	EventNodeStandby       EventType = "node-standby"
+	EventNodeUnstandby     EventType = "node-unstandby"
+	EventPropertyChanged   EventType = "property-changed"
+	EventConstraintAdded   EventType = "constraint-added"
+	EventConstraintRemoved EventType = "constraint-removed"
+)
+
+// Event is a change between two versions of the CIB.
+type Event struct {
+	Type EventType
+	// Version is the version of the CIB the change was observed in
+	Version CIBVersion
+	// Resource is the primitive of resource events. Instances of anonymous
+	// clones are reported under the primitive's ID.
+	Resource string
+	// Node is the node of node events and the node a resource started,
+	// stopped or failed on. For moves, it is the destination and From the
+	// node the resource was moved away from.
+	Node string
+	From string
+	// Name, OldValue and Value describe property changes. OldValue is empty
+	// if the property was added, Value if it was removed.
+	Name     string
+	OldValue string
+	Value    string
+	// Constraint is the ID of an added or removed constraint
+	Constraint string
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventResourceMoved:
+		return fmt.Sprintf("%s %s %s -> %s", e.Type, e.Resource, e.From, e.Node)
+	case EventResourceStarted, EventResourceStopped, EventResourceFailed:
+		return fmt.Sprintf("%s %s %s", e.Type, e.Resource, e.Node)
+	case EventPropertyChanged:
+		return fmt.Sprintf("%s %s '%s' -> '%s'", e.Type, e.Name, e.OldValue, e.Value)
+	case EventConstraintAdded, EventConstraintRemoved:
+		return fmt.Sprintf("%s %s", e.Type, e.Constraint)
+	default:
+		return fmt.Sprintf("%s %s", e.Type, e.Node)
+	}
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Interval is the time between two reads of the CIB. It defaults to
+	// cibPollRetryDelay.
+	Interval time.Duration
+	// Buffer is the capacity of the event channel
+	Buffer int
+}
+
+// Watch polls the CIB and reports changes between successive versions on
+// the returned channel. The CIB is only compared if its version, made up
+// of admin_epoch, epoch and num_updates, increased since the last read.
+// Changes that are undone between two reads are not reported.
+//
+// The first read establishes the baseline and is done before Watch
+// returns; its error is returned. Later read errors are logged and the
+// read is retried after the next interval. The channel is closed once the
+// context is done.
+//
+// Watch reads the CIB into a separate document, so c.Doc is not modified.
+func (c *CIB) Watch(ctx context.Context, opts WatchOptions) (<-chan Event, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = cibPollRetryDelay
+	}
+
+	previous, err := readWatchSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, opts.Buffer)
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := readWatchSnapshot()
+			if err != nil {
+				log.Warnf("Could not read CIB while watching: %v", err)
+				continue
+			}
+			if current.version.Compare(previous.version) <= 0 {
+				continue
+			}
+
+			for _, event := range diffWatchSnapshots(previous, current) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+
+	return events, nil
+}
+
+// watchSnapshot is the part of a CIB that Watch compares.
+type watchSnapshot struct {
+	version CIBVersion
+	// active and failed map resources to the nodes they are active or
+	// failed on
+	active      map[string]map[string]bool
+	failed      map[string]map[string]bool
+	online      map[string]bool
+	standby     map[string]bool
+	properties  map[string]string
+	constraints map[string]bool
+}
+
+func readWatchSnapshot() (watchSnapshot, error) {
+	var c CIB
+	root, err := c.root()
+	if err != nil {
+		return watchSnapshot{}, err
+	}
+
+	return newWatchSnapshot(root)
+}
+
+func newWatchSnapshot(root *xmltree.Element) (watchSnapshot, error) {
+	version, err := cibVersion(root)
+	if err != nil {
+		return watchSnapshot{}, err
+	}
+
+	history, err := operationHistory(root)
+	if err != nil {
+		return watchSnapshot{}, err
+	}
+
+	snapshot := watchSnapshot{
+		version:     version,
+		active:      make(map[string]map[string]bool),
+		failed:      make(map[string]map[string]bool),
+		standby:     make(map[string]bool),
+		properties:  make(map[string]string),
+		constraints: make(map[string]bool),
+	}
+
+	add := func(m map[string]map[string]bool, id, node string) {
+		if m[id] == nil {
+			m[id] = make(map[string]bool)
+		}
+		m[id][node] = true
+	}
+	for _, node := range history.Nodes() {
+		resources := history.byNode[node]
+		for _, lrmID := range sortedKeys(resources) {
+			id := lrmResourceID(lrmID)
+			state := replayRunState(id, resources[lrmID], history.isPromotable(id))
+			if state.Active {
+				add(snapshot.active, id, node)
+			}
+			if state.State == Failed {
+				add(snapshot.failed, id, node)
+			}
+		}
+	}
+
+	snapshot.online = nodeOnlineStates(root)
+	for name := range snapshot.online {
+		if attrs, err := effectiveNodeAttributes(root, name); err == nil {
+			snapshot.standby[name] = isTrue(attrs["standby"])
+		}
+	}
+
+	if crmConfig := root.FindElement("configuration/crm_config"); crmConfig != nil {
+		snapshot.properties = nvsetValues(crmConfig, "cluster_property_set")
+	}
+
+	if constraints := root.FindElement("configuration/constraints"); constraints != nil {
+		for _, elem := range constraints.ChildElements() {
+			if id := elem.SelectAttrValue(cibAttrKeyID, ""); id != "" {
+				snapshot.constraints[id] = true
+			}
+		}
+	}
+
+	return snapshot, nil
+}
+
+// diffWatchSnapshots returns the events that lead from previous to
+// current, ordered by node events, resource events, property changes and
+// constraint changes.
+func diffWatchSnapshots(previous, current watchSnapshot) []Event {
+	var events []Event
+	emit := func(event Event) {
+		event.Version = current.version
+		events = append(events, event)
+	}
+
+	for _, node := range sortedSet(current.online) {
+		online := current.online[node]
+		if online && !previous.online[node] {
+			emit(Event{Type: EventNodeJoined, Node: node})
+		} else if !online && previous.online[node] {
+			emit(Event{Type: EventNodeLeft, Node: node})
+		}
+	}
+	for _, node := range sortedSet(previous.online) {
+		if _, ok := current.online[node]; !ok && previous.online[node] {
+			emit(Event{Type: EventNodeLeft, Node: node})
+		}
+	}
+	for _, node := range sortedSet(current.standby) {
+		standby := current.standby[node]
+		if standby && !previous.standby[node] {
+			emit(Event{Type: EventNodeStandby, Node: node})
+		} else if !standby && previous.standby[node] {
+			emit(Event{Type: EventNodeUnstandby, Node: node})
+		}
+	}
+
+	for _, id := range unionKeys(previous.active, current.active) {
+		started := missingNodes(current.active[id], previous.active[id])
+		stopped := missingNodes(previous.active[id], current.active[id])
+		if len(started) == 1 && len(stopped) == 1 {
+			emit(Event{Type: EventResourceMoved, Resource: id, From: stopped[0], Node: started[0]})
+			continue
+		}
+		for _, node := range stopped {
+			emit(Event{Type: EventResourceStopped, Resource: id, Node: node})
+		}
+		for _, node := range started {
+			emit(Event{Type: EventResourceStarted, Resource: id, Node: node})
+		}
+	}
+	for _, id := range unionKeys(previous.failed, current.failed) {
+		for _, node := range missingNodes(current.failed[id], previous.failed[id]) {
+			emit(Event{Type: EventResourceFailed, Resource: id, Node: node})
+		}
+	}
+
+	names := make(map[string]bool)
+	for name := range previous.properties {
+		names[name] = true
+	}
+	for name := range current.properties {
+		names[name] = true
+	}
+	for _, name := range sortedSet(names) {
+		old, value := previous.properties[name], current.properties[name]
+		if old != value {
+			emit(Event{Type: EventPropertyChanged, Name: name, OldValue: old, Value: value})
+		}
+	}
+
+	for _, id := range sortedSet(current.constraints) {
+		if !previous.constraints[id] {
+			emit(Event{Type: EventConstraintAdded, Constraint: id})
+		}
+	}
+	for _, id := range sortedSet(previous.constraints) {
+		if !current.constraints[id] {
+			emit(Event{Type: EventConstraintRemoved, Constraint: id})
+		}
+	}
+
+	return events
+}
+
+// missingNodes returns the sorted nodes of a that are not in b.
+func missingNodes(a, b map[string]bool) []string {
+	var nodes []string
+	for node := range a {
+		if !b[node] {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func unionKeys(a, b map[string]map[string]bool) []string {
+	var keys []string
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,198 @@
+package cib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	xmltree "github.com/beevik/etree"
+	"github.com/google/go-cmp/cmp"
+)
+
+const watchXML = `<cib admin_epoch="0" epoch="1" num_updates="0"><configuration>
+<crm_config><cluster_property_set id="cib-bootstrap-options">
+	<nvpair id="cib-bootstrap-options-stonith-enabled" name="stonith-enabled" value="true"/>
+</cluster_property_set></crm_config>
+<nodes>
+	<node id="1" uname="la1"/>
+	<node id="2" uname="la2"><instance_attributes id="nodes-2">
+		<nvpair id="nodes-2-standby" name="standby" value="off"/>
+	</instance_attributes></node>
+</nodes>
+<resources>
+	<primitive id="p_ip" class="ocf" provider="heartbeat" type="IPaddr2"/>
+	<primitive id="p_web" class="ocf" provider="heartbeat" type="apache"/>
+</resources>
+<constraints>
+	<rsc_location id="lo_a" rsc="p_ip" node="la1" score="50"/>
+</constraints>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"/>
+	<node_state id="2" uname="la2" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="2"><lrm_resources>
+		<lrm_resource id="p_ip">
+			<lrm_rsc_op id="p_ip_last_0" operation="start" call-id="3" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+		<lrm_resource id="p_web">
+			<lrm_rsc_op id="p_web_last_0" operation="start" call-id="4" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+</status></cib>`
+
+func TestWatch(t *testing.T) {
+	// each step of the sequence is watchXML with some of these edits
+	var (
+		standby     = []string{`name="standby" value="off"`, `name="standby" value="on"`}
+		noStonith   = []string{`name="stonith-enabled" value="true"`, `name="stonith-enabled" value="false"`}
+		constraintB = []string{`rsc_location id="lo_a"`, `rsc_location id="lo_b"`}
+		la1Left     = []string{`uname="la1" in_ccm="true"`, `uname="la1" in_ccm="false"`}
+		webFailed   = []string{`call-id="4" rc-code="0"`, `call-id="4" rc-code="1"`}
+		epoch2      = []string{`epoch="1" num_updates="0"`, `epoch="2" num_updates="0"`}
+		epoch2Upd1  = []string{`epoch="1" num_updates="0"`, `epoch="2" num_updates="1"`}
+	)
+	edit := func(edits ...[]string) string {
+		var pairs []string
+		for _, e := range edits {
+			pairs = append(pairs, e...)
+		}
+		return strings.NewReplacer(pairs...).Replace(watchXML)
+	}
+
+	sequence := []string{
+		watchXML,
+		// same version, content must be ignored
+		edit(standby, noStonith, constraintB, la1Left, webFailed),
+		edit(epoch2, standby, noStonith, constraintB),
+		edit(epoch2Upd1, standby, noStonith, constraintB, la1Left, webFailed),
+	}
+	reads := 0
+	listCommand = &testCommand{
+		func(_ string) (string, string, error) {
+			xml := sequence[reads]
+			if reads < len(sequence)-1 {
+				reads++
+			}
+			return xml, "", nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var cib CIB
+	events, err := cib.Watch(ctx, WatchOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for event := range events {
+		actual = append(actual, event.Version.String()+" "+event.String())
+	}
+
+	expect := []string{
+		"0.2.0 node-standby la2",
+		"0.2.0 property-changed stonith-enabled 'true' -> 'false'",
+		"0.2.0 constraint-added lo_b",
+		"0.2.0 constraint-removed lo_a",
+		"0.2.1 node-left la1",
+		"0.2.1 resource-failed p_web la2",
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected events")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual))
+	}
+	if cib.Doc != nil {
+		t.Errorf("Watch modified the document")
+	}
+}
+
+func TestDiffWatchSnapshots(t *testing.T) {
+	previous := watchSnapshot{
+		active: map[string]map[string]bool{
+			"p_ip":   {"la1": true},
+			"p_web":  {"la1": true},
+			"p_drbd": {"la1": true, "la2": true},
+		},
+		online: map[string]bool{"la1": true, "la2": false},
+	}
+	current := watchSnapshot{
+		version: CIBVersion{Epoch: 3},
+		active: map[string]map[string]bool{
+			"p_ip":   {"la2": true},
+			"p_drbd": {"la1": true, "la2": true, "la3": true},
+			"p_db":   {"la2": true},
+		},
+		online: map[string]bool{"la1": true, "la2": true},
+	}
+
+	var actual []string
+	for _, event := range diffWatchSnapshots(previous, current) {
+		actual = append(actual, event.String())
+	}
+	expect := []string{
+		"node-joined la2",
+		"resource-started p_db la2",
+		"resource-started p_drbd la3",
+		"resource-moved p_ip la1 -> la2",
+		"resource-stopped p_web la1",
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected events")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual))
+	}
+}
+
+func TestWatchSnapshotRemoteNodes(t *testing.T) {
+	remoteXML := `<cib><configuration>
+<nodes><node id="1" uname="la1"/></nodes>
+<resources>
+	<primitive id="vm1" class="ocf" provider="heartbeat" type="VirtualDomain">
+		<meta_attributes id="vm1-meta_attributes">
+			<nvpair id="vm1-meta_attributes-remote-node" name="remote-node" value="guest1"/>
+		</meta_attributes>
+	</primitive>
+</resources>
+</configuration><status>
+	<node_state id="1" uname="la1" in_ccm="true" crmd="online" join="member" expected="member"><lrm id="1"><lrm_resources>
+		<lrm_resource id="vm1">
+			<lrm_rsc_op id="vm1_last_0" operation="stop" call-id="3" rc-code="0" op-status="0" interval="0"/>
+		</lrm_resource>
+	</lrm_resources></lrm></node_state>
+	<node_state id="remote1" uname="remote1" remote_node="true" in_ccm="false"/>
+</status></cib>`
+	// vm1 starts and with it guest1, remote1 joins
+	joinedXML := strings.NewReplacer(
+		`operation="stop"`, `operation="start"`,
+		`remote_node="true" in_ccm="false"`, `remote_node="true" in_ccm="true"`,
+	).Replace(remoteXML)
+
+	snapshot := func(xml string) watchSnapshot {
+		doc := xmltree.NewDocument()
+		if err := doc.ReadFromString(xml); err != nil {
+			t.Fatal(err)
+		}
+		s, err := newWatchSnapshot(doc.Root())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	previous := snapshot(remoteXML)
+	current := snapshot(joinedXML)
+
+	var actual []string
+	for _, event := range diffWatchSnapshots(previous, current) {
+		actual = append(actual, event.String())
+	}
+	expect := []string{
+		"node-joined guest1",
+		"node-joined remote1",
+		"resource-started vm1 la1",
+	}
+	if !cmp.Equal(actual, expect) {
+		t.Errorf("Unexpected events")
+		t.Errorf("Diff: %s", cmp.Diff(expect, actual))
+	}
+}